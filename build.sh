@@ -0,0 +1,39 @@
+#!/usr/bin/env bash
+# 不使用goreleaser时的发布编译脚本，产物与发布页的文件名一致，输出到dist目录
+# 用法：./build.sh [版本号]，版本号默认取git tag
+set -e
+
+cd "$(dirname "$0")"
+
+version=${1:-$(git describe --tags --always 2>/dev/null || echo dev)}
+commit=$(git rev-parse --short=12 HEAD 2>/dev/null || echo unknown)
+date=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+ldflags="-s -w -X main.version=$version -X main.commit=$commit -X main.date=$date"
+
+# 目标平台：GOOS/GOARCH/附加变量
+targets=(
+    "linux amd64"
+    "linux arm64"
+    "linux arm GOARM=7"
+    "linux mips GOMIPS=softfloat"
+    "linux mipsle GOMIPS=softfloat"
+)
+
+mkdir -p dist
+for target in "${targets[@]}"; do
+    read -r goos goarch extra <<< "$target"
+    name="netmonitor-$goos-$goarch"
+    if [ "$goarch" == "arm" ]; then
+        name="${name}v7"
+    fi
+    echo "编译 $name ..."
+    env CGO_ENABLED=0 GOOS=$goos GOARCH=$goarch $extra \
+        go build -trimpath -ldflags="$ldflags" -o "dist/$name" ./src
+    # 不含网页面板、API、webhook和OIDC登录的精简版，适合存储空间紧张的路由器
+    echo "编译 $name-noweb ..."
+    env CGO_ENABLED=0 GOOS=$goos GOARCH=$goarch $extra \
+        go build -tags noweb -trimpath -ldflags="$ldflags" -o "dist/$name-noweb" ./src
+done
+
+(cd dist && sha256sum netmonitor-* > checksums.txt)
+echo "完成，文件位于dist目录"
@@ -79,6 +79,7 @@ arch=$(uname -m)
 case $arch in
     x86_64) arch="amd64" ;;
     aarch64) arch="arm64" ;;
+    armv7l) arch="armv7" ;;
     *) echo "不支持 $arch CPU架构"; exit 1 ;;
 esac
 
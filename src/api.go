@@ -0,0 +1,186 @@
+//go:build !noweb
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type QuotaStatus struct {
+	Name     string  `json:"name"` // 线路名称，总流量为空
+	Receive  uint64  `json:"receive"`
+	Transmit uint64  `json:"transmit"`
+	Category string  `json:"category"`
+	Limit    float64 `json:"limit"`   // GB，0表示不限量
+	UsedGB   float64 `json:"used_gb"` // 按category计算的使用量
+
+	// 本周期首次达到threshold和ratio的时间，只有总流量有
+	ThresholdReached string `json:"threshold_reached,omitempty"`
+	RatioReached     string `json:"ratio_reached,omitempty"`
+}
+
+type APIStatus struct {
+	Device    string        `json:"device"`
+	LastReset string        `json:"last_reset"`
+	NextReset string        `json:"next_reset"` // 日历中没有后续周期时为空
+	Paused    bool          `json:"paused"`
+	Quotas    []QuotaStatus `json:"quotas"` // 第一项为总流量，其后为各线路
+
+	// 本周期内程序停止运行的秒数，以及其中系统重启过的次数
+	DowntimeSeconds int64 `json:"downtime_seconds"`
+	DowntimeReboots int   `json:"downtime_reboots"`
+
+	// 正在倒计时的关机，没有时为空
+	Shutdown *ShutdownStatus `json:"shutdown,omitempty"`
+}
+
+type ShutdownStatus struct {
+	At        string `json:"at"`        // 计划关机的时间，RFC3339格式
+	Reason    string `json:"reason"`    // 关机原因
+	Remaining int64  `json:"remaining"` // 剩余秒数
+}
+
+// Write a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// GET /api/status, the usage of the period for scripts and home automation
+func handleAPIStatus(w http.ResponseWriter, r *http.Request, user principal) {
+	config, err := loadSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	status := APIStatus{
+		Device:    config.Device,
+		LastReset: config.Statistics.LastReset,
+		Paused:    config.Statistics.Pause != nil,
+	}
+	if reset := nextResetDate(&config, time.Now()); !reset.IsZero() {
+		status.NextReset = reset.Format(time.RFC3339)
+	}
+	downtime, reboots := periodDowntime(&config, time.Now())
+	status.DowntimeSeconds, status.DowntimeReboots = int64(downtime.Seconds()), reboots
+	if at := pendingShutdown(&config); !at.IsZero() {
+		status.Shutdown = &ShutdownStatus{
+			At:        at.Format(time.RFC3339),
+			Reason:    config.Statistics.Shutdown.Reason,
+			Remaining: int64(max(time.Until(at), 0).Seconds()),
+		}
+	}
+	status.Quotas = append(status.Quotas, QuotaStatus{
+		Receive:  config.Statistics.TotalReceive,
+		Transmit: config.Statistics.TotalTransmit,
+		Category: config.Comparison.Category,
+		Limit:    effectiveLimit(&config),
+		UsedGB:   categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit),
+
+		ThresholdReached: config.Statistics.ThresholdReached,
+		RatioReached:     config.Statistics.RatioReached,
+	})
+	for _, wan := range config.Wans {
+		stats := config.Statistics.Wans[wan.Name]
+		status.Quotas = append(status.Quotas, QuotaStatus{
+			Name:     wan.Name,
+			Receive:  stats.TotalReceive,
+			Transmit: stats.TotalTransmit,
+			Category: wan.Comparison.Category,
+			Limit:    wan.Comparison.Limit,
+			UsedGB:   categoryUsageGB(wan.Comparison.Category, stats.TotalReceive, stats.TotalTransmit),
+		})
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// POST /api/<action>, queued for the monitor like the command line does. The
+// parameters are form values: for and reason for pause, reason, from and to or
+// for for annotate, reason for reset. Evaluate only wakes the monitor up.
+func handleAPIControl(configFilePath, action string) func(http.ResponseWriter, *http.Request, principal) {
+	return func(w http.ResponseWriter, r *http.Request, user principal) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Browsers send a login along with cross-site form posts, so an action from a
+		// browser also needs the token in the form, as the dashboard's forms have it
+		if _, _, basic := r.BasicAuth(); basic && r.FormValue("token") != user.token {
+			http.Error(w, "token required", http.StatusForbidden)
+			return
+		}
+
+		command, err := controlCommand(action, r.FormValue)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		command.By = "http:" + user.name
+		if err := queueCommand(configFilePath, command); err != nil {
+			logf("Failed to queue %s from the http server: %v\n", action, err)
+			http.Error(w, "failed to queue command", http.StatusInternalServerError)
+			return
+		}
+
+		if r.FormValue("redirect") != "" {
+			target := r.Referer()
+			if target == "" {
+				target = "/"
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"queued": action})
+	}
+}
+
+// Build the queued command from the request's parameters
+func controlCommand(action string, param func(string) string) (Command, error) {
+	command := Command{Action: action, Reason: param("reason")}
+	var duration time.Duration
+	if value := param("for"); value != "" {
+		var err error
+		if duration, err = time.ParseDuration(value); err != nil || duration < 0 {
+			return command, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+
+	switch action {
+	case actionPause:
+		if duration > 0 {
+			command.Until = time.Now().Add(duration).Format(time.RFC3339)
+		}
+	case actionAnnotate:
+		if command.Reason == "" {
+			return command, fmt.Errorf("reason is required")
+		}
+		start := time.Now()
+		if value := param("from"); value != "" {
+			t, err := parseTimeFlag(value)
+			if err != nil {
+				return command, err
+			}
+			start = t
+		}
+		command.From = start.Format(time.RFC3339)
+		if value := param("to"); value != "" {
+			end, err := parseTimeFlag(value)
+			if err != nil {
+				return command, err
+			}
+			if end.Before(start) {
+				return command, fmt.Errorf("the end of the annotation is before its start")
+			}
+			command.Until = end.Format(time.RFC3339)
+		} else if duration > 0 {
+			command.Until = start.Add(duration).Format(time.RFC3339)
+		}
+	}
+	return command, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What a message service can show besides plain text
+const (
+	capText = 1 << iota
+	capMarkdown
+	capImage
+	capFile
+)
+
+var serviceCapabilities = map[string]int{
+	"telegram":   capText | capMarkdown | capImage | capFile,
+	"gotify":     capText | capMarkdown,
+	"discord":    capText | capMarkdown | capImage | capFile,
+	"slack":      capText | capMarkdown,
+	"email":      capText | capImage | capFile,
+	"webhook":    capText,
+	"ntfy":       capText,
+	"pushover":   capText,
+	"bark":       capText,
+	"serverchan": capText | capMarkdown,
+	"dingtalk":   capText | capMarkdown,
+	"wecom":      capText,
+	"feishu":     capText | capMarkdown,
+	"matrix":     capText,
+	"teams":      capText,
+	"mock":       capText | capFile,
+}
+
+// A report file sent with a message
+type Attachment struct {
+	Name        string // 文件名
+	ContentType string
+	Data        []byte
+}
+
+// Services show PNG and JPEG as pictures, anything else (SVG included) is a file
+func (a Attachment) isImage() bool {
+	return a.ContentType == "image/png" || a.ContentType == "image/jpeg"
+}
+
+// The attachments offered for download on the web dashboard, newest last
+var reportFiles struct {
+	sync.RWMutex
+	files []Attachment
+}
+
+const maxReportFiles = 20
+
+// Send a file natively to the services that take files, the others get a download link
+// from the web dashboard instead. Like messages it counts as sent once one service got it.
+func sendAttachment(config *Config, services []string, caption string, attachment Attachment) error {
+	var linked []string
+	var errs []error
+	delivered := false
+	for _, service := range services {
+		capabilities := serviceCapabilities[service]
+		if capabilities&capFile == 0 && (!attachment.isImage() || capabilities&capImage == 0) {
+			linked = append(linked, service)
+			continue
+		}
+		err := sendFile(config, service, caption, attachment)
+		if err != nil && len(services) > 1 {
+			err = fmt.Errorf("%s: %v", service, err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		delivered = delivered || err == nil
+	}
+
+	switch {
+	case len(linked) == 0:
+	case config.HTTP.Listen == "":
+		logf("Attachment %s not sent, %s can't take files and the web dashboard is off\n", attachment.Name, strings.Join(linked, ", "))
+	default:
+		publishReport(attachment)
+		_, err := sendMessageTo(config, linked, fmt.Sprintf("%s：%s", caption, dashboardURL(config, "/reports/"+attachment.Name)))
+		if err != nil && len(linked) == 1 && len(services) > 1 {
+			err = fmt.Errorf("%s: %v", linked[0], err)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		delivered = delivered || err == nil
+	}
+	if !delivered && len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		logf("Attachment %s not delivered to %v\n", attachment.Name, err)
+	}
+	return nil
+}
+
+// Send a file with the given service
+func sendFile(config *Config, service, caption string, attachment Attachment) error {
+	switch service {
+	case "telegram":
+		return sendTelegramFile(config.Message.Telegram, caption, attachment, config.Device)
+	case "discord":
+		return sendDiscordFile(config.Message.Discord.WebhookURL, caption, attachment, config.Device)
+	case "email":
+		return sendEmailFile(config, caption, attachment)
+	case "mock":
+		return sendMockFile(config.Message.Mock.File, caption, attachment, config.Device)
+	}
+	return fmt.Errorf("message service %s can't send files", service)
+}
+
+// Send a picture with sendPhoto or any other file with sendDocument to each chat, the
+// files come with the summary so they're routine messages
+func sendTelegramFile(telegram TelegramMessage, caption string, attachment Attachment, device string) error {
+	method, field := "sendDocument", "document"
+	if attachment.isImage() {
+		method, field = "sendPhoto", "photo"
+	}
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", telegram.Token, method)
+
+	return sendTelegramChats(telegram, func(chatID string) error {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for key, value := range telegram.fields(chatID, true) {
+			form.WriteField(key, fmt.Sprint(value))
+		}
+		form.WriteField("caption", fmt.Sprintf("[%s] %s", device, caption))
+		part, err := form.CreateFormFile(field, attachment.Name)
+		if err != nil {
+			return err
+		}
+		part.Write(attachment.Data)
+		form.Close()
+
+		resp, err := notifyClient("telegram").Post(url, form.FormDataContentType(), &body)
+		if err != nil {
+			return fmt.Errorf("failed to send file to Telegram: %v", err)
+		}
+		defer resp.Body.Close()
+		return checkTelegramResponse(resp)
+	})
+}
+
+// Write the file next to the mock message file, or only note it on stdout
+func sendMockFile(file, caption string, attachment Attachment, device string) error {
+	if file != "" {
+		path := filepath.Join(filepath.Dir(file), attachment.Name)
+		if err := os.WriteFile(path, attachment.Data, 0644); err != nil {
+			return fmt.Errorf("failed to write mock attachment: %v", err)
+		}
+	}
+	return sendMockMessage(file, fmt.Sprintf(tr("%s [附件 %s，%d字节]"), caption, attachment.Name, len(attachment.Data)), device)
+}
+
+// Keep an attachment for download, the oldest ones are dropped
+func publishReport(attachment Attachment) {
+	reportFiles.Lock()
+	defer reportFiles.Unlock()
+	for i, file := range reportFiles.files {
+		if file.Name == attachment.Name {
+			reportFiles.files = append(reportFiles.files[:i], reportFiles.files[i+1:]...)
+			break
+		}
+	}
+	reportFiles.files = append(reportFiles.files, attachment)
+	if len(reportFiles.files) > maxReportFiles {
+		reportFiles.files = reportFiles.files[len(reportFiles.files)-maxReportFiles:]
+	}
+}
+
+// The daily usage of the period as CSV, in bytes and in the configured unit
+func usageCSV(config *Config) []byte {
+	days := make([]DayUsage, 0, len(config.History.Days))
+	for _, day := range config.History.Days {
+		if day.Date >= lastResetDate(config) {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+
+	var b bytes.Buffer
+	writer := csv.NewWriter(&b)
+	writer.Write([]string{"date", "receive_bytes", "transmit_bytes", "receive_gb", "transmit_gb"})
+	for _, day := range days {
+		writer.Write([]string{
+			day.Date,
+			strconv.FormatUint(day.Receive, 10),
+			strconv.FormatUint(day.Transmit, 10),
+			strconv.FormatFloat(float64(day.Receive)/bytesToGB, 'f', 3, 64),
+			strconv.FormatFloat(float64(day.Transmit)/bytesToGB, 'f', 3, 64),
+		})
+	}
+	writer.Flush()
+	return b.Bytes()
+}
+
+// Send the chart and the daily usage of the ending period after its summary
+func sendSummaryAttachments(config *Config, now time.Time) error {
+	if len(config.History.Days) == 0 {
+		return nil
+	}
+	period := lastResetDate(config)
+	attachments := []Attachment{
+		{Name: "usage-" + period + ".svg", ContentType: "image/svg+xml", Data: []byte(usageChartSVG(config, periodStart(config, now), now, ""))},
+		{Name: "usage-" + period + ".csv", ContentType: "text/csv", Data: usageCSV(config)},
+	}
+	for _, attachment := range attachments {
+		if err := sendAttachment(config, config.Message.route(routeSummary), fmt.Sprintf(tr("%s起的每日流量"), period), attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// One applied control command in the audit log
+type AuditEntry struct {
+	Time   string `json:"time"`             // 生效时间，RFC3339格式
+	Queued string `json:"queued"`           // 提交时间
+	Action string `json:"action"`           // 命令
+	By     string `json:"by"`               // 提交命令的用户，例如"cli:root"、"http:amy"
+	Detail string `json:"detail,omitempty"` // 原因、备注内容等
+}
+
+// The audit log lives next to the config file like the command queue, one JSON line per command
+func auditLogPath(configFilePath string) string {
+	return configFilePath + ".audit"
+}
+
+// The user running a CLI command, the one behind sudo if any
+func cliPrincipal() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return "cli:" + name
+	}
+	if current, err := user.Current(); err == nil {
+		return "cli:" + current.Username
+	}
+	return "cli:" + os.Getenv("USER")
+}
+
+// Append an applied command to the audit log
+func writeAudit(configFilePath string, command Command) {
+	by := command.By
+	if by == "" {
+		by = "unknown"
+	}
+	detail := command.Reason
+	if command.Action == actionTopup {
+		detail = strings.TrimSpace(fmt.Sprintf("%.2f GB %s", float64(command.Bytes)/bytesToGB, command.Reason))
+	}
+	// The share token is a secret, only record whether a link was created
+	if command.Action == actionShare {
+		detail = "revoked"
+		if command.Reason != "" {
+			detail = "created"
+		}
+	}
+	data, err := json.Marshal(AuditEntry{
+		Time:   time.Now().Format(time.RFC3339),
+		Queued: command.Time,
+		Action: command.Action,
+		By:     by,
+		Detail: detail,
+	})
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(auditLogPath(configFilePath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		logf("Failed to write audit log: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		logf("Failed to write audit log: %v\n", err)
+	}
+}
+
+// Tell the recipients who changed the accounting, these actions change what is billed
+func notifyControl(config *Config, command Command) {
+	var message string
+	switch command.Action {
+	case actionPause:
+		message = fmt.Sprintf(tr("%s暂停了流量统计"), command.By)
+		if command.Until != "" {
+			if until, err := time.Parse(time.RFC3339, command.Until); err == nil {
+				message += tr("，直到") + until.Local().Format("01-02 15:04")
+			}
+		}
+	case actionResume:
+		message = fmt.Sprintf(tr("%s恢复了流量统计"), command.By)
+	case actionReset:
+		message = fmt.Sprintf(tr("%s手动重置了本周期的统计"), command.By)
+	case actionCancelShutdown:
+		if pendingShutdown(config).IsZero() {
+			return
+		}
+		message = fmt.Sprintf(tr("%s取消了计划的关机（%s）"), command.By, config.Statistics.Shutdown.Reason)
+	case actionTopup:
+		if !config.Prepaid {
+			return
+		}
+		gb := float64(command.Bytes) / bytesToGB
+		message = fmt.Sprintf(tr("%s充值了%.2f GB，充值后余额%.2f GB"), command.By, gb, prepaidBalance(config)+gb)
+	default:
+		return
+	}
+	if command.Reason != "" {
+		message += "：" + command.Reason
+	}
+
+	err := sendMessage(config, message)
+	reportHealth(config, healthSend, err)
+	if err != nil {
+		logf("Failed to send %s notice: %v\n", command.Action, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The public Bark server, used when no url is set
+const defaultBarkURL = "https://api.day.app"
+
+type BarkMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	URL             string `json:"url"`             // Bark服务器地址，为空时使用https://api.day.app
+	Key             string `json:"key"`             // Bark App中显示的设备key
+	Sound           string `json:"sound,omitempty"` // 提示音，例如"alarm"，为空时使用App的默认提示音
+	Group           string `json:"group,omitempty"` // 通知分组，为空时使用"netMonitor"
+}
+
+// Push a message to the iPhone through a Bark server, titled with the device like
+// Gotify. Shutdown warnings are time sensitive and break through focus modes.
+func sendBarkMessage(config *Config, message string) error {
+	bark := config.Message.Bark
+	server := bark.URL
+	if server == "" {
+		server = defaultBarkURL
+	}
+	group := bark.Group
+	if group == "" {
+		group = "netMonitor"
+	}
+	body := map[string]string{
+		"device_key": bark.Key,
+		"title":      fmt.Sprintf("Network Monitor: %s", config.Device),
+		"body":       message,
+		"group":      group,
+	}
+	if bark.Sound != "" {
+		body["sound"] = bark.Sound
+	}
+	if config.urgent {
+		body["level"] = "timeSensitive"
+	}
+	jsonBody, _ := json.Marshal(body)
+
+	resp, err := notifyClient("bark").Post(strings.TrimRight(server, "/")+"/push", "application/json; charset=utf-8", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to send message to Bark: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode >= 400 || result.Code != http.StatusOK {
+		return fmt.Errorf("got error from Bark: %s %s", resp.Status, result.Message)
+	}
+	return nil
+}
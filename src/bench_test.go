@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const benchNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 1234567    1234    0    0    0     0          0         0  1234567    1234    0    0    0     0       0          0
+  eth0: %d 4567890    0    0    0     0          0         0 %d 3456789    0    0    0     0       0          0
+docker0: 0       0    0    0    0     0          0         0        0       0    0    0    0     0       0          0
+`
+
+// A config with a period's worth of history, the way it looks late in a period
+func benchConfig() Config {
+	config := Config{Device: "bench", Interface: "eth0", Interval: 60, StartDay: 1}
+	config.Comparison = Comparison{Category: "upload+download", Limit: 1000, Threshold: 0.8, Ratio: 0.95}
+	config.Statistics.LastReset = time.Now().AddDate(0, 0, -20).Format(time.RFC3339)
+	config.Statistics.Counters = map[string]NetStats{"eth0": {ReceiveBytes: 1 << 30, TransmitBytes: 1 << 29}}
+	now := time.Now()
+	for day := 30; day > 0; day-- {
+		config.History.Days = append(config.History.Days, DayUsage{Date: now.AddDate(0, 0, -day).Format("2006-01-02"), Receive: 5 << 30, Transmit: 1 << 30})
+	}
+	for i := 0; i < 50; i++ {
+		addEvent(&config, eventAnnotation, now.Add(-time.Duration(i)*time.Hour), time.Time{}, fmt.Sprintf("note %d", i))
+	}
+	for i := 0; i < 24*30; i++ {
+		recordHeatmap(&config, now.Add(-time.Duration(i)*time.Hour), 1<<20)
+	}
+	return config
+}
+
+// Every save differs from the last one, the counters change with each sample
+func BenchmarkSaveConfig(b *testing.B) {
+	quiet = true
+	path := filepath.Join(b.TempDir(), "config.json")
+	config := benchConfig()
+	if err := saveConfig(path, config); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config.Statistics.TotalReceive += 1500
+		config.Statistics.LastSample = time.Unix(int64(i), 0).Format(time.RFC3339)
+		if err := saveConfig(path, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Read the counters and account them, without the save
+func BenchmarkSample(b *testing.B) {
+	quiet = true
+	path := filepath.Join(b.TempDir(), "dev")
+	config := benchConfig()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		os.WriteFile(path, []byte(fmt.Sprintf(benchNetDev, 1<<30+i*1500, 1<<29+i*500)), 0644)
+		b.StartTimer()
+		current, err := readNetDev(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		accountCounters(&config, current)
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "syscall"
+
+// Bind the socket to a network interface with SO_BINDTODEVICE, so its packets leave
+// through that interface whatever the routing table says. Needs root or CAP_NET_RAW.
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var bindErr error
+		err := c.Control(func(fd uintptr) {
+			bindErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		})
+		if err != nil {
+			return err
+		}
+		return bindErr
+	}
+}
+
+func bindToDeviceSupported() bool {
+	return true
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// SO_BINDTODEVICE is specific to Linux
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return errors.New("binding to an interface is not supported on this system")
+	}
+}
+
+func bindToDeviceSupported() bool {
+	return false
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Period boundaries read from billing_calendar, shared with the HTTP server
+var billingCalendar struct {
+	sync.RWMutex
+	dates  []time.Time // 每个计费周期开始的日期（本地时间0点），已排序
+	loaded time.Time
+}
+
+const (
+	calendarRefresh = 24 * time.Hour // the calendar is read again once a day
+	calendarHorizon = 2              // years of recurring events expanded ahead
+	calendarMaxSize = 1 << 20
+)
+
+// Read the calendar from an http(s) URL, e.g. a CalDAV export link, or from a file
+func readCalendarSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch billing calendar: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got error status from billing calendar: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, calendarMaxSize))
+}
+
+// Parse the start dates of the events in an iCalendar file. Recurring events are
+// expanded with FREQ, INTERVAL, COUNT and UNTIL of their RRULE; times are dropped,
+// a period starts at the local midnight of its date.
+func parseICS(data []byte, now time.Time) ([]time.Time, error) {
+	// Unfold the continuation lines first
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	data = bytes.ReplaceAll(data, []byte("\n "), nil)
+	data = bytes.ReplaceAll(data, []byte("\n\t"), nil)
+
+	horizon := now.AddDate(calendarHorizon, 0, 0)
+	seen := make(map[string]bool)
+	var dates []time.Time
+	var start time.Time
+	var rule string
+	inEvent := false
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, _ := strings.Cut(strings.TrimSpace(line), ":")
+		params := ""
+		name, params, _ = strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				inEvent, start, rule = true, time.Time{}, ""
+			}
+		case "DTSTART":
+			if inEvent {
+				t, err := parseICSTime(value, params)
+				if err != nil {
+					return nil, err
+				}
+				start = t
+			}
+		case "RRULE":
+			if inEvent {
+				rule = value
+			}
+		case "END":
+			if value != "VEVENT" || !inEvent {
+				continue
+			}
+			inEvent = false
+			if start.IsZero() {
+				continue
+			}
+			occurrences, err := expandRRule(start, rule, horizon)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range occurrences {
+				if key := t.Format("2006-01-02"); !seen[key] {
+					seen[key] = true
+					dates = append(dates, t)
+				}
+			}
+		}
+	}
+	if len(dates) == 0 {
+		return nil, fmt.Errorf("no events in billing calendar")
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
+
+// Parse a DTSTART value into the local midnight of its date
+func parseICSTime(value, params string) (time.Time, error) {
+	location := time.Local
+	for _, param := range strings.Split(params, ";") {
+		if tzid, ok := strings.CutPrefix(param, "TZID="); ok {
+			if loc, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+				location = loc
+			}
+		}
+	}
+
+	var t time.Time
+	var err error
+	switch {
+	case len(value) == 8:
+		t, err = time.ParseInLocation("20060102", value, time.Local)
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse("20060102T150405Z", value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", value, location)
+	}
+	if err != nil {
+		return t, fmt.Errorf("invalid DTSTART %q in billing calendar", value)
+	}
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// Expand a recurrence rule up to the horizon. Like RFC 5545, dates that don't exist
+// in a month or year (the 31st, Feb 29) are skipped rather than moved.
+func expandRRule(start time.Time, rule string, horizon time.Time) ([]time.Time, error) {
+	if rule == "" {
+		return []time.Time{start}, nil
+	}
+	freq, interval, count := "", 1, 0
+	until := horizon
+	for _, part := range strings.Split(rule, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "FREQ":
+			freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid RRULE %q in billing calendar", rule)
+			}
+			interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid RRULE %q in billing calendar", rule)
+			}
+			count = n
+		case "UNTIL":
+			t, err := parseICSTime(value, "")
+			if err != nil {
+				return nil, err
+			}
+			until = t
+		}
+	}
+
+	var dates []time.Time
+	for i := 0; count == 0 || len(dates) < count; i++ {
+		var t time.Time
+		switch freq {
+		case "DAILY":
+			t = start.AddDate(0, 0, i*interval)
+		case "WEEKLY":
+			t = start.AddDate(0, 0, 7*i*interval)
+		case "MONTHLY":
+			t = time.Date(start.Year(), start.Month()+time.Month(i*interval), start.Day(), 0, 0, 0, 0, time.Local)
+		case "YEARLY":
+			t = time.Date(start.Year()+i*interval, start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+		default:
+			return nil, fmt.Errorf("unsupported RRULE %q in billing calendar", rule)
+		}
+		if t.After(until) || t.After(horizon) {
+			break
+		}
+		if t.Day() == start.Day() {
+			dates = append(dates, t)
+		}
+	}
+	return dates, nil
+}
+
+// Read and parse the calendar, replacing the previous boundaries
+func loadCalendar(source string, now time.Time) error {
+	data, err := readCalendarSource(source)
+	if err != nil {
+		return err
+	}
+	dates, err := parseICS(data, now)
+	if err != nil {
+		return err
+	}
+	billingCalendar.Lock()
+	billingCalendar.dates, billingCalendar.loaded = dates, now
+	billingCalendar.Unlock()
+	return nil
+}
+
+// Read the calendar again once a day, once a week near the limit. The previous
+// boundaries stay in use if that fails.
+func refreshCalendar(config *Config, now time.Time) {
+	refresh := calendarRefresh
+	if conserveActive {
+		refresh = conserveCalendarRefresh
+	}
+	billingCalendar.RLock()
+	due := now.Sub(billingCalendar.loaded) >= refresh
+	billingCalendar.RUnlock()
+	if !due {
+		return
+	}
+	if err := loadCalendar(config.BillingCalendar, now); err != nil {
+		logf("Failed to refresh billing calendar, keeping the previous one: %v\n", err)
+		billingCalendar.Lock()
+		billingCalendar.loaded = now
+		billingCalendar.Unlock()
+	}
+}
+
+// Check whether a calendar boundary passed since the last reset
+func calendarResetDue(config *Config, now time.Time) bool {
+	billingCalendar.RLock()
+	defer billingCalendar.RUnlock()
+	latest := ""
+	for _, date := range billingCalendar.dates {
+		if date.After(now) {
+			break
+		}
+		latest = date.Format("2006-01-02")
+	}
+	return latest != "" && lastResetDate(config) < latest
+}
+
+// The calendar boundaries after now, at most count of them
+func calendarResets(now time.Time, count int) []time.Time {
+	billingCalendar.RLock()
+	defer billingCalendar.RUnlock()
+	var resets []time.Time
+	for _, date := range billingCalendar.dates {
+		if date.After(now) && len(resets) < count {
+			resets = append(resets, date)
+		}
+	}
+	return resets
+}
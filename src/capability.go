@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// An optional feature and what it needs from the system
+type capability struct {
+	feature string
+	needs   string
+	used    bool  // the config turns it on
+	err     error // why the system can't provide it, nil when it can
+}
+
+// Probe what the optional features need, so a feature that can't work on this kernel
+// or distro is explained at startup instead of failing when it is first used
+func probeCapabilities(config *Config, configFilePath string) []capability {
+	rung := func(action string) bool {
+		for _, r := range config.Ladder {
+			if r.Action == action {
+				return true
+			}
+		}
+		return config.SafeMode != nil && config.SafeMode.Action == action
+	}
+	command := func(name string) error {
+		if !commandExists(name) {
+			return fmt.Errorf("%s not found in PATH", name)
+		}
+		return nil
+	}
+
+	shutdown := command("shutdown")
+	if shutdown != nil && commandExists("poweroff") {
+		shutdown = nil
+	}
+	uptime := error(nil)
+	if _, err := readUptime(); err != nil {
+		uptime = err
+	}
+	clock := error(nil)
+	if _, err := clockSynchronized(); err != nil {
+		clock = err
+	}
+	ethtool := command("ethtool")
+	if ethtool != nil {
+		ethtool = fmt.Errorf("%v, only the generic counters from sysfs are checked", ethtool)
+	}
+	save := error(nil)
+	if file, err := os.OpenFile(configFilePath, os.O_WRONLY, 0); err != nil {
+		save = err
+	} else {
+		file.Close()
+	}
+
+	return []capability{
+		{"saving state", "writable config file", true, save},
+		{"downtime reconciliation", "/proc/uptime or sysinfo", config.Collector.Type == "", uptime},
+		{"port accounting", "nft", config.PortAccounting.Enabled, command("nft")},
+		{"ladder limit", "tc", rung(rungLimit), command("tc")},
+		{"ladder block", "nft", rung(rungBlock), command("nft")},
+		{"shutdown", "shutdown or poweroff", true, shutdown},
+		{"NIC error counters", "ethtool", config.NicHealth.Enabled, ethtool},
+		{"clock check", "adjtimex", config.Clock.Enabled, clock},
+	}
+}
+
+// Log the matrix of optional features, with a warning for each configured one that
+// this system can't provide
+func logCapabilities(config *Config, configFilePath string) {
+	capabilities := probeCapabilities(config, configFilePath)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Capabilities:\n  %-24s %-22s %-11s %s\n", "FEATURE", "NEEDS", "CONFIGURED", "AVAILABLE")
+	for _, c := range capabilities {
+		configured, available := "no", "yes"
+		if c.used {
+			configured = "yes"
+		}
+		if c.err != nil {
+			available = "no: " + c.err.Error()
+		}
+		fmt.Fprintf(&b, "  %-24s %-22s %-11s %s\n", c.feature, c.needs, configured, available)
+	}
+	logf("%s", b.String())
+	for _, c := range capabilities {
+		if c.used && c.err != nil {
+			logf("Warning: %s is configured but not available: %v\n", c.feature, c.err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// How the event kinds are drawn on the dashboard chart
+var eventStyles = map[string]struct{ label, color string }{
+	eventAlert:       {"提醒", "#ff7f0e"},
+	eventEnforcement: {"超限处理", "#d62728"},
+	eventReset:       {"周期重置", "#2ca02c"},
+	eventAnnotation:  {"备注", "#1f77b4"},
+	eventPause:       {"暂停统计", "#7f7f7f"},
+	eventSuspend:     {"系统休眠", "#9467bd"},
+	eventClock:       {"时钟跳变", "#8c564b"},
+	eventFailover:    {"备用线路", "#17becf"},
+	eventTopup:       {"充值", "#bcbd22"},
+	eventDowntime:    {"监控停止", "#e377c2"},
+	eventOutlier:     {"异常读数", "#aec7e8"},
+}
+
+// The longest range the chart is drawn for
+const maxChartDays = 366
+
+// Kinds in the order of the chart legend
+var eventKinds = []string{eventAlert, eventEnforcement, eventReset, eventAnnotation, eventPause, eventSuspend, eventClock, eventFailover, eventTopup, eventDowntime, eventOutlier}
+
+// Render the daily usage from start to the day of last as a bar chart, with the events
+// as markers: a line for a point in time, a shaded band for a time range. The focus
+// day's bar is outlined.
+func usageChartSVG(config *Config, start, last time.Time, focus string) string {
+	const width, height, left, top, bottom = 720, 260, 50, 20, 30
+	end := time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, time.Local)
+	dayCount := 0
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		dayCount++
+	}
+	dayCount = max(dayCount, 1)
+
+	usage := make(map[string]DayUsage)
+	var peak uint64
+	for _, day := range config.History.Days {
+		usage[day.Date] = day
+		if date, err := time.ParseInLocation("2006-01-02", day.Date, time.Local); err == nil && !date.Before(start) && date.Before(end) {
+			peak = max(peak, day.Receive+day.Transmit)
+		}
+	}
+	peakGB := max(float64(peak)/bytesToGB, 0.01)
+
+	plotWidth, plotHeight := float64(width-left-10), float64(height-top-bottom)
+	barWidth := plotWidth / float64(dayCount)
+	// The x position of a time, days may be 23 or 25 hours long across DST
+	xOf := func(t time.Time) float64 {
+		day := 0
+		for d := start; !d.AddDate(0, 0, 1).After(t) && day < dayCount; d = d.AddDate(0, 0, 1) {
+			day++
+		}
+		dayStart := start.AddDate(0, 0, day)
+		fraction := t.Sub(dayStart).Hours() / dayStart.AddDate(0, 0, 1).Sub(dayStart).Hours()
+		return float64(left) + (float64(day)+min(max(fraction, 0), 1))*barWidth
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="4" y="%d">%.2f GB</text>`+"\n", top+4, peakGB)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`+"\n", left, height-bottom, width-10, height-bottom)
+
+	i := 0
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		x := float64(left) + float64(i)*barWidth
+		receive := float64(usage[date].Receive) / bytesToGB
+		transmit := float64(usage[date].Transmit) / bytesToGB
+		receiveHeight := receive / peakGB * plotHeight
+		transmitHeight := transmit / peakGB * plotHeight
+		y := float64(height - bottom)
+		fmt.Fprintf(&b, `<g><title>%s：下载%.2f GB，上传%.2f GB</title>`, date, receive, transmit)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#4c78a8"/>`, x+1, y-receiveHeight, barWidth-2, receiveHeight)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="#9ecae9"/>`, x+1, y-receiveHeight-transmitHeight, barWidth-2, transmitHeight)
+		if date == focus {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="none" stroke="#d62728" stroke-width="2"/>`,
+				x, y-receiveHeight-transmitHeight-1, barWidth, receiveHeight+transmitHeight+1)
+		}
+		b.WriteString("</g>\n")
+		if i%max(dayCount/10, 1) == 0 {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d">%s</text>`+"\n", x+1, height-bottom+14, day.Format("01-02"))
+		}
+		i++
+	}
+
+	for _, event := range config.History.Events {
+		style, ok := eventStyles[event.Kind]
+		if !ok {
+			continue
+		}
+		eventStart, err := time.Parse(time.RFC3339, event.Time)
+		if err != nil || eventStart.Before(start) || !eventStart.Before(end) {
+			continue
+		}
+		title := html.EscapeString(fmt.Sprintf("%s %s：%s", formatEventTime(event), style.label, event.Detail))
+		x := xOf(eventStart.Local())
+		if eventEnd, err := time.Parse(time.RFC3339, event.End); err == nil {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%.0f" fill="%s" fill-opacity="0.2"><title>%s</title></rect>`+"\n",
+				x, top, max(xOf(eventEnd.Local())-x, 2), plotHeight, style.color, title)
+			continue
+		}
+		fmt.Fprintf(&b, `<g><title>%s</title><line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="%s" stroke-width="2" stroke-dasharray="4 2"/>`,
+			title, x, top, x, height-bottom, style.color)
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%d" r="5" fill="%s"/></g>`+"\n", x, top, style.color)
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Longest message each service accepts, in characters; services not listed take any length
+var messageLimits = map[string]int{
+	"telegram":   4096,
+	"discord":    2000,
+	"slack":      40000,
+	"ntfy":       4096,
+	"pushover":   1024,
+	"serverchan": 32000,
+	"dingtalk":   5000,
+	"wecom":      600, // 2048 bytes, most of the text is Chinese
+	"feishu":     4000,
+	"teams":      20000,
+}
+
+const (
+	maxMessageParts = 5                    // longer messages are cut after this many parts
+	partMarkerSpace = 16                   // room for the "(2/5) " marker and the device prefix's brackets
+	truncatedMarker = "\n……（消息过长，后续内容已省略）" // ends the last part of a cut message
+)
+
+// The message length of a service, max_length overrides the default
+func messageLimit(config *Config, service string) int {
+	if config.Message.MaxLength > 0 {
+		return config.Message.MaxLength
+	}
+	return messageLimits[service]
+}
+
+// Split a message into parts of at most limit characters, at line breaks where possible.
+// Parts beyond maxMessageParts are dropped and the last part says so.
+func splitMessage(message string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(message) <= limit {
+		return []string{message}
+	}
+
+	var parts []string
+	var part strings.Builder
+	length := 0
+	flush := func() {
+		if text := strings.Trim(part.String(), "\n"); text != "" {
+			parts = append(parts, text)
+		}
+		part.Reset()
+		length = 0
+	}
+	for _, line := range strings.SplitAfter(message, "\n") {
+		lineLength := utf8.RuneCountInString(line)
+		if length+lineLength > limit {
+			flush()
+		}
+		// A single line longer than a part is cut at the limit
+		for lineLength > limit {
+			runes := []rune(line)
+			parts = append(parts, string(runes[:limit]))
+			line = string(runes[limit:])
+			lineLength -= limit
+		}
+		part.WriteString(line)
+		length += lineLength
+	}
+	flush()
+
+	if len(parts) > maxMessageParts {
+		parts = parts[:maxMessageParts]
+		last := []rune(parts[maxMessageParts-1])
+		keep := max(min(len(last), limit-utf8.RuneCountInString(tr(truncatedMarker))), 0)
+		parts[maxMessageParts-1] = string(last[:keep]) + tr(truncatedMarker)
+	}
+	return parts
+}
+
+// Send a warning that must not wait: an email digest doesn't hold it back and the
+// services with priorities send it with their highest
+func sendUrgentMessage(config *Config, services []string, message string) ([]string, error) {
+	urgent := *config
+	urgent.urgent = true
+	return sendMessageTo(&urgent, services, message)
+}
+
+// The services messages go to: service first, then the ones in services that aren't
+// already in the list
+func (m Message) services() []string {
+	var services []string
+	if m.Service != "" || len(m.Services) == 0 {
+		services = append(services, m.Service)
+	}
+	for _, service := range m.Services {
+		if !slices.Contains(services, service) {
+			services = append(services, service)
+		}
+	}
+	return services
+}
+
+// Send a message to every enabled service, the services that don't get it have it
+// queued. It counts as sent once one service got it, so a broken service doesn't make
+// the callers send it again to the working ones.
+func sendMessage(config *Config, message string) error {
+	return sendQueuedMessage(config, config.Message.services(), message)
+}
+
+// Send a message to the given services and return the ones that got it. The error is
+// only set when none did, the failures next to a delivery are logged instead.
+func sendMessageTo(config *Config, services []string, message string) ([]string, error) {
+	var sent []string
+	var errs []error
+	for _, service := range services {
+		err := sendServiceMessage(config, service, message)
+		if err == nil {
+			sent = append(sent, service)
+			continue
+		}
+		if len(services) > 1 {
+			err = fmt.Errorf("%s: %v", service, err)
+		}
+		errs = append(errs, err)
+	}
+	if len(sent) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		logf("Message not delivered to %v\n", err)
+	}
+	return sent, nil
+}
+
+// The outcome of a test message to one service
+type testResult struct {
+	service string
+	err     error
+}
+
+// Send a test message to every service some message goes to, each on its own so the
+// result tells which credentials are wrong
+func sendTestMessages(config *Config) []testResult {
+	// The email digest would hold the test back until its hour
+	test := *config
+	test.Message.Email.Digest = false
+	var results []testResult
+	for _, service := range config.Message.allServices() {
+		err := sendMessagePart(&test, service, tr("测试消息：消息服务配置正确"))
+		results = append(results, testResult{service, err})
+	}
+	return results
+}
+
+// Send a message to one service in as many parts as its length limit requires, each
+// part marked like "(2/3)" so the recipient can tell they belong together
+func sendServiceMessage(config *Config, service, message string) error {
+	if err := takeBurst(config, time.Now()); err != nil {
+		return err
+	}
+	limit := messageLimit(config, service)
+	if limit > 0 {
+		limit = max(limit-utf8.RuneCountInString(config.Device)-partMarkerSpace, 1)
+	}
+	parts := splitMessage(message, limit)
+	for i, part := range parts {
+		if len(parts) > 1 {
+			part = fmt.Sprintf("(%d/%d) %s", i+1, len(parts), part)
+		}
+		if err := sendPartWithRetry(config, service, part); err != nil {
+			if len(parts) > 1 {
+				return fmt.Errorf("part %d of %d: %v", i+1, len(parts), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
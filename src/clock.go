@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// How often the wait between samples checks for a suspend
+	suspendCheckStep = 10 * time.Second
+	// Minimum time spent suspended before the gap is treated as a suspend
+	suspendThreshold = 30 * time.Second
+)
+
+// Time the system spent suspended before the sample being taken, zero for a regular one
+var resumeGap time.Duration
+
+// Read the time since boot including suspend (CLOCK_BOOTTIME) from /proc/uptime, or
+// from sysinfo where /proc isn't readable
+func readUptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		if uptime, sysErr := sysinfoUptime(); sysErr == nil {
+			return uptime, nil
+		}
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/uptime format")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Wait for the next interval in short steps and return early when the system was suspended
+// or wake reports pending work. Go's monotonic clock stops during suspend while the boot
+// clock keeps running, the difference between the two is the time spent suspended.
+func waitInterval(interval time.Duration, wake func() bool) time.Duration {
+	deadline := time.Now().Add(interval)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 || wake() {
+			return 0
+		}
+
+		before := time.Now()
+		uptimeBefore, err := readUptime()
+		time.Sleep(min(remaining, suspendCheckStep))
+		if err != nil {
+			continue
+		}
+		uptimeAfter, err := readUptime()
+		if err != nil {
+			continue
+		}
+
+		suspended := (uptimeAfter - uptimeBefore) - time.Since(before)
+		if suspended > suspendThreshold {
+			return suspended
+		}
+	}
+}
+
+const defaultMaxClockCorrection = 60 // 秒
+
+type ClockCheck struct {
+	Enabled       bool `json:"enabled"`        // 是否检查系统时钟
+	MaxCorrection int  `json:"max_correction"` // 两次采样间允许的时钟跳变，单位为秒，默认60
+	DeferReset    bool `json:"defer_reset"`    // 时钟未同步时推迟流量重置
+}
+
+// Reference points of the previous clock check, kept in memory only
+var (
+	clockLastWall   time.Time
+	clockLastUptime time.Duration
+	clockUnsynced   bool
+)
+
+// Compare the wall clock with the boot clock to detect clock corrections, and check the
+// kernel's synchronization state. Returns false while the clock can't be trusted for resets.
+func checkClock(config *Config) bool {
+	now := time.Now().Round(0) // strip the monotonic reading to compare wall clock time
+	uptime, err := readUptime()
+	if err == nil && !clockLastWall.IsZero() {
+		maxCorrection := config.Clock.MaxCorrection
+		if maxCorrection <= 0 {
+			maxCorrection = defaultMaxClockCorrection
+		}
+
+		// The boot clock keeps running during suspend, so only a real clock change is left
+		correction := now.Sub(clockLastWall) - (uptime - clockLastUptime)
+		if correction.Abs() > time.Duration(maxCorrection)*time.Second {
+			addEvent(config, eventClock, now, time.Time{}, fmt.Sprintf(tr("系统时钟跳变%s"), correction.Round(time.Second)))
+			sendHealthEvent(config, fmt.Sprintf(tr("系统时钟跳变了%s，流量重置时间可能受到影响"), correction.Round(time.Second)))
+		}
+	}
+	if err == nil {
+		clockLastWall = now
+		clockLastUptime = uptime
+	}
+
+	synced, err := clockSynchronized()
+	if err != nil {
+		// Unknown state, don't hold back resets
+		return true
+	}
+	if !synced && !clockUnsynced {
+		sendHealthEvent(config, tr("系统时钟未同步，请检查NTP服务，按日期重置流量可能不准确"))
+	} else if synced && clockUnsynced {
+		sendHealthEvent(config, tr("系统时钟已恢复同步"))
+	}
+	clockUnsynced = !synced
+	return synced
+}
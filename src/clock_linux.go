@@ -0,0 +1,30 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	timeError = 5    // adjtimex返回TIME_ERROR表示时钟未同步
+	staUnsync = 0x40 // STA_UNSYNC
+)
+
+// Ask the kernel whether the system clock is synchronized (e.g. by NTP or chrony)
+func clockSynchronized() (bool, error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return false, err
+	}
+	return state != timeError && tx.Status&staUnsync == 0, nil
+}
+
+// The time since boot from sysinfo, which counts the same clock in whole seconds
+func sysinfoUptime() (time.Duration, error) {
+	var info syscall.Sysinfo_t
+	if err := syscall.Sysinfo(&info); err != nil {
+		return 0, err
+	}
+	return time.Duration(info.Uptime) * time.Second, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// Clock synchronization state is only available through adjtimex on Linux
+func clockSynchronized() (bool, error) {
+	return false, errors.New("clock synchronization check not supported on this system")
+}
+
+func sysinfoUptime() (time.Duration, error) {
+	return 0, errors.New("sysinfo not supported on this system")
+}
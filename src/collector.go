@@ -0,0 +1,59 @@
+package main
+
+import "fmt"
+
+// Collector types, an empty type accounts the local interfaces
+const (
+	collectorFlow   = "flow"   // NetFlow v5/v9、IPFIX和sFlow
+	collectorUpnp   = "upnp"   // 通过UPnP IGD读取路由器WAN口计数器
+	collectorHuawei = "huawei" // 华为LTE/5G路由器的HiLink接口
+	collectorZte    = "zte"    // 中兴LTE/5G路由器的goform接口
+)
+
+type CollectorConfig struct {
+	Type         string `json:"type"`          // 流量来源，为空时统计本机网卡
+	Listen       string `json:"listen"`        // 监听地址，例如":2055"
+	WanIfIndex   uint32 `json:"wan_if_index"`  // 路由器上WAN口的接口编号（ifIndex），用于区分上传和下载
+	SamplingRate uint32 `json:"sampling_rate"` // NetFlow v9/IPFIX的采样率，默认1即不采样
+	URL          string `json:"url"`           // 路由器的UPnP设备描述地址，为空时自动发现；或LTE路由器的管理地址
+	Username     string `json:"username"`      // LTE路由器的登录用户名
+	Password     string `json:"password"`      // LTE路由器的登录密码
+}
+
+// A traffic source other than the local interfaces. It returns cumulative counters
+// keyed by source, which are accounted exactly like interface counters.
+type collector interface {
+	counters() (map[string]NetStats, error)
+}
+
+// Check the collector settings
+func validateCollector(config *CollectorConfig) error {
+	switch config.Type {
+	case "":
+	case collectorFlow:
+		if config.Listen == "" {
+			return fmt.Errorf("collector listen address is required")
+		}
+		if config.WanIfIndex == 0 {
+			return fmt.Errorf("collector wan_if_index is required to tell upload from download")
+		}
+	case collectorUpnp:
+	case collectorHuawei, collectorZte:
+		if config.URL == "" {
+			return fmt.Errorf("collector url of the router is required")
+		}
+	default:
+		return fmt.Errorf("unknown collector type: %s", config.Type)
+	}
+	return nil
+}
+
+// Account the collector's counters like interface counters
+func updateFromCollector(config *Config, coll collector) error {
+	counters, err := coll.counters()
+	if err != nil {
+		return err
+	}
+	accountCounters(config, counters)
+	return nil
+}
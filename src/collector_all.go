@@ -0,0 +1,21 @@
+//go:build !nocollector
+
+package main
+
+import "fmt"
+
+// Start the configured collector
+func startCollector(config *CollectorConfig) (collector, error) {
+	switch config.Type {
+	case collectorFlow:
+		return startFlowCollector(config)
+	case collectorUpnp:
+		return startUpnpCollector(config)
+	case collectorHuawei:
+		return startHuaweiCollector(config)
+	case collectorZte:
+		return startZteCollector(config)
+	default:
+		return nil, fmt.Errorf("unknown collector type: %s", config.Type)
+	}
+}
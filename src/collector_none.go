@@ -0,0 +1,10 @@
+//go:build nocollector
+
+package main
+
+import "fmt"
+
+// Built with -tags nocollector for a minimal binary, only the local interfaces are accounted
+func startCollector(config *CollectorConfig) (collector, error) {
+	return nil, fmt.Errorf("collector %s is not available, this build excludes collectors (nocollector)", config.Type)
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultConfigPath = "/opt/NetMonitor/config.json"
+
+// Actions queued by the command line for the running monitor
+const (
+	actionPause    = "pause"
+	actionResume   = "resume"
+	actionAnnotate = "annotate"
+	actionInject   = "inject"
+	actionReset    = "reset"
+	actionEvaluate = "evaluate"
+)
+
+// A control command queued by the CLI and applied by the monitor at its next sample
+type Command struct {
+	Action string `json:"action"`
+	Time   string `json:"time"`             // 提交时间，RFC3339格式
+	From   string `json:"from,omitempty"`   // 备注的开始时间
+	Until  string `json:"until,omitempty"`  // 暂停或备注的截止时间，为空表示直到手动恢复
+	Reason string `json:"reason,omitempty"` // 原因说明或备注内容
+	By     string `json:"by,omitempty"`     // 提交命令的用户，例如"cli:root"、"http:amy"
+
+	// 注入的测试流量，只在调试模式下生效
+	Receive  uint64 `json:"receive,omitempty"`
+	Transmit uint64 `json:"transmit,omitempty"`
+	Wan      string `json:"wan,omitempty"`
+
+	// 预付费充值的流量
+	Bytes uint64 `json:"bytes,omitempty"`
+}
+
+// The queue lives next to the config file, the monitor owns the config file itself
+func commandQueuePath(configFilePath string) string {
+	return configFilePath + ".cmd"
+}
+
+// Append a command to the queue of the running monitor
+func queueCommand(configFilePath string, command Command) error {
+	command.Time = time.Now().Format(time.RFC3339)
+	if command.By == "" {
+		command.By = cliPrincipal()
+	}
+	data, err := json.Marshal(command)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(commandQueuePath(configFilePath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Check whether commands are waiting to be applied
+func commandsPending(configFilePath string) bool {
+	info, err := os.Stat(commandQueuePath(configFilePath))
+	return err == nil && info.Size() > 0
+}
+
+// Take all queued commands, the queue is moved away first so new commands can't be lost
+func takeCommands(configFilePath string) ([]Command, error) {
+	queuePath := commandQueuePath(configFilePath)
+	processingPath := queuePath + ".processing"
+	if err := os.Rename(queuePath, processingPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer os.Remove(processingPath)
+
+	file, err := os.Open(processingPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var commands []Command
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var command Command
+		if err := json.Unmarshal(scanner.Bytes(), &command); err != nil {
+			logf("Ignored malformed command %q: %v\n", scanner.Text(), err)
+			continue
+		}
+		if lowMemory && len(commands) >= lowMemoryCommands {
+			logf("Ignored queued command %s, at most %d commands are taken per sample in low memory mode\n", command.Action, lowMemoryCommands)
+			continue
+		}
+		commands = append(commands, command)
+	}
+	return commands, scanner.Err()
+}
+
+// Apply the queued commands to the running monitor's state
+func applyCommands(config *Config, configFilePath string) {
+	commands, err := takeCommands(configFilePath)
+	if err != nil {
+		logf("Failed to read queued commands: %v\n", err)
+		return
+	}
+
+	for _, command := range commands {
+		writeAudit(configFilePath, command)
+		notifyControl(config, command)
+		switch command.Action {
+		case actionPause:
+			pauseAccounting(config, command)
+		case actionResume:
+			resumeAccounting(config, time.Now())
+		case actionAnnotate:
+			annotate(config, command)
+		case actionInject:
+			injectTraffic(config, command)
+		case actionShare:
+			setShareToken(config, command)
+		case actionTopup:
+			topUp(config, command)
+		case actionEvaluate:
+			// Queuing it already woke the monitor, the limits are checked right after the commands
+			logf("Evaluation requested by %s\n", command.By)
+		case actionCancelShutdown:
+			cancelShutdown(config, command)
+		case actionReset:
+			logf("Statistics reset requested by %s: %s\n", command.By, command.Reason)
+			resetStatistics(config, configFilePath)
+		default:
+			logf("Ignored unknown command: %s\n", command.Action)
+		}
+	}
+}
+
+// Run a subcommand such as `netmonitor pause`, returns the exit code
+func runCommand(name string, args []string) int {
+	switch name {
+	case "pause":
+		return runPauseCommand(args)
+	case "resume":
+		return runResumeCommand(args)
+	case "annotate":
+		return runAnnotateCommand(args)
+	case "config":
+		return runConfigCommand(args)
+	case "inject":
+		return runInjectCommand(args)
+	case "heatmap":
+		return runHeatmapCommand(args)
+	case "share":
+		return runShareCommand(args)
+	case "topup":
+		return runTopupCommand(args)
+	case "shutdown":
+		return runShutdownCommand(args)
+	case "provision":
+		return runProvisionCommand(args)
+	case "version":
+		fmt.Println(versionString())
+		return exitOK
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", name)
+		fmt.Fprintf(os.Stderr, "usage: netmonitor [-c config.json] | netmonitor <pause|resume|annotate|inject|heatmap|share|topup|shutdown|config|provision|version> [options]\n")
+		return exitUsage
+	}
+}
+
+// netmonitor pause --for 2h --reason "migration rsync"
+func runPauseCommand(args []string) int {
+	flags := flag.NewFlagSet("pause", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	duration := flags.Duration("for", 0, "How long to pause accounting, e.g. 2h (default: until resumed)")
+	reason := flags.String("reason", "", "Why accounting is paused, recorded in the history")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *duration < 0 {
+		fmt.Fprintf(os.Stderr, "invalid pause duration: %s\n", *duration)
+		return exitUsage
+	}
+
+	command := Command{Action: actionPause, Reason: *reason}
+	if *duration > 0 {
+		command.Until = time.Now().Add(*duration).Format(time.RFC3339)
+	}
+	if err := queueCommand(*configFilePath, command); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue pause: %v\n", err)
+		return exitFailure
+	}
+
+	if command.Until != "" {
+		fmt.Printf("Accounting will be paused until %s\n", command.Until)
+	} else {
+		fmt.Println("Accounting will be paused until `netmonitor resume`")
+	}
+	return exitOK
+}
+
+// netmonitor resume
+func runResumeCommand(args []string) int {
+	flags := flag.NewFlagSet("resume", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if err := queueCommand(*configFilePath, Command{Action: actionResume}); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue resume: %v\n", err)
+		return exitFailure
+	}
+	fmt.Println("Accounting will be resumed")
+	return exitOK
+}
+
+// Parse a time given on the command line, either RFC3339 or local "2006-01-02 15:04" / "2006-01-02"
+func parseTimeFlag(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC3339 or \"2006-01-02 15:04\"", value)
+}
+
+// netmonitor annotate --from "2024-09-01 02:00" --to "2024-09-01 06:00" "OS reinstall"
+func runAnnotateCommand(args []string) int {
+	flags := flag.NewFlagSet("annotate", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	from := flags.String("from", "", "Start of the annotated time range (default: now)")
+	to := flags.String("to", "", "End of the annotated time range (default: a single point in time)")
+	duration := flags.Duration("for", 0, "Length of the annotated time range, instead of --to")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: netmonitor annotate [--from time] [--to time | --for duration] <label>")
+		return exitUsage
+	}
+
+	start := time.Now()
+	if *from != "" {
+		t, err := parseTimeFlag(*from)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		start = t
+	}
+	var end time.Time
+	if *to != "" {
+		t, err := parseTimeFlag(*to)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitUsage
+		}
+		end = t
+	} else if *duration > 0 {
+		end = start.Add(*duration)
+	}
+	if !end.IsZero() && end.Before(start) {
+		fmt.Fprintln(os.Stderr, "the end of the annotation is before its start")
+		return exitUsage
+	}
+
+	command := Command{Action: actionAnnotate, From: start.Format(time.RFC3339), Reason: flags.Arg(0)}
+	if !end.IsZero() {
+		command.Until = end.Format(time.RFC3339)
+	}
+	if err := queueCommand(*configFilePath, command); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue annotation: %v\n", err)
+		return exitFailure
+	}
+	fmt.Println("Annotation added")
+	return exitOK
+}
+
+// netmonitor config validate
+func runConfigCommand(args []string) int {
+	if len(args) > 0 && args[0] == "keygen" {
+		return runConfigKeygen(args[1:])
+	}
+	if len(args) > 0 && args[0] == "sign" {
+		return runConfigSign(args[1:])
+	}
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: netmonitor config validate [-c config.json] [--strict] | netmonitor config keygen | netmonitor config sign <file>...")
+		return exitUsage
+	}
+	flags := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	count := flags.Int("resets", 12, "Number of upcoming reset dates to print")
+	strict := flags.Bool("strict", false, "Fail on config keys that no setting reads, instead of warning")
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadConfig(*configFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return loadErrorCode(err)
+	}
+	if err := validateConfig(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return exitConfig
+	}
+	if err := validateStatistics(&config.Statistics); err != nil {
+		fmt.Fprintf(os.Stderr, "corrupt statistics: %v\n", err)
+		return exitStateCorrupt
+	}
+	// A misspelled key silently leaves its setting at zero
+	unknown, err := unknownConfigKeys(*configFilePath)
+	if err == nil && len(unknown) > 0 {
+		for _, key := range unknown {
+			fmt.Fprintf(os.Stderr, "unknown config key: %s\n", key)
+		}
+		if *strict {
+			return exitConfig
+		}
+	}
+	applyTimezone(&config)
+	applyUnit(&config)
+	applyLanguage(&config)
+
+	fmt.Printf("Config OK: %s\n", *configFilePath)
+	if config.BillingCalendar != "" {
+		if err := loadCalendar(config.BillingCalendar, time.Now()); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid billing calendar: %v\n", err)
+			return exitConfig
+		}
+		resets := calendarResets(time.Now(), *count)
+		fmt.Printf("Next %d resets (billing calendar %s, timezone %s):\n", len(resets), config.BillingCalendar, time.Local)
+		for _, reset := range resets {
+			fmt.Printf("  %s\n", reset.Format("2006-01-02 15:04 MST (-0700) Mon"))
+		}
+		if len(resets) < *count {
+			fmt.Printf("  no further periods in the calendar, the statistics won't be reset after the last one\n")
+		}
+		return exitOK
+	}
+	if config.Prepaid {
+		fmt.Printf("Prepaid balance, the statistics are never reset\n")
+		return exitOK
+	}
+	fmt.Printf("Next %d resets (start_day %d, timezone %s):\n", *count, config.StartDay, time.Local)
+	for _, reset := range upcomingResets(time.Now(), config.StartDay, *count) {
+		fmt.Printf("  %s\n", reset)
+	}
+	return exitOK
+}
+
+// Describe the next reset datetimes, pointing out clamped days and DST offset changes
+func upcomingResets(now time.Time, startDay, count int) []string {
+	if startDay < 1 {
+		return nil
+	}
+	var lines []string
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	_, lastOffset := now.Zone()
+	for len(lines) < count {
+		reset := resetDateOf(month, startDay)
+		lastDay := time.Date(month.Year(), month.Month()+1, 0, 12, 0, 0, 0, time.Local).Day()
+		month = month.AddDate(0, 1, 0)
+		// A reset is applied at the first sample after its date
+		if !reset.After(now) {
+			continue
+		}
+
+		line := reset.Format("2006-01-02 15:04 MST (-0700) Mon")
+		var notes []string
+		if startDay > lastDay {
+			notes = append(notes, fmt.Sprintf("start_day %d clamped to the last day of the month", startDay))
+		}
+		if reset.Hour() != 0 || reset.Minute() != 0 {
+			notes = append(notes, "midnight is skipped by DST on this day, the reset time shifts")
+		}
+		if _, offset := reset.Zone(); offset != lastOffset {
+			notes = append(notes, "UTC offset changed since the previous reset (DST)")
+			lastOffset = offset
+		}
+		if len(notes) > 0 {
+			line += "  " + strings.Join(notes, "; ")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// A JSON value that remembers the order of its object keys
+type jsonNode struct {
+	keys   []string // 对象的键，按文件中的顺序
+	fields map[string]*jsonNode
+	items  []*jsonNode // 数组的元素
+	kind   byte        // '{'、'['，其他值为0
+	raw    json.RawMessage
+}
+
+// Parse a JSON document keeping the key order
+func parseJSONNode(data []byte) (*jsonNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	node, err := decodeJSONNode(decoder, data)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the JSON value")
+	}
+	return node, nil
+}
+
+// Read one value from the decoder in a single pass, scalars keep their text from data
+func decodeJSONNode(decoder *json.Decoder, data []byte) (*jsonNode, error) {
+	before := decoder.InputOffset()
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		// The offset before the token may still include the separator in front of it
+		raw := bytes.TrimLeft(data[before:decoder.InputOffset()], " \t\r\n,:")
+		return &jsonNode{raw: raw}, nil
+	}
+
+	node := &jsonNode{kind: byte(delim)}
+	if delim == '{' {
+		node.fields = make(map[string]*jsonNode)
+	}
+	for decoder.More() {
+		key := ""
+		if delim == '{' {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key = token.(string)
+		}
+		child, err := decodeJSONNode(decoder, data)
+		if err != nil {
+			return nil, err
+		}
+		if delim == '[' {
+			node.items = append(node.items, child)
+		} else if _, seen := node.fields[key]; !seen {
+			node.keys = append(node.keys, key)
+			node.fields[key] = child
+		}
+	}
+	// The closing delimiter
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// Write the value without whitespace, it is indented afterwards
+func (node *jsonNode) encode(b *bytes.Buffer) {
+	switch node.kind {
+	case '{':
+		b.WriteByte('{')
+		for i, key := range node.keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			name, _ := json.Marshal(key)
+			b.Write(name)
+			b.WriteByte(':')
+			node.fields[key].encode(b)
+		}
+		b.WriteByte('}')
+	case '[':
+		b.WriteByte('[')
+		for i, item := range node.items {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			item.encode(b)
+		}
+		b.WriteByte(']')
+	default:
+		json.Compact(b, node.raw)
+	}
+}
+
+// The JSON keys of a struct type and the types of their values
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// Merge the encoded config into the file's document. Keys the config knows take the
+// new value, or are dropped when the config omits them; keys it doesn't know are kept
+// where they were, new keys go after them.
+func mergeJSONNode(old, updated *jsonNode, t reflect.Type) *jsonNode {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && old.kind == '{' && updated.kind == '{':
+		known := jsonFields(t)
+		merged := &jsonNode{kind: '{', fields: make(map[string]*jsonNode)}
+		for _, key := range old.keys {
+			fieldType, isKnown := known[key]
+			switch {
+			case !isKnown:
+				merged.keys = append(merged.keys, key)
+				merged.fields[key] = old.fields[key]
+			case updated.fields[key] != nil:
+				merged.keys = append(merged.keys, key)
+				merged.fields[key] = mergeJSONNode(old.fields[key], updated.fields[key], fieldType)
+			}
+		}
+		for _, key := range updated.keys {
+			if _, done := merged.fields[key]; !done {
+				merged.keys = append(merged.keys, key)
+				merged.fields[key] = updated.fields[key]
+			}
+		}
+		return merged
+	case t.Kind() == reflect.Slice && old.kind == '[' && updated.kind == '[':
+		merged := &jsonNode{kind: '['}
+		for i, item := range updated.items {
+			if i < len(old.items) {
+				item = mergeJSONNode(old.items[i], item, t.Elem())
+			}
+			merged.items = append(merged.items, item)
+		}
+		return merged
+	}
+	return updated
+}
+
+// Lay the encoded config over the current file, so the keys the user added or
+// ordered by hand survive the rewrite. The output is indented like the encoder's
+// and stable: merging it again gives the same bytes.
+func preserveConfigLayout(existing, data []byte) ([]byte, error) {
+	old, err := parseJSONNode(existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse existing config: %v", err)
+	}
+	_, merged, err := mergeConfigLayout(old, data)
+	return merged, err
+}
+
+// Merge the encoded config into the parsed file, the merged document is returned with
+// its bytes so the next save can start from it without parsing the file again
+func mergeConfigLayout(old *jsonNode, data []byte) (*jsonNode, []byte, error) {
+	updated, err := parseJSONNode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var compact, indented bytes.Buffer
+	merged := mergeJSONNode(old, updated, reflect.TypeOf(Config{}))
+	merged.encode(&compact)
+	if err := json.Indent(&indented, compact.Bytes(), "", "  "); err != nil {
+		return nil, nil, err
+	}
+	indented.WriteByte('\n')
+	return merged, indented.Bytes(), nil
+}
+
+// Keys in the config file and its include files that no setting reads, e.g. a misspelled
+// "thresold" that leaves threshold at zero. Keys starting with "_" are comments and never
+// reported.
+func unknownConfigKeys(configFilePath string) ([]string, error) {
+	data, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseJSONNode(data)
+	if err != nil {
+		return nil, err
+	}
+	var unknown []string
+	findUnknownKeys(root, reflect.TypeOf(Config{}), "", &unknown)
+	if included := configIncludes[configFilePath]; included != nil {
+		findUnknownKeys(included, reflect.TypeOf(Config{}), "", &unknown)
+	}
+	return unknown, nil
+}
+
+func findUnknownKeys(node *jsonNode, t reflect.Type, path string, unknown *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t.Kind() == reflect.Struct && node.kind == '{':
+		known := jsonFields(t)
+		for _, key := range node.keys {
+			fieldType, ok := known[key]
+			if ok {
+				findUnknownKeys(node.fields[key], fieldType, path+key+".", unknown)
+				continue
+			}
+			if strings.HasPrefix(key, "_") {
+				continue
+			}
+			entry := path + key
+			if suggestion := closestKey(key, known); suggestion != "" {
+				entry += fmt.Sprintf(" (did you mean %s%s?)", path, suggestion)
+			}
+			*unknown = append(*unknown, entry)
+		}
+	case t.Kind() == reflect.Slice && node.kind == '[':
+		for i, item := range node.items {
+			findUnknownKeys(item, t.Elem(), fmt.Sprintf("%s%d.", path, i), unknown)
+		}
+	case t.Kind() == reflect.Map && node.kind == '{':
+		for _, key := range node.keys {
+			findUnknownKeys(node.fields[key], t.Elem(), path+key+".", unknown)
+		}
+	}
+}
+
+// The known key within two edits of a misspelled one
+func closestKey(key string, known map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range known {
+		if distance := editDistance(key, name); distance < bestDistance || distance == bestDistance && name < best {
+			best, bestDistance = name, distance
+		}
+	}
+	return best
+}
+
+// Levenshtein distance of two keys
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
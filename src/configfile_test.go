@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONNodeKeepsScalars(t *testing.T) {
+	node, err := parseJSONNode([]byte(`{"b": 1e3, "a": ["x\"y", -0.5, true, null], "c": {"d": "é"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	node.encode(&b)
+	if want := `{"b":1e3,"a":["x\"y",-0.5,true,null],"c":{"d":"é"}}`; b.String() != want {
+		t.Errorf("encoded %s, want %s", b.String(), want)
+	}
+	if _, err := parseJSONNode([]byte(`{"a": 1} {}`)); err == nil {
+		t.Error("trailing data accepted")
+	}
+}
+
+// The layout kept from the last save is only used while the file is unchanged
+func TestSaveConfigKeepsLayout(t *testing.T) {
+	quiet = true
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"_note": "mine", "interface": "eth0"}`), 0644)
+
+	config := Config{Interface: "eth0", StartDay: 1}
+	for i := 0; i < 2; i++ {
+		config.Statistics.TotalReceive = uint64(i)
+		if err := saveConfig(path, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "{\n  \"_note\": \"mine\",\n  \"interface\": \"eth0\",") {
+		t.Errorf("layout lost:\n%s", data)
+	}
+
+	// Edited by hand between two saves
+	edited := strings.Replace(string(data), `"_note": "mine"`, `"_note": "edited", "_added": 1`, 1)
+	os.WriteFile(path, []byte(edited), 0644)
+	config.Statistics.TotalReceive = 2
+	if err := saveConfig(path, config); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if !strings.Contains(string(data), `"_note": "edited"`) || !strings.Contains(string(data), `"_added": 1`) {
+		t.Errorf("hand edit lost:\n%s", data)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "time"
+
+// The calendar is read once a week instead of daily while the monitor saves its traffic
+const conserveCalendarRefresh = 7 * calendarRefresh
+
+// Whether conserving was on at the previous sample, to log when it changes
+var conserveActive bool
+
+// Whether the monitor keeps its own traffic down: the usage passed conserve_at of the
+// limit, or ratio when conserve_at isn't set. The warnings themselves still go out.
+func conserving(config *Config) bool {
+	limit := effectiveLimit(config)
+	if limit <= 0 {
+		return false
+	}
+	at := config.Comparison.ConserveAt
+	if at == 0 {
+		at = config.Comparison.Ratio
+	}
+	if at <= 0 {
+		return false
+	}
+	used := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+	return used >= limit*at
+}
+
+// Log when the monitor starts or stops saving its own traffic, once per change
+func updateConserving(config *Config) {
+	active := conserving(config)
+	if active == conserveActive {
+		return
+	}
+	conserveActive = active
+	if active {
+		logf("Usage passed the conserve threshold, retrying messages hourly without immediate retries and reading the billing calendar weekly\n")
+	} else {
+		logf("Usage is below the conserve threshold again, the monitor's own traffic is back to normal\n")
+	}
+}
+
+// The delay before the next retry of a queued message
+func outboxDelay(attempts int) time.Duration {
+	if conserveActive {
+		return outboxMaxDelay
+	}
+	return min(outboxRetryDelay<<min(attempts, 10), outboxMaxDelay)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// When a period first reached its threshold and ratio, kept to compare the periods
+type PeriodRecord struct {
+	Start            string `json:"start"`                       // 周期开始日期
+	Receive          uint64 `json:"receive,omitempty"`           // 周期的下载流量（字节）
+	Transmit         uint64 `json:"transmit,omitempty"`          // 周期的上传流量（字节）
+	ThresholdReached string `json:"threshold_reached,omitempty"` // 首次达到threshold的时间，未达到时为空
+	RatioReached     string `json:"ratio_reached,omitempty"`     // 首次达到ratio的时间，未达到时为空
+}
+
+// The number of past periods kept
+const maxPeriodRecords = 24
+
+// Stamp the first crossing of the threshold and the ratio, whether or not the alert gets out
+func recordCrossings(config *Config, valueInGB, thresholdLimit, ratioLimit float64, now time.Time) {
+	if valueInGB >= thresholdLimit && config.Statistics.ThresholdReached == "" {
+		config.Statistics.ThresholdReached = now.Format(time.RFC3339)
+	}
+	if valueInGB >= ratioLimit && config.Statistics.RatioReached == "" {
+		config.Statistics.RatioReached = now.Format(time.RFC3339)
+	}
+}
+
+// Keep the ending period's totals and crossings in the history. A reset retried after
+// a failed summary updates the record of its first attempt.
+func archivePeriod(config *Config) {
+	record := PeriodRecord{
+		Start:            lastResetDate(config),
+		Receive:          config.Statistics.TotalReceive,
+		Transmit:         config.Statistics.TotalTransmit,
+		ThresholdReached: config.Statistics.ThresholdReached,
+		RatioReached:     config.Statistics.RatioReached,
+	}
+	if count := len(config.History.Periods); count > 0 && config.Statistics.ResetPending != "" {
+		config.History.Periods[count-1] = record
+		return
+	}
+	config.History.Periods = append(config.History.Periods, record)
+	if len(config.History.Periods) > maxPeriodRecords {
+		config.History.Periods = config.History.Periods[len(config.History.Periods)-maxPeriodRecords:]
+	}
+}
+
+// The day of the period a crossing happened on, the first day is 1
+func dayOfPeriod(start, reached string) (int, time.Time, bool) {
+	startDate, err := time.ParseInLocation("2006-01-02", start, time.Local)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, reached)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	t = t.Local()
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	// Count calendar days, a day across DST isn't 24 hours
+	day := 1
+	for d := startDate; d.Before(date); d = d.AddDate(0, 0, 1) {
+		day++
+	}
+	return day, t, true
+}
+
+// The archived periods before the current one, a pending reset already archived it
+func pastPeriods(config *Config) []PeriodRecord {
+	periods := config.History.Periods
+	if config.Statistics.ResetPending != "" && len(periods) > 0 {
+		periods = periods[:len(periods)-1]
+	}
+	return periods
+}
+
+// One line per limit on when it was reached, compared with the previous period
+func describeCrossings(config *Config) string {
+	var previous *PeriodRecord
+	if periods := pastPeriods(config); len(periods) > 0 {
+		previous = &periods[len(periods)-1]
+	}
+
+	var lines []string
+	describe := func(name, reached, previousReached string) {
+		day, t, ok := dayOfPeriod(lastResetDate(config), reached)
+		var previousDay int
+		var previousOK bool
+		if previous != nil {
+			previousDay, _, previousOK = dayOfPeriod(previous.Start, previousReached)
+		}
+		switch {
+		case !ok && previousOK:
+			lines = append(lines, fmt.Sprintf(tr("%s：本周期未达到，上个周期在第%d天达到"), name, previousDay))
+		case !ok:
+		case previous == nil:
+			lines = append(lines, fmt.Sprintf(tr("%s：%s达到（周期第%d天）"), name, t.Format(tr("01月02日 15:04")), day))
+		case !previousOK:
+			lines = append(lines, fmt.Sprintf(tr("%s：%s达到（周期第%d天），上个周期未达到"), name, t.Format(tr("01月02日 15:04")), day))
+		case day < previousDay:
+			lines = append(lines, fmt.Sprintf(tr("%s：%s达到（周期第%d天），比上个周期早%d天"), name, t.Format(tr("01月02日 15:04")), day, previousDay-day))
+		case day > previousDay:
+			lines = append(lines, fmt.Sprintf(tr("%s：%s达到（周期第%d天），比上个周期晚%d天"), name, t.Format(tr("01月02日 15:04")), day, day-previousDay))
+		default:
+			lines = append(lines, fmt.Sprintf(tr("%s：%s达到（周期第%d天），与上个周期同一天"), name, t.Format(tr("01月02日 15:04")), day))
+		}
+	}
+	previousThreshold, previousRatio := "", ""
+	if previous != nil {
+		previousThreshold, previousRatio = previous.ThresholdReached, previous.RatioReached
+	}
+	describe(fmt.Sprintf(tr("%.0f%%阈值"), config.Comparison.Threshold*100), config.Statistics.ThresholdReached, previousThreshold)
+	describe(fmt.Sprintf(tr("%.0f%%限制"), config.Comparison.Ratio*100), config.Statistics.RatioReached, previousRatio)
+	if trend := crossingTrend(config, config.Statistics.ThresholdReached, func(p PeriodRecord) string { return p.ThresholdReached }); trend != "" {
+		lines = append(lines, tr("阈值趋势：")+trend)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The past periods the trend is taken over
+const trendPeriods = 6
+
+// Whether the threshold is reached earlier or later than in the past periods: the
+// current day against their average, and a run of periods moving the same way.
+// Two past periods that reached it are needed, otherwise it is empty.
+func crossingTrend(config *Config, current string, reached func(PeriodRecord) string) string {
+	periods := pastPeriods(config)
+	if len(periods) > trendPeriods {
+		periods = periods[len(periods)-trendPeriods:]
+	}
+	var days []int
+	for _, period := range periods {
+		if day, _, ok := dayOfPeriod(period.Start, reached(period)); ok {
+			days = append(days, day)
+		}
+	}
+	if len(days) < 2 {
+		return ""
+	}
+	sum := 0
+	for _, day := range days {
+		sum += day
+	}
+	average := float64(sum) / float64(len(days))
+
+	var parts []string
+	summary := fmt.Sprintf(tr("前%d个周期中%d个达到，平均在第%.0f天"), len(periods), len(days), average)
+	day, _, ok := dayOfPeriod(lastResetDate(config), current)
+	if ok {
+		days = append(days, day)
+		switch difference := average - float64(day); {
+		case difference >= 1:
+			summary += fmt.Sprintf(tr("，本周期早%.0f天"), difference)
+		case difference <= -1:
+			summary += fmt.Sprintf(tr("，本周期晚%.0f天"), -difference)
+		default:
+			summary += tr("，本周期与平均相近")
+		}
+	}
+	parts = append(parts, summary)
+
+	// Count the latest steps that all moved the same way
+	earlier, later := 0, 0
+	for i := len(days) - 1; i > 0; i-- {
+		if days[i] < days[i-1] && later == 0 {
+			earlier++
+		} else if days[i] > days[i-1] && earlier == 0 {
+			later++
+		} else {
+			break
+		}
+	}
+	switch {
+	case earlier >= 2:
+		parts = append(parts, fmt.Sprintf(tr("已连续%d个周期提前达到，用量在增加"), earlier))
+	case later >= 2:
+		parts = append(parts, fmt.Sprintf(tr("已连续%d个周期推迟达到，用量在减少"), later))
+	}
+	return strings.Join(parts, "；")
+}
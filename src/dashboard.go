@@ -0,0 +1,123 @@
+//go:build !noweb
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The dashboard page: usage of the period, the chart and the event timeline
+func handleDashboard(w http.ResponseWriter, r *http.Request, user principal) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	config, err := loadSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var b strings.Builder
+	device := html.EscapeString(config.Device)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s 流量监控</title></head>\n", device)
+	b.WriteString("<body style=\"font-family: sans-serif; max-width: 760px; margin: auto\">\n")
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", device)
+	fmt.Fprintf(&b, "<p>统计周期：%s 至今，下载%.2f GB，上传%.2f GB", html.EscapeString(lastResetDate(&config)),
+		float64(config.Statistics.TotalReceive)/bytesToGB, float64(config.Statistics.TotalTransmit)/bytesToGB)
+	if limit := effectiveLimit(&config); limit > 0 {
+		value := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+		fmt.Fprintf(&b, "，%s %.2f / %.2f GB (%.1f%%)", html.EscapeString(config.Comparison.Category), value,
+			limit, value/limit*100)
+	}
+	if config.Prepaid {
+		fmt.Fprintf(&b, "，预付费余额%.2f GB", prepaidBalance(&config))
+	}
+	b.WriteString("</p>\n")
+	if crossings := describeCrossings(&config); crossings != "" {
+		fmt.Fprintf(&b, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(crossings), "\n", "<br>"))
+	}
+	if countdown := describeShutdown(&config, time.Now()); countdown != "" {
+		fmt.Fprintf(&b, "<p style=\"color: #d62728\"><b>关机倒计时：%s</b></p>\n", html.EscapeString(countdown))
+	}
+	if downtime := describeDowntime(&config, time.Now()); downtime != "" {
+		fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(downtime))
+	}
+
+	// Alerts link to the chart zoomed to a spike with from, to and focus
+	now := time.Now()
+	start, last := periodStart(&config, now), now
+	query := r.URL.Query()
+	from, fromErr := time.ParseInLocation("2006-01-02", query.Get("from"), time.Local)
+	to, toErr := time.ParseInLocation("2006-01-02", query.Get("to"), time.Local)
+	if fromErr == nil && toErr == nil && !to.Before(from) && to.Sub(from) <= maxChartDays*24*time.Hour {
+		start, last = from, to
+		fmt.Fprintf(&b, "<p>%s 至 %s <a href=\"/\">查看整个周期</a></p>\n", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	b.WriteString(usageChartSVG(&config, start, last, query.Get("focus")))
+	b.WriteString("<p><span style=\"color: #4c78a8\">■</span> 下载 <span style=\"color: #9ecae9\">■</span> 上传")
+	for _, kind := range eventKinds {
+		style := eventStyles[kind]
+		fmt.Fprintf(&b, " <span style=\"color: %s\">●</span> %s", style.color, style.label)
+	}
+	b.WriteString("</p>\n")
+
+	// Newest first, the chart shows where they are
+	b.WriteString("<h2>事件</h2>\n<ul>\n")
+	for i := len(config.History.Events) - 1; i >= 0; i-- {
+		event := config.History.Events[i]
+		style, ok := eventStyles[event.Kind]
+		if !ok {
+			continue
+		}
+		by := ""
+		if event.By != "" {
+			by = "（" + html.EscapeString(event.By) + "）"
+		}
+		fmt.Fprintf(&b, "<li><span style=\"color: %s\">●</span> %s %s：%s%s</li>\n", style.color,
+			html.EscapeString(formatEventTime(event)), style.label, html.EscapeString(event.Detail), by)
+	}
+	b.WriteString("</ul>\n")
+
+	if user.role == roleAdmin {
+		writeControls(&b, user, config.Statistics.Pause != nil, !pendingShutdown(&config).IsZero())
+	}
+	fmt.Fprintf(&b, "<p style=\"color: #999\">%s（%s）</p>\n</body></html>\n", html.EscapeString(user.name), user.role)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, b.String())
+}
+
+// The admin's forms, they post to the control API and come back to the dashboard
+func writeControls(b *strings.Builder, user principal, paused, countdown bool) {
+	form := func(action, confirm string) {
+		fmt.Fprintf(b, "<form method=\"post\" action=\"/api/%s\" style=\"margin: 4px 0\"", action)
+		if confirm != "" {
+			fmt.Fprintf(b, " onsubmit=\"return confirm('%s')\"", confirm)
+		}
+		fmt.Fprintf(b, "><input type=\"hidden\" name=\"token\" value=\"%s\"><input type=\"hidden\" name=\"redirect\" value=\"1\">\n",
+			html.EscapeString(user.token))
+	}
+
+	b.WriteString("<h2>操作</h2>\n")
+	if countdown {
+		form(actionCancelShutdown, "确定要取消关机吗？本周期不会再因同一原因关机")
+		b.WriteString("<input name=\"reason\" placeholder=\"原因\"> <button>取消关机</button></form>\n")
+	}
+	if paused {
+		form(actionResume, "")
+		b.WriteString("<button>恢复统计</button></form>\n")
+	} else {
+		form(actionPause, "")
+		b.WriteString("暂停统计 <input name=\"for\" placeholder=\"时长，例如2h，为空直到恢复\"> <input name=\"reason\" placeholder=\"原因\"> <button>暂停</button></form>\n")
+	}
+	form(actionAnnotate, "")
+	b.WriteString("添加备注 <input name=\"reason\" placeholder=\"备注内容\" required> <input name=\"for\" placeholder=\"持续时长，可为空\"> <button>添加</button></form>\n")
+	form(actionReset, "确定要立即重置本周期的统计吗？")
+	b.WriteString("<input name=\"reason\" placeholder=\"原因\"> <button>立即重置统计</button></form>\n")
+	b.WriteString("<p style=\"color: #999\">操作在下一次采样时生效，刷新页面查看结果</p>\n")
+}
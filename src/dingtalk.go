@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DingTalkMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	AccessToken     string `json:"access_token"`     // 群机器人Webhook地址中的access_token
+	Secret          string `json:"secret,omitempty"` // 安全设置为"加签"时的密钥，SEC开头
+}
+
+// The robot's URL, signed with the timestamp when the robot requires it
+func dingTalkURL(dingtalk DingTalkMessage, now time.Time) string {
+	query := url.Values{"access_token": {dingtalk.AccessToken}}
+	if dingtalk.Secret != "" {
+		timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(dingtalk.Secret))
+		mac.Write([]byte(timestamp + "\n" + dingtalk.Secret))
+		query.Set("timestamp", timestamp)
+		query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+	return "https://oapi.dingtalk.com/robot/send?" + query.Encode()
+}
+
+// Send a message to a DingTalk group robot as markdown, so the summary's lists and
+// sections keep their lines on mobile
+func sendDingTalkMessage(dingtalk DingTalkMessage, message, device string) error {
+	// Markdown joins single line breaks, two trailing spaces keep them
+	text := fmt.Sprintf("#### [%s]\n%s", device, strings.ReplaceAll(message, "\n", "  \n"))
+	body := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": fmt.Sprintf(tr("[%s] 流量监控"), device),
+			"text":  text,
+		},
+	}
+	jsonBody, _ := json.Marshal(body)
+
+	resp, err := notifyClient("dingtalk").Post(dingTalkURL(dingtalk, time.Now()), "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to send message to DingTalk: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Errors such as a wrong signature come with status 200 and errcode set
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read DingTalk response: %s %v", resp.Status, err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("got error from DingTalk: %d %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+)
+
+// Send a message to a Discord channel via an incoming webhook
+func sendDiscordMessage(webhookURL, message, device string) error {
+	body := map[string]string{
+		"content": fmt.Sprintf("[%s] %s", device, message),
+	}
+	jsonBody, _ := json.Marshal(body)
+
+	resp, err := notifyClient("discord").Post(webhookURL, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to send message to Discord: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("got error status from Discord: %s", resp.Status)
+	}
+	return nil
+}
+
+// Upload a file to the webhook's channel, Discord shows pictures inline
+func sendDiscordFile(webhookURL, caption string, attachment Attachment, device string) error {
+	payload, _ := json.Marshal(map[string]string{
+		"content": fmt.Sprintf("[%s] %s", device, caption),
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("payload_json", string(payload))
+	part, err := form.CreateFormFile("files[0]", attachment.Name)
+	if err != nil {
+		return err
+	}
+	part.Write(attachment.Data)
+	form.Close()
+
+	resp, err := notifyClient("discord").Post(webhookURL, form.FormDataContentType(), &body)
+	if err != nil {
+		return fmt.Errorf("failed to send file to Discord: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("got error status from Discord: %s", resp.Status)
+	}
+	return nil
+}
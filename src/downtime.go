@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// A time span the monitor wasn't running, found at startup from the last sample
+type DowntimeGap struct {
+	Start  string `json:"start"`            // 上次采样的时间，RFC3339格式
+	End    string `json:"end"`              // 重新启动的时间
+	Reboot bool   `json:"reboot,omitempty"` // 期间系统是否重启过，重启前未采样的流量已丢失
+}
+
+// Gaps kept per period, a flapping service shouldn't grow the config without bound
+const maxDowntimeGaps = 100
+
+// Remember a gap of the current period
+func recordDowntime(config *Config, start, end time.Time, reboot bool) {
+	gaps := append(config.Statistics.Downtime, DowntimeGap{
+		Start:  start.Format(time.RFC3339),
+		End:    end.Format(time.RFC3339),
+		Reboot: reboot,
+	})
+	if len(gaps) > maxDowntimeGaps {
+		gaps = gaps[len(gaps)-maxDowntimeGaps:]
+	}
+	config.Statistics.Downtime = gaps
+}
+
+// The end of the current period, now for prepaid balances and calendars without a
+// following period
+func periodEnd(config *Config, now time.Time) time.Time {
+	if config.Prepaid {
+		return now
+	}
+	end := nextResetDate(config, periodStart(config, now))
+	if end.IsZero() || end.After(now) {
+		return now
+	}
+	return end
+}
+
+// The time the monitor wasn't running within the period and how many of the gaps had
+// a reboot in them
+func periodDowntime(config *Config, now time.Time) (time.Duration, int) {
+	from, to := periodStart(config, now), periodEnd(config, now)
+	var total time.Duration
+	reboots := 0
+	for _, gap := range config.Statistics.Downtime {
+		start, err1 := time.Parse(time.RFC3339, gap.Start)
+		end, err2 := time.Parse(time.RFC3339, gap.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		start, end = maxTime(start, from), minTime(end, to)
+		if !end.After(start) {
+			continue
+		}
+		total += end.Sub(start)
+		if gap.Reboot {
+			reboots++
+		}
+	}
+	return total, reboots
+}
+
+// Drop the gaps that ended before the new period, called at the reset. A gap across
+// the reset stays and counts for the new period from its start on.
+func trimDowntime(config *Config, now time.Time) {
+	start := periodStart(config, now)
+	var kept []DowntimeGap
+	for _, gap := range config.Statistics.Downtime {
+		if end, err := time.Parse(time.RFC3339, gap.End); err == nil && end.After(start) {
+			kept = append(kept, gap)
+		}
+	}
+	config.Statistics.Downtime = kept
+}
+
+// Describe the downtime of the period for the summary, empty when there was none
+func describeDowntime(config *Config, now time.Time) string {
+	total, reboots := periodDowntime(config, now)
+	if total <= 0 {
+		return ""
+	}
+	text := fmt.Sprintf(tr("监控停止：本周期内程序共停止运行%s"), total.Round(time.Minute))
+	if reboots > 0 {
+		text += fmt.Sprintf(tr("，其中%d次期间系统重启过，重启前未采样的流量没有计入，以上统计可能少于服务商的数据"), reboots)
+	}
+	return text
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// How the connection to the SMTP server is secured
+const (
+	emailTLS      = "tls"      // SMTPS, TLS from the start, usually port 465
+	emailStartTLS = "starttls" // upgraded after connecting, usually port 587
+	emailPlain    = "none"     // no encryption, only for a relay on the host or LAN
+)
+
+// Messages kept for the daily digest, the oldest are dropped beyond this
+const maxDigestEntries = 200
+
+type EmailMessage struct {
+	ThresholdStatus bool     `json:"threshold_status"`
+	RatioStatus     bool     `json:"ratio_status"`
+	Host            string   `json:"host"`     // SMTP服务器地址
+	Port            int      `json:"port"`     // 端口，为0时tls使用465，starttls使用587，none使用25
+	TLS             string   `json:"tls"`      // 加密方式：tls、starttls（默认）或none
+	Username        string   `json:"username"` // 登录用户名，为空时不登录
+	Password        string   `json:"password"` // 登录密码或授权码
+	From            string   `json:"from"`     // 发件人地址
+	To              []string `json:"to"`       // 收件人地址
+
+	// 每日汇总：关机警告以外的消息先保存起来，每天digest_hour点合并成一封邮件发送
+	Digest     bool          `json:"digest,omitempty"`
+	DigestHour int           `json:"digest_hour,omitempty"`
+	Queue      []DigestEntry `json:"queue,omitempty"`       // 等待汇总发送的消息
+	LastDigest string        `json:"last_digest,omitempty"` // 上次发送汇总的日期
+}
+
+type DigestEntry struct {
+	Time    string `json:"time"` // 消息产生的时间，RFC3339格式
+	Message string `json:"message"`
+}
+
+// Check the email settings when email is the selected service
+func validateEmail(email EmailMessage) error {
+	switch email.TLS {
+	case "", emailTLS, emailStartTLS, emailPlain:
+	default:
+		return fmt.Errorf("invalid email tls %q, must be tls, starttls or none", email.TLS)
+	}
+	if email.Host == "" || email.From == "" || len(email.To) == 0 {
+		return fmt.Errorf("email needs host, from and to")
+	}
+	if email.DigestHour < 0 || email.DigestHour > 23 {
+		return fmt.Errorf("invalid email digest_hour: %d", email.DigestHour)
+	}
+	return nil
+}
+
+// Send a message by email, or keep it for the digest
+func sendEmailMessage(config *Config, message string) error {
+	email := &config.Message.Email
+	if email.Digest && !config.urgent {
+		email.Queue = append(email.Queue, DigestEntry{Time: time.Now().Format(time.RFC3339), Message: message})
+		if len(email.Queue) > maxDigestEntries {
+			email.Queue = email.Queue[len(email.Queue)-maxDigestEntries:]
+		}
+		return nil
+	}
+	return sendEmail(*email, emailSubject(config.Device, message), emailBody(message), nil)
+}
+
+// Mail a report file as an attachment, files aren't kept for the digest
+func sendEmailFile(config *Config, caption string, attachment Attachment) error {
+	return sendEmail(config.Message.Email, emailSubject(config.Device, caption), emailBody(caption), &attachment)
+}
+
+// Send the day's digest once the hour has come, the queue is kept when it fails
+func flushEmailDigest(config *Config, now time.Time) {
+	email := &config.Message.Email
+	if !slices.Contains(config.Message.allServices(), "email") || !email.Digest || len(email.Queue) == 0 {
+		return
+	}
+	today := now.Format("2006-01-02")
+	if now.Hour() < email.DigestHour || email.LastDigest == today {
+		return
+	}
+
+	var body strings.Builder
+	for _, entry := range email.Queue {
+		if t, err := time.Parse(time.RFC3339, entry.Time); err == nil {
+			body.WriteString(t.Local().Format("01-02 15:04") + "\n")
+		}
+		body.WriteString(entry.Message + "\n\n")
+	}
+	subject := fmt.Sprintf(tr("[%s] 每日汇总 %s（%d条消息）"), config.Device, today, len(email.Queue))
+	err := sendEmail(*email, subject, body.String(), nil)
+	reportHealth(config, healthSend, err)
+	if err != nil {
+		logf("Failed to send email digest: %v\n", err)
+		return
+	}
+	logf("Email digest with %d messages sent\n", len(email.Queue))
+	email.Queue = nil
+	email.LastDigest = today
+}
+
+// The first line of the message as the subject, with the device in front
+func emailSubject(device, message string) string {
+	line, _, _ := strings.Cut(message, "\n")
+	if utf8.RuneCountInString(line) > 60 {
+		line = string([]rune(line)[:60]) + "…"
+	}
+	return fmt.Sprintf("[%s] %s", device, line)
+}
+
+func emailBody(message string) string {
+	return message + "\n"
+}
+
+// Build the mail and hand it to the SMTP server
+func sendEmail(email EmailMessage, subject, body string, attachment *Attachment) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", email.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(email.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	text := base64Lines([]byte(body))
+	if attachment == nil {
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\n")
+		msg.WriteString(text)
+	} else {
+		parts := multipart.NewWriter(&msg)
+		fmt.Fprintf(&msg, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", parts.Boundary())
+		part, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		part.Write([]byte(text))
+		part, _ = parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		})
+		part.Write([]byte(base64Lines(attachment.Data)))
+		parts.Close()
+	}
+
+	if err := deliverEmail(email, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+// Base64 in lines of 76 characters as mail requires
+func base64Lines(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.String()
+}
+
+// Talk SMTP with the configured server and security
+func deliverEmail(email EmailMessage, msg []byte) error {
+	mode := email.TLS
+	if mode == "" {
+		mode = emailStartTLS
+	}
+	port := email.Port
+	if port == 0 {
+		port = map[string]int{emailTLS: 465, emailStartTLS: 587, emailPlain: 25}[mode]
+	}
+	addr := net.JoinHostPort(email.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: email.Host}
+
+	conn, err := dialNotify("email", addr)
+	if err != nil {
+		return err
+	}
+	if mode == emailTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	client, err := smtp.NewClient(conn, email.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if mode == emailStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if email.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", email.Username, email.Password, email.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(email.From); err != nil {
+		return err
+	}
+	for _, to := range email.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(msg); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
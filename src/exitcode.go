@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Stable exit codes, so wrapper scripts can react without parsing the output
+const (
+	exitOK           = 0
+	exitFailure      = 1 // 未分类的运行错误
+	exitUsage        = 2 // 命令行参数错误，与flag包保持一致
+	exitConfig       = 3 // 配置文件无法读取或内容无效
+	exitInterface    = 4 // 监控的网卡不存在
+	exitStateCorrupt = 5 // 配置文件中的statistics统计数据已损坏
+)
+
+var exitKinds = map[int]string{
+	exitOK:           "ok",
+	exitFailure:      "failure",
+	exitUsage:        "usage",
+	exitConfig:       "config",
+	exitInterface:    "interface",
+	exitStateCorrupt: "state_corrupt",
+}
+
+// quiet suppresses all routine output, only fatal errors are printed
+var quiet bool
+
+// Print a log line unless running in quiet mode
+func logf(format string, a ...any) {
+	if quiet {
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
+// Print a single machine-readable error line to stderr and exit with the given code
+func exitWithError(code int, err error) {
+	kind, ok := exitKinds[code]
+	if !ok {
+		kind = "unknown"
+	}
+	fmt.Fprintf(os.Stderr, "netmonitor: error code=%d kind=%s msg=%q\n", code, kind, err.Error())
+	os.Exit(code)
+}
+
+// Map a loadConfig error to an exit code, type errors inside statistics mean the state is corrupt
+func loadErrorCode(err error) int {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && strings.HasPrefix(typeErr.Field, "statistics") {
+		return exitStateCorrupt
+	}
+	return exitConfig
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cells of the usage bar in the card
+const feishuBarWidth = 20
+
+type FeishuMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	WebhookURL      string `json:"webhook_url"`      // 自定义机器人的Webhook地址
+	Secret          string `json:"secret,omitempty"` // 安全设置为"签名校验"时的密钥
+}
+
+// Feishu signs with the timestamp and secret as the HMAC key over an empty message
+func feishuSign(secret string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(strconv.FormatInt(timestamp, 10)+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Build the card: the message, then the period's download, upload and total side by
+// side and a bar of the quota, colored like the dashboard's
+func feishuCard(config *Config, message string) map[string]any {
+	receiveGB := float64(config.Statistics.TotalReceive) / bytesToGB
+	transmitGB := float64(config.Statistics.TotalTransmit) / bytesToGB
+	field := func(name string, value float64) map[string]any {
+		return map[string]any{"is_short": true, "text": map[string]string{"tag": "lark_md", "content": fmt.Sprintf("**%s**\n%.2f GB", name, value)}}
+	}
+	elements := []any{
+		map[string]any{"tag": "div", "text": map[string]string{"tag": "lark_md", "content": message}},
+		map[string]any{"tag": "hr"},
+		map[string]any{"tag": "div", "fields": []any{
+			field(tr("下载"), receiveGB), field(tr("上传"), transmitGB), field(tr("合计"), receiveGB+transmitGB),
+		}},
+	}
+
+	template := "blue"
+	limit := effectiveLimit(config)
+	if limit > 0 {
+		used := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+		percent := used / limit * 100
+		filled := int(min(percent, 100) / 100 * feishuBarWidth)
+		bar := strings.Repeat("█", filled) + strings.Repeat("░", feishuBarWidth-filled)
+		elements = append(elements, map[string]any{"tag": "div", "text": map[string]string{
+			"tag": "lark_md", "content": fmt.Sprintf(tr("%s **%.1f%%**\n已使用 %.2f GB / %.2f GB"), bar, percent, used, limit),
+		}})
+		switch {
+		case used >= limit*config.Comparison.Ratio:
+			template = "red"
+		case used >= limit*config.Comparison.Threshold:
+			template = "orange"
+		default:
+			template = "green"
+		}
+	}
+
+	return map[string]any{
+		"config": map[string]bool{"wide_screen_mode": true},
+		"header": map[string]any{
+			"template": template,
+			"title":    map[string]string{"tag": "plain_text", "content": fmt.Sprintf(tr("[%s] 流量监控"), config.Device)},
+		},
+		"elements": elements,
+	}
+}
+
+// Send a message to a Feishu/Lark custom bot as an interactive card
+func sendFeishuMessage(config *Config, message string) error {
+	feishu := config.Message.Feishu
+	body := map[string]any{
+		"msg_type": "interactive",
+		"card":     feishuCard(config, message),
+	}
+	if feishu.Secret != "" {
+		timestamp := time.Now().Unix()
+		body["timestamp"] = strconv.FormatInt(timestamp, 10)
+		body["sign"] = feishuSign(feishu.Secret, timestamp)
+	}
+	jsonBody, _ := json.Marshal(body)
+
+	resp, err := notifyClient("feishu").Post(feishu.WebhookURL, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to send message to Feishu: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// A bad signature or card is reported in the body with a non-zero code
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read Feishu response: %s %v", resp.Status, err)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("got error from Feishu: %d %s", result.Code, result.Msg)
+	}
+	return nil
+}
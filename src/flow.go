@@ -0,0 +1,373 @@
+//go:build !nocollector
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Field IDs shared by NetFlow v9 and IPFIX
+const (
+	flowFieldInBytes  = 1  // IN_BYTES / octetDeltaCount
+	flowFieldInputIf  = 10 // INPUT_SNMP / ingressInterface
+	flowFieldOutputIf = 14 // OUTPUT_SNMP / egressInterface
+	flowFieldOutBytes = 23 // OUT_BYTES / postOctetDeltaCount
+)
+
+type templateKey struct {
+	exporter string
+	domain   uint32
+	id       uint16
+}
+
+type templateField struct {
+	id     uint16
+	length uint16 // 65535 marks an IPFIX variable-length field
+}
+
+// Receives flow exports from a router and turns them into cumulative counters
+type flowCollector struct {
+	config *CollectorConfig
+
+	mu        sync.Mutex
+	flow      NetStats                        // NetFlow/IPFIX bytes since start, by direction
+	sflow     map[string]NetStats             // sFlow interface counters, keyed by agent
+	templates map[templateKey][]templateField // NetFlow v9/IPFIX templates
+}
+
+// Listen for NetFlow/IPFIX/sFlow datagrams in the background
+func startFlowCollector(config *CollectorConfig) (*flowCollector, error) {
+	conn, err := net.ListenPacket("udp", config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for flows on %s: %v", config.Listen, err)
+	}
+
+	c := &flowCollector{
+		config:    config,
+		sflow:     make(map[string]NetStats),
+		templates: make(map[templateKey][]templateField),
+	}
+	go c.serve(conn)
+	logf("Flow collector listening on %s\n", config.Listen)
+	return c, nil
+}
+
+func (c *flowCollector) serve(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			logf("Flow collector read error: %v\n", err)
+			continue
+		}
+		host, _, _ := net.SplitHostPort(addr.String())
+
+		c.mu.Lock()
+		err = c.handle(host, buf[:n])
+		c.mu.Unlock()
+		if err != nil {
+			logf("Ignored flow datagram from %s: %v\n", host, err)
+		}
+	}
+}
+
+func (c *flowCollector) counters() (map[string]NetStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counters := map[string]NetStats{"flow": c.flow}
+	for key, stats := range c.sflow {
+		counters[key] = stats
+	}
+	return counters, nil
+}
+
+// Dispatch a datagram by protocol version
+func (c *flowCollector) handle(exporter string, data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("datagram too short")
+	}
+	// sFlow starts with a 32-bit version, NetFlow with a 16-bit one
+	if binary.BigEndian.Uint32(data) == 5 {
+		return c.handleSflow(data)
+	}
+	switch binary.BigEndian.Uint16(data) {
+	case 5:
+		return c.handleNetflowV5(data)
+	case 9:
+		return c.handleTemplated(exporter, data, 9)
+	case 10:
+		return c.handleTemplated(exporter, data, 10)
+	default:
+		return fmt.Errorf("unsupported flow version %d", binary.BigEndian.Uint16(data))
+	}
+}
+
+// Attribute a flow's bytes to download or upload depending on the WAN interface
+func (c *flowCollector) addFlow(input, output uint32, bytes uint64) {
+	switch c.config.WanIfIndex {
+	case input:
+		c.flow.ReceiveBytes += bytes
+	case output:
+		c.flow.TransmitBytes += bytes
+	}
+}
+
+// NetFlow v5: fixed 24 byte header followed by 48 byte records
+func (c *flowCollector) handleNetflowV5(data []byte) error {
+	if len(data) < 24 {
+		return fmt.Errorf("netflow v5 header too short")
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	sampling := uint64(binary.BigEndian.Uint16(data[22:]) & 0x3fff)
+	if sampling == 0 {
+		sampling = 1
+	}
+	if len(data) < 24+count*48 {
+		return fmt.Errorf("netflow v5 datagram truncated")
+	}
+
+	for i := 0; i < count; i++ {
+		record := data[24+i*48:]
+		input := uint32(binary.BigEndian.Uint16(record[12:]))
+		output := uint32(binary.BigEndian.Uint16(record[14:]))
+		octets := uint64(binary.BigEndian.Uint32(record[20:]))
+		c.addFlow(input, output, octets*sampling)
+	}
+	return nil
+}
+
+// NetFlow v9 and IPFIX share the template mechanism, with slightly different framing
+func (c *flowCollector) handleTemplated(exporter string, data []byte, version int) error {
+	headerLen, templateSet := 20, uint16(0)
+	if version == 10 {
+		headerLen, templateSet = 16, 2
+	}
+	if len(data) < headerLen {
+		return fmt.Errorf("netflow v%d header too short", version)
+	}
+	domain := binary.BigEndian.Uint32(data[headerLen-4:])
+
+	for offset := headerLen; offset+4 <= len(data); {
+		setID := binary.BigEndian.Uint16(data[offset:])
+		setLen := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if setLen < 4 || offset+setLen > len(data) {
+			return fmt.Errorf("invalid flowset length %d", setLen)
+		}
+		body := data[offset+4 : offset+setLen]
+		offset += setLen
+
+		switch {
+		case setID == templateSet:
+			c.parseTemplates(exporter, domain, body, version == 10)
+		case setID >= 256:
+			fields, ok := c.templates[templateKey{exporter, domain, setID}]
+			if !ok {
+				// The template arrives periodically, data before it is lost
+				continue
+			}
+			c.parseDataSet(fields, body)
+		}
+	}
+	return nil
+}
+
+func (c *flowCollector) parseTemplates(exporter string, domain uint32, body []byte, ipfix bool) {
+	for len(body) >= 4 {
+		id := binary.BigEndian.Uint16(body)
+		count := int(binary.BigEndian.Uint16(body[2:]))
+		body = body[4:]
+
+		fields := make([]templateField, 0, count)
+		size := 0
+		for i := 0; i < count; i++ {
+			if len(body) < 4 {
+				return
+			}
+			field := templateField{id: binary.BigEndian.Uint16(body), length: binary.BigEndian.Uint16(body[2:])}
+			body = body[4:]
+			// IPFIX enterprise fields carry an extra enterprise number
+			if ipfix && field.id&0x8000 != 0 {
+				if len(body) < 4 {
+					return
+				}
+				body = body[4:]
+				field.id = 0 // vendor specific, never one of ours
+			}
+			if field.length == 65535 {
+				size++ // at least the length byte
+			} else {
+				size += int(field.length)
+			}
+			fields = append(fields, field)
+		}
+		// A record of this template takes no bytes, decoding data with it would never end
+		if size == 0 {
+			continue
+		}
+		key := templateKey{exporter, domain, id}
+		if _, ok := c.templates[key]; !ok && lowMemory && len(c.templates) >= lowMemoryTemplates {
+			continue // data using it is dropped like data before its template
+		}
+		c.templates[key] = fields
+	}
+}
+
+func (c *flowCollector) parseDataSet(fields []templateField, body []byte) {
+	sampling := uint64(c.config.SamplingRate)
+	if sampling == 0 {
+		sampling = 1
+	}
+
+	for len(body) > 0 {
+		remaining := len(body)
+		var input, output uint32
+		var inBytes, outBytes uint64
+		for _, field := range fields {
+			length := int(field.length)
+			if field.length == 65535 {
+				// IPFIX variable-length encoding
+				if len(body) < 1 {
+					return
+				}
+				length, body = int(body[0]), body[1:]
+				if length == 255 {
+					if len(body) < 2 {
+						return
+					}
+					length, body = int(binary.BigEndian.Uint16(body)), body[2:]
+				}
+			}
+			if length > len(body) {
+				// Padding at the end of the set
+				return
+			}
+			value := readUint(body[:length])
+			body = body[length:]
+
+			switch field.id {
+			case flowFieldInBytes:
+				inBytes = value
+			case flowFieldOutBytes:
+				outBytes = value
+			case flowFieldInputIf:
+				input = uint32(value)
+			case flowFieldOutputIf:
+				output = uint32(value)
+			}
+		}
+		// Both fields count the same flow, OUT_BYTES is only used when IN_BYTES is missing
+		octets := inBytes
+		if octets == 0 {
+			octets = outBytes
+		}
+		c.addFlow(input, output, octets*sampling)
+		if len(body) == remaining {
+			return
+		}
+	}
+}
+
+// Decode a big-endian unsigned integer of up to 8 bytes
+func readUint(b []byte) uint64 {
+	if len(b) > 8 {
+		return 0
+	}
+	var value uint64
+	for _, x := range b {
+		value = value<<8 | uint64(x)
+	}
+	return value
+}
+
+// sFlow v5: only the generic interface counter records are used, they carry the
+// router's own cumulative ifInOctets/ifOutOctets so no sampling math is needed
+func (c *flowCollector) handleSflow(data []byte) error {
+	r := xdrReader{data: data[4:]}
+	addrType := r.uint32()
+	var agent net.IP
+	switch addrType {
+	case 1:
+		agent = net.IP(r.bytes(4))
+	case 2:
+		agent = net.IP(r.bytes(16))
+	default:
+		return fmt.Errorf("unknown sflow agent address type %d", addrType)
+	}
+	r.skip(12) // sub agent id, sequence, uptime
+	samples := r.uint32()
+
+	for i := uint32(0); i < samples && r.err == nil; i++ {
+		format := r.uint32()
+		sample := xdrReader{data: r.bytes(int(r.uint32()))}
+		if format>>12 != 0 {
+			continue // enterprise specific
+		}
+		switch format & 0xfff {
+		case 2: // counter sample
+			sample.skip(8)
+		case 4: // expanded counter sample
+			sample.skip(12)
+		default:
+			continue
+		}
+
+		records := sample.uint32()
+		for j := uint32(0); j < records && sample.err == nil; j++ {
+			recordFormat := sample.uint32()
+			record := xdrReader{data: sample.bytes(int(sample.uint32()))}
+			if recordFormat != 1 { // generic interface counters
+				continue
+			}
+			ifIndex := record.uint32()
+			record.skip(20) // ifType, ifSpeed, ifDirection, ifStatus
+			inOctets := record.uint64()
+			record.skip(24) // inbound packet and error counters
+			outOctets := record.uint64()
+			if record.err == nil && ifIndex == c.config.WanIfIndex {
+				key := fmt.Sprintf("sflow:%s:%d", agent, ifIndex)
+				c.sflow[key] = NetStats{ReceiveBytes: inOctets, TransmitBytes: outOctets}
+			}
+		}
+	}
+	return r.err
+}
+
+// Minimal XDR reader, the first out-of-bounds read sets err and every later read returns zero
+type xdrReader struct {
+	data []byte
+	err  error
+}
+
+func (r *xdrReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.data) {
+		r.err = fmt.Errorf("sflow datagram truncated")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *xdrReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *xdrReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *xdrReader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,57 @@
+//go:build !nocollector
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// An IPFIX datagram: a template of one zero-length field, then a data set using it
+func zeroLengthTemplateDatagram() []byte {
+	data := make([]byte, 36)
+	binary.BigEndian.PutUint16(data[0:], 10) // version
+	binary.BigEndian.PutUint16(data[2:], 36) // length
+	set := data[16:]
+	binary.BigEndian.PutUint16(set[0:], 2)   // template set
+	binary.BigEndian.PutUint16(set[2:], 12)  // set length
+	binary.BigEndian.PutUint16(set[4:], 256) // template id
+	binary.BigEndian.PutUint16(set[6:], 1)   // field count
+	binary.BigEndian.PutUint16(set[8:], flowFieldInBytes)
+	binary.BigEndian.PutUint16(set[10:], 0) // field length
+	set = data[28:]
+	binary.BigEndian.PutUint16(set[0:], 256) // data set of template 256
+	binary.BigEndian.PutUint16(set[2:], 8)
+	return data
+}
+
+func TestFlowZeroLengthTemplate(t *testing.T) {
+	silence(t)
+	c := &flowCollector{config: &CollectorConfig{}, sflow: make(map[string]NetStats), templates: make(map[templateKey][]templateField)}
+
+	done := make(chan error, 1)
+	go func() { done <- c.handle("192.0.2.1", zeroLengthTemplateDatagram()) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("handle: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("datagram with a zero-length template hangs the collector")
+	}
+	if len(c.templates) != 0 {
+		t.Errorf("zero-length template accepted: %v", c.templates)
+	}
+
+	// A record that takes no bytes ends the set instead of repeating
+	go func() {
+		c.parseDataSet([]templateField{{id: flowFieldInBytes, length: 0}}, make([]byte, 4))
+		done <- nil
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("data set of empty records never ends")
+	}
+}
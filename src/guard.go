@@ -0,0 +1,110 @@
+//go:build !noweb
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Network restrictions of the HTTP server, set up before it starts serving
+var httpGuard struct {
+	allow   []*net.IPNet // 允许访问的地址，为空时不限制
+	proxies []*net.IPNet // 可信的反向代理，使用它们转发的X-Forwarded-For
+	authLog *os.File     // 认证失败日志，为空时写入普通日志
+}
+
+// Parse a list of CIDRs, a plain address is taken as a single host
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range list {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// The address of the client. Behind a trusted reverse proxy it is the last address
+// in X-Forwarded-For that isn't a trusted proxy itself, earlier ones can be forged.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(httpGuard.proxies, ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !containsIP(httpGuard.proxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// Log a failed or refused request in one line with a fixed format, so fail2ban and
+// similar tools can match it:
+//
+//	2024-09-01T02:00:00+08:00 netmonitor auth failure from 203.0.113.5 reason=unauthorized path=/api/status user="amy"
+func logAuthFailure(r *http.Request, reason, user string) {
+	line := fmt.Sprintf("%s netmonitor auth failure from %s reason=%s path=%s user=%q\n",
+		time.Now().Format(time.RFC3339), clientIP(r), reason, r.URL.Path, user)
+	if httpGuard.authLog != nil {
+		httpGuard.authLog.WriteString(line)
+		return
+	}
+	logf("%s", line)
+}
+
+// Whether the request carries any credentials, a first visit without them isn't a failure
+func credentialsGiven(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.FormValue("token") != ""
+}
+
+// Refuse clients outside the allowlist before any handler runs
+func allowlisted(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(httpGuard.allow) > 0 && !containsIP(httpGuard.allow, clientIP(r)) {
+			logAuthFailure(r, "not-allowed", "")
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import "fmt"
+
+// Kinds of internal failures tracked as monitor health events
+const (
+	healthRead = "read" // 读取网卡统计失败
+	healthSave = "save" // 写入配置/状态失败
+	healthSend = "send" // 消息发送失败
+)
+
+var healthNames = map[string]string{
+	healthRead: "读取网卡统计",
+	healthSave: "保存统计数据",
+	healthSend: "发送消息",
+}
+
+const defaultHealthFailures = 3
+
+type healthCounter struct {
+	failures int
+	reported bool
+}
+
+// Consecutive failure counters, kept in memory only
+var healthCounters = map[string]*healthCounter{}
+
+// Number of consecutive failures of a kind before a health event is sent
+func healthLimit(config *Config, kind string) int {
+	var limit int
+	switch kind {
+	case healthRead:
+		limit = config.Health.ReadFailures
+	case healthSave:
+		limit = config.Health.SaveFailures
+	case healthSend:
+		limit = config.Health.SendFailures
+	}
+	if limit <= 0 {
+		limit = defaultHealthFailures
+	}
+	return limit
+}
+
+// Record the outcome of an internal operation, a nil error marks it as recovered.
+// Once the failures reach the configured limit a health event is sent through the
+// message service, and a recovery event follows the next success.
+func reportHealth(config *Config, kind string, err error) {
+	counter, ok := healthCounters[kind]
+	if !ok {
+		counter = &healthCounter{}
+		healthCounters[kind] = counter
+	}
+
+	if err == nil {
+		if counter.reported {
+			sendHealthEvent(config, fmt.Sprintf(tr("%s已恢复正常"), tr(healthNames[kind])))
+		}
+		counter.failures = 0
+		counter.reported = false
+		return
+	}
+
+	counter.failures++
+	if counter.reported || counter.failures < healthLimit(config, kind) {
+		return
+	}
+	counter.reported = true
+	sendHealthEvent(config, fmt.Sprintf(tr("连续%d次%s失败：%v"), counter.failures, tr(healthNames[kind]), err))
+}
+
+// Send a health event labeled so it can't be mistaken for a traffic alert
+func sendHealthEvent(config *Config, event string) {
+	logf("Health event: %s\n", event)
+	if !config.Health.Notify {
+		return
+	}
+	err := sendQueuedMessage(config, config.Message.route(routeError), tr("[监控健康] ")+event)
+	if err != nil {
+		logf("Failed to send health event: %v\n", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+)
+
+// Traffic of the period by weekday (Monday first) and hour of day
+type Heatmap [7][24]uint64
+
+var weekdayNames = [7]string{"一", "二", "三", "四", "五", "六", "日"}
+
+// Two letters keep the English heatmap rows aligned like the wide Chinese characters
+var englishWeekdayNames = [7]string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"}
+
+// The short weekday name in the configured language, Monday first
+func weekdayName(day int) string {
+	if language == languageEnUS {
+		return englishWeekdayNames[day]
+	}
+	return weekdayNames[day]
+}
+
+// Add traffic to the cell of the sample time, a sample's whole delta lands in the hour it was taken
+func recordHeatmap(config *Config, now time.Time, bytes uint64) {
+	if bytes == 0 {
+		return
+	}
+	if config.History.Heatmap == nil {
+		config.History.Heatmap = &Heatmap{}
+	}
+	weekday := (int(now.Weekday()) + 6) % 7
+	config.History.Heatmap[weekday][now.Hour()] += bytes
+}
+
+// Render the heatmap as one line of block characters per weekday, scaled to the busiest hour
+func describeHeatmap(heatmap *Heatmap) string {
+	if heatmap == nil {
+		return ""
+	}
+	var peak uint64
+	peakDay, peakHour := 0, 0
+	for day := range heatmap {
+		for hour, bytes := range heatmap[day] {
+			if bytes > peak {
+				peak, peakDay, peakHour = bytes, day, hour
+			}
+		}
+	}
+	if peak == 0 {
+		return ""
+	}
+
+	levels := []rune("▁▂▃▄▅▆▇█")
+	var lines []string
+	for day := range heatmap {
+		var b strings.Builder
+		b.WriteString(weekdayName(day) + " ")
+		for _, bytes := range heatmap[day] {
+			if bytes == 0 {
+				b.WriteRune('·')
+				continue
+			}
+			level := int(bytes * uint64(len(levels)-1) / peak)
+			b.WriteRune(levels[level])
+		}
+		lines = append(lines, b.String())
+	}
+	lines = append(lines, fmt.Sprintf(tr("最忙：周%s %d时，%.2f GB"), weekdayName(peakDay), peakHour, float64(peak)/bytesToGB))
+	return strings.Join(lines, "\n")
+}
+
+// Render the heatmap as an SVG image with labels, for email or a browser
+func heatmapSVG(heatmap *Heatmap, title string) string {
+	const cell, left, top = 24, 40, 40
+	var peak uint64
+	for day := range heatmap {
+		for _, bytes := range heatmap[day] {
+			peak = max(peak, bytes)
+		}
+	}
+
+	var b strings.Builder
+	width, height := left+24*cell+10, top+7*cell+10
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="12">`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="16">%s</text>`+"\n", left, html.EscapeString(title))
+	for hour := 0; hour < 24; hour += 3 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%d</text>`+"\n", left+hour*cell+4, top-6, hour)
+	}
+	for day := range heatmap {
+		y := top + day*cell
+		fmt.Fprintf(&b, `<text x="8" y="%d">%s</text>`+"\n", y+16, fmt.Sprintf(tr("周%s"), weekdayName(day)))
+		for hour, bytes := range heatmap[day] {
+			opacity := 0.0
+			if peak > 0 {
+				opacity = float64(bytes) / float64(peak)
+			}
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#d62728" fill-opacity="%.2f" stroke="#eee"><title>%s</title></rect>`+"\n",
+				left+hour*cell, y, cell, cell, opacity, fmt.Sprintf(tr("周%s %d时 %.2f GB"), weekdayName(day), hour, float64(bytes)/bytesToGB))
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// netmonitor heatmap [--svg file]
+func runHeatmapCommand(args []string) int {
+	flags := flag.NewFlagSet("heatmap", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	svgPath := flags.String("svg", "", "Write the heatmap as an SVG image to this file")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadConfig(*configFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return loadErrorCode(err)
+	}
+	if config.History.Heatmap == nil {
+		fmt.Println("No usage recorded in this period yet")
+		return exitOK
+	}
+
+	if *svgPath != "" {
+		title := fmt.Sprintf(tr("%s 流量热力图（%s 至今）"), config.Device, lastResetDate(&config))
+		if err := os.WriteFile(*svgPath, []byte(heatmapSVG(config.History.Heatmap, title)), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write heatmap: %v\n", err)
+			return exitFailure
+		}
+		fmt.Printf("Heatmap written to %s\n", *svgPath)
+		return exitOK
+	}
+	fmt.Println("   0     6     12    18   23")
+	fmt.Println(describeHeatmap(config.History.Heatmap))
+	return exitOK
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of events recorded in the period history
+const (
+	eventSuspend     = "suspend"     // 系统休眠导致的采样间隔
+	eventClock       = "clock"       // 系统时钟跳变
+	eventPause       = "pause"       // 暂停统计的时间段
+	eventAnnotation  = "annotation"  // 用户添加的备注
+	eventFailover    = "failover"    // 备用线路承载默认路由的时间段
+	eventAlert       = "alert"       // 已发送的阈值和超限提醒
+	eventEnforcement = "enforcement" // 关机、关闭网卡等超限处理
+	eventReset       = "reset"       // 新统计周期的开始
+	eventTopup       = "topup"       // 预付费充值
+	eventDowntime    = "downtime"    // 监控程序停止运行的时间段
+	eventOutlier     = "outlier"     // 超过网卡速率、未计入统计的异常读数
+)
+
+type Event struct {
+	Time   string `json:"time"`             // 开始时间，RFC3339格式
+	End    string `json:"end,omitempty"`    // 结束时间，仅对时间段事件有效
+	Kind   string `json:"kind"`             // 事件类型
+	Detail string `json:"detail,omitempty"` // 事件说明
+	By     string `json:"by,omitempty"`     // 添加备注或暂停统计的用户
+}
+
+type History struct {
+	Events  []Event    `json:"events,omitempty"`  // 当前周期内的事件，重置时清空
+	Days    []DayUsage `json:"days,omitempty"`    // 每天的流量，重置时保留，最多保存62天
+	Heatmap *Heatmap   `json:"heatmap,omitempty"` // 当前周期按星期和小时统计的流量
+
+	Periods []PeriodRecord `json:"periods,omitempty"` // 以往周期达到阈值和限制的时间，最多保存24个周期
+}
+
+// Keep the history bounded, the oldest events are dropped first
+const maxHistoryEvents = 200
+
+// Record an event in the current period's history, end may be zero for a single point in time
+func addEvent(config *Config, kind string, start, end time.Time, detail string) {
+	addEventBy(config, kind, start, end, detail, "")
+}
+
+// Record an event caused by a user's command
+func addEventBy(config *Config, kind string, start, end time.Time, detail, by string) {
+	if lowMemory {
+		return
+	}
+	event := Event{
+		Time:   start.Format(time.RFC3339),
+		Kind:   kind,
+		Detail: detail,
+		By:     by,
+	}
+	if !end.IsZero() {
+		event.End = end.Format(time.RFC3339)
+	}
+
+	config.History.Events = append(config.History.Events, event)
+	if len(config.History.Events) > maxHistoryEvents {
+		config.History.Events = config.History.Events[len(config.History.Events)-maxHistoryEvents:]
+	}
+}
+
+// Record a user annotation queued by `netmonitor annotate`
+func annotate(config *Config, command Command) {
+	start, err := time.Parse(time.RFC3339, command.From)
+	if err != nil {
+		logf("Ignored annotation with invalid start time %q\n", command.From)
+		return
+	}
+	var end time.Time
+	if command.Until != "" {
+		end, _ = time.Parse(time.RFC3339, command.Until)
+	}
+	addEventBy(config, eventAnnotation, start, end, command.Reason, command.By)
+	logf("Annotation added: %s\n", command.Reason)
+}
+
+// Format an event's time range for messages, e.g. "09-01 02:00 ~ 09-01 06:00"
+func formatEventTime(event Event) string {
+	const layout = "01-02 15:04"
+	start, err := time.Parse(time.RFC3339, event.Time)
+	if err != nil {
+		return event.Time
+	}
+	text := start.Local().Format(layout)
+	if end, err := time.Parse(time.RFC3339, event.End); err == nil {
+		text += " ~ " + end.Local().Format(layout)
+	}
+	return text
+}
+
+// List the annotations and pauses of the period, explaining unusual usage in the summary
+func describeEvents(config *Config) string {
+	var lines []string
+	for _, event := range config.History.Events {
+		switch event.Kind {
+		case eventAnnotation, eventPause, eventSuspend, eventFailover, eventTopup, eventDowntime, eventOutlier:
+			lines = append(lines, fmt.Sprintf("- %s %s", formatEventTime(event), event.Detail))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
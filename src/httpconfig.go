@@ -0,0 +1,49 @@
+package main
+
+type HTTPConfig struct {
+	Listen string `json:"listen"` // 网页面板的监听地址，例如"127.0.0.1:8080"，为空时不启动
+	Token  string `json:"token"`  // 访问令牌，为空时不验证，只建议在监听本机地址时使用
+
+	// 面板的外部地址，例如"https://nm.example.com"，用于消息中的链接，为空时使用listen地址
+	PublicURL string `json:"public_url,omitempty"`
+
+	// 只读状态页的令牌，由`netmonitor share`生成，为空表示不分享
+	ShareToken string `json:"share_token,omitempty"`
+
+	Users []HTTPUser `json:"users"` // 面板和API的用户，token对应名为admin的管理员
+
+	OIDC OIDCConfig `json:"oidc"` // 通过OIDC登录面板
+
+	Allow          []string `json:"allow"`           // 允许访问的地址或CIDR，为空时不限制
+	TrustedProxies []string `json:"trusted_proxies"` // 可信的反向代理，按X-Forwarded-For识别客户端地址
+	AuthLog        string   `json:"auth_log"`        // 认证失败日志文件，供fail2ban使用，为空时写入普通日志
+
+	Webhooks []Webhook `json:"webhooks"` // 供外部系统调用的webhook，每个只能执行指定的操作
+}
+
+// Roles of the HTTP users
+const (
+	roleAdmin  = "admin"  // 可以查看，也可以重置、暂停、恢复统计和添加备注
+	roleViewer = "viewer" // 只能查看
+)
+
+type HTTPUser struct {
+	Name  string `json:"name"`  // 用户名，浏览器登录时使用
+	Token string `json:"token"` // 访问令牌，浏览器登录时作为密码
+	Role  string `json:"role"`  // admin或viewer
+}
+
+type OIDCConfig struct {
+	Issuer       string            `json:"issuer"`        // 身份提供方地址，例如"https://auth.example.com"，为空时不启用
+	ClientID     string            `json:"client_id"`     // 客户端ID
+	ClientSecret string            `json:"client_secret"` // 客户端密钥
+	RedirectURL  string            `json:"redirect_url"`  // 面板的外部地址加/auth/callback
+	GroupsClaim  string            `json:"groups_claim"`  // 用户组所在的字段，默认为groups
+	Roles        map[string]string `json:"roles"`         // 用户组到角色的映射，例如{"netadmin": "admin"}
+}
+
+type Webhook struct {
+	Name    string   `json:"name"`    // 名称，记录为操作者webhook:名称
+	Token   string   `json:"token"`   // 调用时使用的令牌
+	Actions []string `json:"actions"` // 允许的操作：pause、resume、annotate、evaluate，为空时全部允许
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+)
+
+// One outbound HTTP request and its response, one JSON object per line in testdata
+type httpExchange struct {
+	Method       string `json:"method"`
+	URL          string `json:"url"`
+	RequestBody  string `json:"request_body,omitempty"`
+	Status       int    `json:"status"`
+	ResponseBody string `json:"response_body,omitempty"`
+}
+
+// Answers requests from a recording in recorded order, per method and URL, and keeps
+// the requests the program sent for the test to check
+type replayTransport struct {
+	mu        sync.Mutex
+	exchanges map[string][]httpExchange
+	sent      []httpExchange
+}
+
+// Install a transport answering every outbound request from testdata/<name>.jsonl
+// instead of the network, until the end of the test
+func replayHTTP(t *testing.T, name string) *replayTransport {
+	t.Helper()
+	file, err := os.Open("testdata/" + name + ".jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	replay := &replayTransport{exchanges: make(map[string][]httpExchange)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var exchange httpExchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			t.Fatalf("invalid HTTP recording %s: %v", name, err)
+		}
+		key := exchange.Method + " " + exchange.URL
+		replay.exchanges[key] = append(replay.exchanges[key], exchange)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := http.DefaultTransport
+	http.DefaultTransport = replay
+	t.Cleanup(func() { http.DefaultTransport = previous })
+	return replay
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	key := req.Method + " " + req.URL.String()
+	t.mu.Lock()
+	t.sent = append(t.sent, httpExchange{Method: req.Method, URL: req.URL.String(), RequestBody: string(body)})
+	queue := t.exchanges[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response for %s", key)
+	}
+	exchange := queue[0]
+	// The last exchange keeps answering, so retries past the recording still work
+	if len(queue) > 1 {
+		t.exchanges[key] = queue[1:]
+	}
+	t.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader([]byte(exchange.ResponseBody))),
+		ContentLength: int64(len(exchange.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// The JSON body of the i-th request sent
+func (t *replayTransport) body(test *testing.T, i int) map[string]any {
+	test.Helper()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i >= len(t.sent) {
+		test.Fatalf("%d requests sent, want at least %d", len(t.sent), i+1)
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(t.sent[i].RequestBody), &body); err != nil {
+		test.Fatalf("request %d is not JSON: %s", i, t.sent[i].RequestBody)
+	}
+	return body
+}
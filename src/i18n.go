@@ -0,0 +1,191 @@
+package main
+
+import "fmt"
+
+// Languages of the built-in messages
+const (
+	languageZhCN = "zh-CN"
+	languageEnUS = "en-US"
+)
+
+// The language of the built-in messages, set from the config's language at startup
+var language = languageZhCN
+
+// English texts of the built-in messages, keyed by the Chinese ones in the code.
+// Fragments that are joined to other texts keep their leading punctuation.
+var englishTexts = map[string]string{
+	// Alerts
+	"流量提醒：当前使用量为 %.2f GB，超过了设置的%.0f%%阈值":                            "Traffic alert: current usage is %.2f GB, over the %.0f%% threshold",
+	"（限额%.2f GB，含上期结转%.2f GB）":                                      " (limit %.2f GB, including %.2f GB rolled over)",
+	"流量提醒：预付费流量余额 %.2f GB，已使用了%.0f%%以上":                             "Traffic alert: %.2f GB of prepaid data left, over %.0f%% used",
+	"\n（重复提醒，%s起超过阈值）":                                              "\n(Reminder, over the threshold since %s)",
+	"[测试] 定期自检：这是一条测试提醒，不是真实的流量提醒，收到说明提醒能正常送达":                      "[TEST] Scheduled self-test: this is a test alert, not a real traffic alert. Receiving it means alerts get through",
+	"定期自检失败，测试提醒没有送达：%s":                                            "Scheduled self-test failed, the test alert was not delivered: %s",
+	"关机警告：当前使用量 %.2f GB，超过了限制的%.0f%%，即将关机！":                         "Shutdown warning: current usage is %.2f GB, over %.0f%% of the limit, shutting down!",
+	"关机警告：当前使用量 %.2f GB，超过了限制的%.0f%%（限额%.2f GB，含上期结转%.2f GB），即将关机！": "Shutdown warning: current usage is %.2f GB, over %.0f%% of the limit (limit %.2f GB, including %.2f GB rolled over), shutting down!",
+	"关机警告：预付费流量余额 %.2f GB，已使用了%.0f%%，即将关机！":                         "Shutdown warning: %.2f GB of prepaid data left, %.0f%% used, shutting down!",
+	"（提醒发送失败）":        " (alert not delivered)",
+	"总流量":             "Total traffic",
+	"总流量超过了限制的%.0f%%": "Total traffic over %.0f%% of the limit",
+	"按最近%.0f天的平均速度（每天%.2f GB），约%.1f天后达到限额": "At the average of the last %.0f days (%.2f GB per day), the limit is reached in about %.1f days",
+	"\n详情：":   "\nDetails: ",
+	"\n详情：%s": "\nDetails: %s",
+	"\n（延迟送达，原定于%s发送）":   "\n(Delivered late, was due at %s)",
+	"\n……（消息过长，后续内容已省略）": "\n... (message too long, the rest is left out)",
+	"测试消息：消息服务配置正确":      "Test message: the message service is set up correctly",
+
+	// Cycle summary
+	"周期统计摘要 (%s 至今):\n\n下载流量：%.2f GB\n上传流量：%.2f GB\n合计流量：%.2f GB\n\n计费方式：%s\n限额：%s\n%s": "Cycle summary (since %s):\n\nDownload: %.2f GB\nUpload: %.2f GB\nTotal: %.2f GB\n\nMetering: %s\nLimit: %s\n%s",
+	"未知":                                    "Unknown",
+	"下载流量：%.2f GB (%.1f%%)":                 "Download: %.2f GB (%.1f%%)",
+	"上传流量：%.2f GB (%.1f%%)":                 "Upload: %.2f GB (%.1f%%)",
+	"总流量：%.2f GB (%.1f%%)":                  "Total: %.2f GB (%.1f%%)",
+	"最大单向流量：%.2f GB (%.1f%%)":               "Larger direction: %.2f GB (%.1f%%)",
+	"不限总量，按线路分别限额":                          "No total limit, each WAN has its own",
+	"（含上期结转%.2f GB）":                        " (including %.2f GB rolled over)",
+	"预付费余额：%.2f GB（累计充值%.2f GB）":            "Prepaid balance: %.2f GB (%.2f GB topped up in total)",
+	"\n\n暂停统计期间排除：下载%.2f GB，上传%.2f GB":      "\n\nExcluded while paused: download %.2f GB, upload %.2f GB",
+	"\n\n端口分类：\n":                           "\n\nPort classes:\n",
+	"\n\n线路：\n":                             "\n\nWANs:\n",
+	"\n\n流量最大的日期：\n":                        "\n\nBusiest days:\n",
+	"\n\n流量热力图（每格1小时，0~23时）：\n":             "\n\nUsage heatmap (one cell per hour, 0-23):\n",
+	"\n\n备注：\n":                             "\n\nNotes:\n",
+	"- %s：下载%.2f GB，上传%.2f GB":              "- %s: download %.2f GB, upload %.2f GB",
+	"- 其他：下载%.2f GB，上传%.2f GB":              "- Other: download %.2f GB, upload %.2f GB",
+	"- %s 周%s：%.2f GB（下载%.2f GB，上传%.2f GB）": "- %s %s: %.2f GB (download %.2f GB, upload %.2f GB)",
+	"最忙：周%s %d时，%.2f GB":                    "Busiest: %s %d:00, %.2f GB",
+	"周%s":                                   "%s",
+	"周%s %d时 %.2f GB":                       "%s %d:00 %.2f GB",
+	"%s 流量热力图（%s 至今）":                       "%s usage heatmap (since %s)",
+	"%s起的每日流量":                              "Daily usage since %s",
+	"%s [附件 %s，%d字节]":                       "%s [attachment %s, %d bytes]",
+	"程序自身发送消息的流量：下载%.2f MB，上传%.2f MB":       "Traffic of the monitor's own messages: download %.2f MB, upload %.2f MB",
+	"（已从统计中扣除）":                             " (excluded from the totals)",
+	"，不限量":                                  ", unlimited",
+	"；备用期间%.2f GB未计入":                       "; %.2f GB on standby not counted",
+	"；%s起承载默认路由":                            "; carrying the default route since %s",
+
+	// Threshold crossings
+	"%s：本周期未达到，上个周期在第%d天达到":     "%s: not reached this cycle, reached on day %d last cycle",
+	"%s：%s达到（周期第%d天）":           "%s: reached %s (day %d of the cycle)",
+	"%s：%s达到（周期第%d天），上个周期未达到":   "%s: reached %s (day %d of the cycle), not reached last cycle",
+	"%s：%s达到（周期第%d天），比上个周期早%d天": "%s: reached %s (day %d of the cycle), %d days earlier than last cycle",
+	"%s：%s达到（周期第%d天），比上个周期晚%d天": "%s: reached %s (day %d of the cycle), %d days later than last cycle",
+	"%s：%s达到（周期第%d天），与上个周期同一天":  "%s: reached %s (day %d of the cycle), the same day as last cycle",
+	"01月02日 15:04": "Jan 02 15:04",
+	"%.0f%%阈值":     "%.0f%% threshold",
+	"%.0f%%限制":     "%.0f%% limit",
+	"阈值趋势：":        "Threshold trend: ",
+	"前%d个周期中%d个达到，平均在第%.0f天": "reached in %[2]d of the last %[1]d cycles, on day %[3].0f on average",
+	"，本周期早%.0f天":             ", %.0f days earlier this cycle",
+	"，本周期晚%.0f天":             ", %.0f days later this cycle",
+	"，本周期与平均相近":              ", close to the average this cycle",
+	"已连续%d个周期提前达到，用量在增加":     "reached earlier %d cycles in a row, usage is growing",
+	"已连续%d个周期推迟达到，用量在减少":     "reached later %d cycles in a row, usage is shrinking",
+
+	// Enforcement
+	"网卡速度限制为%s":         "interface speed limited to %s",
+	"屏蔽所有TCP/UDP端口":     "all TCP/UDP ports blocked",
+	"屏蔽除%s以外的TCP/UDP端口": "TCP/UDP ports except %s blocked",
+	"即将关机！":             "shutting down!",
+	"分级限制":              "Ladder",
+	"分级限制达到限额的%.0f%%":   "Ladder reached %.0f%% of the limit",
+	"分级限制：当前使用量 %.2f GB，达到限额的%.0f%%，%s": "Ladder: current usage is %.2f GB, %.0f%% of the limit, %s",
+	"，分级限制已解除": ", ladder restrictions lifted",
+	"维护窗口（%s）中：%s已超过限制，窗口结束后再执行处理":                            "In the maintenance window (%s): %s is over the limit, enforced after the window ends",
+	"（%s关机，执行netmonitor shutdown --cancel可以取消）":               " (shutting down at %s, run netmonitor shutdown --cancel to cancel)",
+	"关机倒计时：%s，还剩%s，将于%s关机，执行netmonitor shutdown --cancel可以取消": "Shutdown countdown: %s, %s left, shutting down at %s, run netmonitor shutdown --cancel to cancel",
+	"取消了计划的关机：":      "Cancelled the scheduled shutdown: ",
+	"%s，将于%s关机，还剩%s": "%s, shutting down at %s, %s left",
+	"安全模式：本机于%s因流量超限被关机，本周期内再次开机": "Safe mode: this host was shut down at %s for exceeding the limit and booted again within the cycle",
+	"，限制执行失败，请尽快检查":               ", applying the restriction failed, please check soon",
+	"，已": ", applied: ",
+	"，没有配置safe_mode，流量不受限制": ", safe_mode isn't set, traffic is not restricted",
+
+	// WANs
+	"线路":          "WAN ",
+	"，线路":         ", WAN ",
+	"默认路由切换到线路%s": "Default route switched to WAN %s",
+	"流量提醒：线路%s当前使用量为 %.2f GB，超过了设置的%.0f%%阈值": "Traffic alert: WAN %s usage is %.2f GB, over the %.0f%% threshold",
+	"超限警告：线路%s当前使用量 %.2f GB，超过了限制的%.0f%%":    "Limit warning: WAN %s usage is %.2f GB, over %.0f%% of the limit",
+	"，即将关机！":           ", shutting down!",
+	"，即将关闭网卡%s！":       ", bringing down interface %s!",
+	"线路%s超过了限制的%.0f%%": "WAN %s over %.0f%% of the limit",
+
+	// Events and health
+	"开始新的统计周期":                   "New cycle started",
+	"，上期结转%.2f GB":               ", %.2f GB rolled over from the last cycle",
+	"暂停统计，排除下载%.2f GB、上传%.2f GB": "Accounting paused, download %.2f GB and upload %.2f GB excluded",
+	"注入测试流量：下载%.2f GB，上传%.2f GB": "Injected test traffic: download %.2f GB, upload %.2f GB",
+	"充值%.2f GB，余额%.2f GB":        "Topped up %.2f GB, balance %.2f GB",
+	"%s暂停了流量统计":                  "%s paused accounting",
+	"，直到":                        ", until ",
+	"%s恢复了流量统计":                  "%s resumed accounting",
+	"%s手动重置了本周期的统计":              "%s reset the statistics of this cycle",
+	"%s取消了计划的关机（%s）":             "%s cancelled the scheduled shutdown (%s)",
+	"%s充值了%.2f GB，充值后余额%.2f GB":  "%s topped up %.2f GB, the balance is now %.2f GB",
+	"系统时钟跳变%s":                   "System clock jumped %s",
+	"系统时钟跳变了%s，流量重置时间可能受到影响":     "The system clock jumped %s, the reset time may be affected",
+	"系统时钟未同步，请检查NTP服务，按日期重置流量可能不准确": "The system clock isn't synchronized, check the NTP service, date-based resets may be off",
+	"系统时钟已恢复同步": "The system clock is synchronized again",
+	"系统休眠约%s，恢复后首次采样的%.2f GB无法确定发生的时间，计入合计但不计入每日流量":         "The system was suspended for about %s, the %.2f GB of the first sample after it can't be placed in time, they count towards the total but not the daily usage",
+	"\n\n系统休眠后无法确定时间的流量（已计入合计，未计入每日流量）：下载%.2f GB，上传%.2f GB": "\n\nTraffic after a suspend that can't be placed in time (in the total, not in the daily usage): download %.2f GB, upload %.2f GB",
+	"监控停止：本周期内程序共停止运行%s":                                    "Monitor downtime: the monitor was stopped for %s in this cycle",
+	"，其中%d次期间系统重启过，重启前未采样的流量没有计入，以上统计可能少于服务商的数据":            ", the system rebooted during %d of them, traffic before the reboots wasn't sampled and the figures above may be lower than the provider's",
+	"监控停止约%s，期间网卡计数器增加的%.2f GB已计入统计":                        "The monitor was stopped for about %s, the %.2f GB the counters grew by are counted",
+	"监控停止约%s，期间系统于%s重启，重启后的%.2f GB已计入统计，重启前未采样的流量无法统计":      "The monitor was stopped for about %s, the system rebooted at %s, the %.2f GB since the reboot are counted, traffic before it can't be",
+	"，其中%s之前的%.0f%%按时间比例计入上个周期":                             ", %[2].0f%% of it, the share before %[1]s, went to the last cycle",
+	"网卡%s的读数异常：%s内下载%.2f GB、上传%.2f GB，超过了网卡速率的上限，已从统计中排除":   "Implausible reading of interface %[1]s: download %[3].2f GB and upload %[4].2f GB within %[2]s exceed the link speed, excluded from the totals",
+	"新增监控网卡：%s":              "Now monitoring interfaces: %s",
+	"%s 增加了 %d（当前 %d）":       "%s grew by %d (now %d)",
+	"网卡异常：%s 的错误计数器持续上升\n%s": "Interface problem: the error counters of %s keep rising\n%s",
+	"[监控健康] ":                "[Monitor health] ",
+	"%s已恢复正常":                "%s is working again",
+	"连续%d次%s失败：%v":           "%[2]s failed %[1]d times in a row: %[3]v",
+	"读取网卡统计":                 "Reading interface statistics",
+	"保存统计数据":                 "Saving statistics",
+	"发送消息":                   "Sending messages",
+
+	// Message services
+	"[%s] 流量监控":           "[%s] Traffic monitor",
+	"[%s] 每日汇总 %s（%d条消息）": "[%s] Daily digest %s (%d messages)",
+	"下载":                  "Download",
+	"上传":                  "Upload",
+	"合计":                  "Total",
+	"已使用":                 "Used",
+	"%s **%.1f%%**\n已使用 %.2f GB / %.2f GB": "%s **%.1f%%**\nUsed %.2f GB / %.2f GB",
+
+	// Status page
+	"流量使用情况":                                             "Traffic usage",
+	"<h1>%s 流量使用情况</h1>\n":                               "<h1>%s traffic usage</h1>\n",
+	"<p>统计周期：%s 至 %s，%s重置</p>\n":                         "<p>Cycle: %s to %s, resets %s</p>\n",
+	"<p>统计周期：%s 至今</p>\n":                                "<p>Cycle: since %s</p>\n",
+	"<p style=\"color: #d62728\"><b>关机倒计时：%s</b></p>\n":  "<p style=\"color: #d62728\"><b>Shutdown countdown: %s</b></p>\n",
+	"<p>已使用 %.2f GB / %.2f GB (%.1f%%)，剩余 %.2f GB</p>\n": "<p>Used %.2f GB / %.2f GB (%.1f%%), %.2f GB left</p>\n",
+}
+
+// The text in the configured language, texts without a translation stay in Chinese
+func tr(text string) string {
+	if language == languageEnUS {
+		if translated, ok := englishTexts[text]; ok {
+			return translated
+		}
+	}
+	return text
+}
+
+func validateLanguage(value string) error {
+	switch value {
+	case "", languageZhCN, languageEnUS:
+		return nil
+	}
+	return fmt.Errorf("invalid language: %s, must be %s or %s", value, languageZhCN, languageEnUS)
+}
+
+// Set the language of the built-in messages from the config
+func applyLanguage(config *Config) {
+	language = languageZhCN
+	if config.Language == languageEnUS {
+		language = languageEnUS
+	}
+}
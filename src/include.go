@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The settings each config file took from its include files, they're left out when
+// the program writes the file back
+var configIncludes = make(map[string]*jsonNode)
+
+// The path of an include file, relative ones are next to the config file
+func includePath(configFilePath, include string) string {
+	if filepath.IsAbs(include) {
+		return include
+	}
+	return filepath.Join(filepath.Dir(configFilePath), include)
+}
+
+// Read the include files of a config in order, later files override the earlier ones.
+// https URLs are downloaded, checked against the key when one is set.
+func readIncludes(configFilePath string, includes []string, key ed25519.PublicKey) (*jsonNode, error) {
+	var merged *jsonNode
+	for _, include := range includes {
+		var data []byte
+		var err error
+		if isRemoteInclude(include) {
+			data, err = readRemoteInclude(configFilePath, include, key)
+		} else {
+			data, err = os.ReadFile(includePath(configFilePath, include))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read include %s: %v", include, err)
+		}
+		node, err := parseJSONNode(data)
+		if err != nil || node.kind != '{' {
+			return nil, fmt.Errorf("include %s must be a JSON object: %v", include, err)
+		}
+		if _, ok := node.fields["include"]; ok {
+			return nil, fmt.Errorf("include %s can't include other files", include)
+		}
+		if _, ok := node.fields["include_key"]; ok {
+			return nil, fmt.Errorf("include %s can't set include_key", include)
+		}
+		if merged == nil {
+			merged = node
+		} else {
+			merged = overlayJSONNode(merged, node)
+		}
+	}
+	return merged, nil
+}
+
+// Lay an include over a document: objects are merged key by key, any other value
+// replaces the one below it
+func overlayJSONNode(base, overlay *jsonNode) *jsonNode {
+	if base == nil || base.kind != '{' || overlay.kind != '{' {
+		return overlay
+	}
+	merged := &jsonNode{kind: '{', keys: append([]string(nil), base.keys...), fields: make(map[string]*jsonNode)}
+	for key, child := range base.fields {
+		merged.fields[key] = child
+	}
+	for _, key := range overlay.keys {
+		if _, ok := merged.fields[key]; !ok {
+			merged.keys = append(merged.keys, key)
+		}
+		merged.fields[key] = overlayJSONNode(merged.fields[key], overlay.fields[key])
+	}
+	return merged
+}
+
+// Apply the include files named by the config file's include to its data
+func applyIncludes(configFilePath string, data []byte) ([]byte, error) {
+	var head struct {
+		Include    []string `json:"include"`
+		IncludeKey string   `json:"include_key"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil || len(head.Include) == 0 {
+		delete(configIncludes, configFilePath)
+		return data, nil
+	}
+	key, err := parseIncludeKey(head.IncludeKey)
+	if err != nil {
+		return nil, err
+	}
+	included, err := readIncludes(configFilePath, head.Include, key)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseJSONNode(data)
+	if err != nil {
+		return nil, err
+	}
+	configIncludes[configFilePath] = included
+	var b bytes.Buffer
+	overlayJSONNode(root, included).encode(&b)
+	return b.Bytes(), nil
+}
+
+// Take the included settings out of the content about to be written, the file keeps
+// its own value for them, or doesn't get the key when it had none
+func withoutIncludes(configFilePath string, content, existing []byte) []byte {
+	included := configIncludes[configFilePath]
+	if included == nil {
+		return content
+	}
+	node, err := parseJSONNode(content)
+	if err != nil {
+		return content
+	}
+	original, _ := parseJSONNode(existing)
+	stripIncluded(node, included, original)
+	var compact, indented bytes.Buffer
+	node.encode(&compact)
+	if err := json.Indent(&indented, compact.Bytes(), "", "  "); err != nil {
+		return content
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes()
+}
+
+func stripIncluded(node, included, original *jsonNode) {
+	if node.kind != '{' {
+		return
+	}
+	for _, key := range included.keys {
+		child, ok := node.fields[key]
+		if !ok {
+			continue
+		}
+		var originalChild *jsonNode
+		if original != nil && original.kind == '{' {
+			originalChild = original.fields[key]
+		}
+		if included.fields[key].kind == '{' && child.kind == '{' {
+			stripIncluded(child, included.fields[key], originalChild)
+			continue
+		}
+		if originalChild != nil {
+			node.fields[key] = originalChild
+			continue
+		}
+		delete(node.fields, key)
+		for i, name := range node.keys {
+			if name == key {
+				node.keys = append(node.keys[:i], node.keys[i+1:]...)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set by --debug, synthetic traffic is ignored otherwise so a stray command can't eat a quota
+var debugMode bool
+
+// Parse a byte size such as "1500", "500M", "50G" or "1.5T" (binary units, like the GB in messages)
+func parseSize(value string) (uint64, error) {
+	units := map[byte]float64{'K': sizeBase, 'M': sizeBase * sizeBase, 'G': bytesToGB, 'T': bytesToGB * sizeBase}
+	text := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := 1.0
+	if text != "" {
+		if unit, ok := units[text[len(text)-1]]; ok {
+			multiplier = unit
+			text = text[:len(text)-1]
+		}
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 500M or 50G", value)
+	}
+	return uint64(number * multiplier), nil
+}
+
+// Add synthetic traffic queued by `netmonitor inject`, it goes through the normal
+// accounting so thresholds, summaries and enforcement react as to real traffic
+func injectTraffic(config *Config, command Command) {
+	if !debugMode {
+		logf("Ignored injected traffic, the monitor is not running with --debug\n")
+		return
+	}
+
+	// The WAN is selected through one of its interfaces, like real counters
+	key := ""
+	if command.Wan != "" {
+		for _, wan := range config.Wans {
+			if wan.Name == command.Wan && len(wan.Interfaces) > 0 {
+				key = wan.Interfaces[0]
+			}
+		}
+		if key == "" {
+			logf("Ignored injected traffic for unknown wan %s\n", command.Wan)
+			return
+		}
+	}
+
+	paused := accountingPaused(config, time.Now())
+	addTraffic(config, key, command.Receive, command.Transmit, paused)
+
+	detail := fmt.Sprintf(tr("注入测试流量：下载%.2f GB，上传%.2f GB"), float64(command.Receive)/bytesToGB, float64(command.Transmit)/bytesToGB)
+	if command.Wan != "" {
+		detail += tr("，线路") + command.Wan
+	}
+	if command.Reason != "" {
+		detail += "，" + command.Reason
+	}
+	addEvent(config, eventAnnotation, time.Now(), time.Time{}, detail)
+	logf("Injected synthetic traffic: %d bytes received, %d bytes transmitted\n", command.Receive, command.Transmit)
+}
+
+// netmonitor inject --rx 50G --tx 1G [--wan lte] [--reason "threshold test"]
+func runInjectCommand(args []string) int {
+	flags := flag.NewFlagSet("inject", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	rx := flags.String("rx", "0", "Synthetic download traffic, e.g. 50G")
+	tx := flags.String("tx", "0", "Synthetic upload traffic, e.g. 1G")
+	wan := flags.String("wan", "", "Attribute the traffic to this WAN")
+	reason := flags.String("reason", "", "Note recorded in the history")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	receive, err := parseSize(*rx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	transmit, err := parseSize(*tx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if receive == 0 && transmit == 0 {
+		fmt.Fprintln(os.Stderr, "usage: netmonitor inject --rx size --tx size [--wan name] [--reason text]")
+		return exitUsage
+	}
+
+	command := Command{Action: actionInject, Receive: receive, Transmit: transmit, Wan: *wan, Reason: *reason}
+	if err := queueCommand(*configFilePath, command); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue injected traffic: %v\n", err)
+		return exitFailure
+	}
+	fmt.Println("Synthetic traffic queued, it is only applied by a monitor running with --debug")
+	return exitOK
+}
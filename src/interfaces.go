@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Aggregation modes for stacked devices (bond, bridge, VLAN)
+const (
+	aggregateLogical  = "logical"  // 统计bond/bridge等逻辑网卡，忽略其成员网卡
+	aggregatePhysical = "physical" // 统计逻辑网卡下的物理成员网卡
+)
+
+// List the devices stacked directly below iface (bond slaves, bridge ports, VLAN parent)
+func lowerDevices(iface string) []string {
+	seen := make(map[string]bool)
+	var lowers []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			lowers = append(lowers, name)
+		}
+	}
+
+	base := filepath.Join("/sys/class/net", iface)
+
+	// lower_<dev> links exist for bonds, bridges, VLANs and macvlans
+	links, _ := filepath.Glob(filepath.Join(base, "lower_*"))
+	for _, link := range links {
+		add(strings.TrimPrefix(filepath.Base(link), "lower_"))
+	}
+
+	// Older kernels only expose the bridge ports and bond slaves
+	ports, _ := os.ReadDir(filepath.Join(base, "brif"))
+	for _, port := range ports {
+		add(port.Name())
+	}
+	if data, err := os.ReadFile(filepath.Join(base, "bonding", "slaves")); err == nil {
+		for _, slave := range strings.Fields(string(data)) {
+			add(slave)
+		}
+	}
+
+	sort.Strings(lowers)
+	return lowers
+}
+
+// Collect every device below iface, recursively
+func allLowerDevices(iface string, found map[string]bool) {
+	for _, lower := range lowerDevices(iface) {
+		if found[lower] {
+			continue
+		}
+		found[lower] = true
+		allLowerDevices(lower, found)
+	}
+}
+
+// Expand a device into its leaf members, a device without members is its own leaf
+func physicalMembers(iface string) []string {
+	lowers := lowerDevices(iface)
+	if len(lowers) == 0 {
+		return []string{iface}
+	}
+	var members []string
+	for _, lower := range lowers {
+		members = append(members, physicalMembers(lower)...)
+	}
+	return members
+}
+
+// Check whether an interface name is a glob pattern such as "wg*" or "veth*@pid:1234"
+func isInterfacePattern(spec string) bool {
+	name, _ := splitInterface(spec)
+	return strings.ContainsAny(name, "*?[")
+}
+
+// Check whether any configured interface is a pattern that needs rescanning
+func hasInterfacePatterns(config *Config) bool {
+	if isInterfacePattern(config.Interface) {
+		return true
+	}
+	for _, iface := range config.Interfaces {
+		if isInterfacePattern(iface) {
+			return true
+		}
+	}
+	if config.Collector.Type == "" {
+		for _, iface := range wanInterfaces(config) {
+			if isInterfacePattern(iface) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Expand a pattern against the interfaces currently present in its namespace
+func expandInterfacePattern(spec string) []string {
+	pattern, netns := splitInterface(spec)
+	table, err := readNamespaceStats(netns)
+	if err != nil {
+		logf("Failed to list interfaces for pattern %s: %v\n", spec, err)
+		return nil
+	}
+
+	var matches []string
+	for name := range table {
+		if name == "lo" {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, name); !matched {
+			continue
+		}
+		if netns != "" {
+			name += "@" + netns
+		}
+		matches = append(matches, name)
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// Resolve the configured interfaces into the set of devices to account, so that bytes
+// passing through a bond/bridge/VLAN and its members are never counted twice.
+// The members left out are returned separately.
+func resolveInterfaces(config *Config) (resolved, skipped []string) {
+	var configured []string
+	if config.Interface != "" {
+		configured = append(configured, config.Interface)
+	}
+	configured = append(configured, config.Interfaces...)
+	// With a collector the WAN interfaces name its counters instead
+	if config.Collector.Type == "" {
+		configured = append(configured, wanInterfaces(config)...)
+	}
+
+	seen := make(map[string]bool)
+	var candidates []string
+	for _, spec := range configured {
+		ifaces := []string{spec}
+		if isInterfacePattern(spec) {
+			ifaces = expandInterfacePattern(spec)
+		}
+
+		var names []string
+		for _, iface := range ifaces {
+			if config.Aggregation == aggregatePhysical {
+				names = append(names, physicalMembers(iface)...)
+			} else {
+				names = append(names, iface)
+			}
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	// Drop every device that is a member of another monitored device
+	below := make(map[string]bool)
+	for _, iface := range candidates {
+		allLowerDevices(iface, below)
+	}
+	for _, iface := range candidates {
+		if below[iface] {
+			skipped = append(skipped, iface)
+			continue
+		}
+		resolved = append(resolved, iface)
+	}
+	return resolved, skipped
+}
+
+// Re-resolve the interface patterns, announce interfaces that appeared and forget the
+// counters of those that are gone, a recreated device starts counting from zero
+func rescanInterfaces(config *Config, current []string) []string {
+	resolved, _ := resolveInterfaces(config)
+
+	known := make(map[string]bool)
+	for _, iface := range current {
+		known[iface] = true
+	}
+	present := make(map[string]bool)
+	var added []string
+	for _, iface := range resolved {
+		present[iface] = true
+		if !known[iface] {
+			added = append(added, iface)
+		}
+	}
+
+	for _, iface := range current {
+		if !present[iface] {
+			logf("Interface %s disappeared, removed from monitoring\n", iface)
+			delete(config.Statistics.Counters, iface)
+		}
+	}
+
+	if len(added) > 0 {
+		logf("New interfaces added to monitoring: %s\n", strings.Join(added, ", "))
+		if config.NotifyInterfaces {
+			err := sendMessage(config, fmt.Sprintf(tr("新增监控网卡：%s"), strings.Join(added, ", ")))
+			reportHealth(config, healthSend, err)
+			if err != nil {
+				logf("Failed to send new interface message: %v\n", err)
+			}
+		}
+	}
+
+	return resolved
+}
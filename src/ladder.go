@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Actions of the enforcement ladder's rungs
+const (
+	rungLimit    = "limit"    // shape the interfaces' bandwidth with tc
+	rungBlock    = "block"    // drop all TCP/UDP but the allowed ports with nftables
+	rungShutdown = "shutdown" // power off like the ratio does
+)
+
+// nftables table of the block rung, separate from the port accounting table
+const nftLadderTable = "netmonitor_ladder"
+
+type LadderRung struct {
+	At     float64  `json:"at"`     // 达到限额的比例，例如0.9
+	Action string   `json:"action"` // limit：限速，block：只放行allow中的端口，shutdown：关机
+	Rate   string   `json:"rate"`   // limit的速度，例如"10mbit"，上传和下载分别限制
+	Allow  []string `json:"allow"`  // block时仍放行的端口，例如["22", "53"]
+}
+
+// The rungs applied in the current period, kept so they are reversed at the reset
+// and applied again after a restart
+type LadderState struct {
+	Step       int      `json:"step"`                // 已执行的级数
+	Interfaces []string `json:"interfaces"`          // 限速和屏蔽所在的网卡
+	SafeMode   bool     `json:"safe_mode,omitempty"` // 是否执行了safe_mode
+}
+
+var tcRate = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(bit|kbit|mbit|gbit)$`)
+
+// Check the rungs, they must go up in order
+func validateLadder(ladder []LadderRung) error {
+	for i, rung := range ladder {
+		if rung.At <= 0 {
+			return fmt.Errorf("invalid at of ladder rung %d: %.2f", i+1, rung.At)
+		}
+		if i > 0 && rung.At <= ladder[i-1].At {
+			return fmt.Errorf("ladder rungs must be in increasing order of at")
+		}
+		switch rung.Action {
+		case rungLimit:
+			if !tcRate.MatchString(rung.Rate) {
+				return fmt.Errorf("invalid rate of ladder rung %d: %q, use e.g. 10mbit", i+1, rung.Rate)
+			}
+		case rungBlock:
+			for _, port := range rung.Allow {
+				if !portPattern.MatchString(port) {
+					return fmt.Errorf("invalid allowed port %q of ladder rung %d", port, i+1)
+				}
+			}
+		case rungShutdown:
+		default:
+			return fmt.Errorf("invalid action of ladder rung %d: %s, must be limit, block or shutdown", i+1, rung.Action)
+		}
+	}
+	return nil
+}
+
+// The interfaces in the host namespace, tc and nftables can't reach the others
+func hostInterfaces(ifaces []string) []string {
+	var host []string
+	for _, iface := range ifaces {
+		if name, netns := splitInterface(iface); netns == "" {
+			host = append(host, name)
+		}
+	}
+	return host
+}
+
+// Shape both directions: tbf for the egress, a policer on the ingress qdisc
+func applyRateLimit(ifaces []string, rate string) error {
+	if !commandExists("tc") {
+		return fmt.Errorf("tc command not found")
+	}
+	for _, iface := range ifaces {
+		commands := [][]string{
+			{"qdisc", "replace", "dev", iface, "root", "tbf", "rate", rate, "burst", "64kb", "latency", "400ms"},
+			{"qdisc", "del", "dev", iface, "ingress"},
+			{"qdisc", "add", "dev", iface, "handle", "ffff:", "ingress"},
+			{"filter", "add", "dev", iface, "parent", "ffff:", "protocol", "all", "u32", "match", "u32", "0", "0",
+				"police", "rate", rate, "burst", "256kb", "drop", "flowid", ":1"},
+		}
+		for i, args := range commands {
+			output, err := exec.Command("tc", args...).CombinedOutput()
+			// Deleting the ingress qdisc fails when there is none yet
+			if err != nil && i != 1 {
+				return fmt.Errorf("failed to limit %s: %v: %s", iface, err, strings.TrimSpace(string(output)))
+			}
+		}
+	}
+	return nil
+}
+
+// Drop TCP and UDP on the interfaces unless either port is allowed, ICMP still passes
+func applyPortBlock(ifaces, allow []string) error {
+	if !commandExists("nft") {
+		return fmt.Errorf("nft command not found")
+	}
+	var quoted []string
+	for _, iface := range ifaces {
+		quoted = append(quoted, fmt.Sprintf("%q", iface))
+	}
+	ifaceSet := "{ " + strings.Join(quoted, ", ") + " }"
+	match := "meta l4proto { tcp, udp }"
+	if len(allow) > 0 {
+		ports := "{ " + strings.Join(allow, ", ") + " }"
+		match += fmt.Sprintf(" th sport != %s th dport != %s", ports, ports)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n", nftLadderTable, nftLadderTable)
+	fmt.Fprintf(&b, "table inet %s {\n", nftLadderTable)
+	for _, chain := range []struct{ name, matches string }{
+		{"input", "iifname"},
+		{"output", "oifname"},
+		{"forward", "iifname oifname"},
+	} {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %s priority 0; policy accept;\n", chain.name, chain.name)
+		for _, side := range strings.Fields(chain.matches) {
+			fmt.Fprintf(&b, "\t\t%s %s %s drop\n", side, ifaceSet, match)
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(b.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to block ports: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Apply a limit or block rung, shutdown is left to the caller
+func applyRung(rung LadderRung, ifaces []string) error {
+	if len(ifaces) == 0 {
+		return fmt.Errorf("no monitored interface in the host namespace")
+	}
+	switch rung.Action {
+	case rungLimit:
+		return applyRateLimit(ifaces, rung.Rate)
+	case rungBlock:
+		return applyPortBlock(ifaces, rung.Allow)
+	}
+	return nil
+}
+
+// Describe a rung for its notification
+func describeRung(rung LadderRung) string {
+	switch rung.Action {
+	case rungLimit:
+		return fmt.Sprintf(tr("网卡速度限制为%s"), rung.Rate)
+	case rungBlock:
+		if len(rung.Allow) == 0 {
+			return tr("屏蔽所有TCP/UDP端口")
+		}
+		return fmt.Sprintf(tr("屏蔽除%s以外的TCP/UDP端口"), strings.Join(rung.Allow, "、"))
+	}
+	return tr("即将关机！")
+}
+
+// Climb the ladder to the highest rung the usage reached, each new rung is applied
+// and notified once per period
+func checkLadder(config *Config, configFilePath string, ifaces []string) {
+	limit := effectiveLimit(config)
+	if len(config.Ladder) == 0 || limit <= 0 {
+		return
+	}
+	state := config.Statistics.Ladder
+	if state == nil {
+		state = &LadderState{}
+	}
+	value := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+	if state.Step >= len(config.Ladder) || value < limit*config.Ladder[state.Step].At {
+		return
+	}
+	if !enforcementAllowed(config, "ladder", tr("分级限制")) {
+		return
+	}
+
+	host := hostInterfaces(ifaces)
+	shutdown, shutdownAt := "", time.Time{}
+	for state.Step < len(config.Ladder) && value >= limit*config.Ladder[state.Step].At {
+		rung := config.Ladder[state.Step]
+		state.Step++
+		// Recorded first, a rung that fails halfway is still removed at the reset
+		state.Interfaces = host
+		notice := ""
+		if rung.Action == rungShutdown {
+			shutdown = fmt.Sprintf(tr("分级限制达到限额的%.0f%%"), rung.At*100)
+			shutdownAt, notice = shutdownNotice(config)
+		} else if err := applyRung(rung, host); err != nil {
+			logf("Failed to apply ladder rung %d: %v\n", state.Step, err)
+			continue
+		}
+
+		message := fmt.Sprintf(tr("分级限制：当前使用量 %.2f GB，达到限额的%.0f%%，%s"), value, rung.At*100, describeRung(rung)+notice)
+		addEvent(config, eventEnforcement, time.Now(), time.Time{}, message)
+		err := sendMessage(config, message+alertLink(config, time.Now()))
+		reportHealth(config, healthSend, err)
+		if err != nil {
+			logf("Failed to send ladder message: %v\n", err)
+		}
+		logf("Ladder rung %d applied at %.0f%%: %s\n", state.Step, rung.At*100, rung.Action)
+	}
+	config.Statistics.Ladder = state
+	if shutdown != "" {
+		scheduleShutdown(config, shutdownLadder, shutdown, shutdownAt)
+	}
+
+	err := saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save config after ladder rung: %v\n", err)
+	}
+}
+
+// Apply the rungs reached before a restart again, tc and nftables don't survive a
+// reboot. Shutdown rungs aren't repeated.
+func restoreLadder(config *Config) {
+	state := config.Statistics.Ladder
+	if state == nil {
+		return
+	}
+	for i := 0; i < state.Step && i < len(config.Ladder); i++ {
+		if config.Ladder[i].Action == rungShutdown {
+			continue
+		}
+		if err := applyRung(config.Ladder[i], state.Interfaces); err != nil {
+			logf("Failed to restore ladder rung %d: %v\n", i+1, err)
+		}
+	}
+	if state.Step > 0 {
+		logf("Restored %d ladder rungs\n", state.Step)
+	}
+}
+
+// Remove the limits and blocks of the period, called at the reset
+func releaseLadder(config *Config) {
+	state := config.Statistics.Ladder
+	if state == nil {
+		return
+	}
+	for _, iface := range state.Interfaces {
+		exec.Command("tc", "qdisc", "del", "dev", iface, "root").Run()
+		exec.Command("tc", "qdisc", "del", "dev", iface, "ingress").Run()
+	}
+	exec.Command("nft", "delete", "table", "inet", nftLadderTable).Run()
+	config.Statistics.Ladder = nil
+	logf("Ladder rungs released\n")
+}
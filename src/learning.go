@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The observation period after the first start, kept across resets
+type LearningState struct {
+	Started  string `json:"started"`            // 观察期开始的时间，RFC3339格式
+	Finished bool   `json:"finished,omitempty"` // 观察期已结束
+
+	// 观察期内每个网卡的错误计数器单次采样的最大增量，之后不超过它的增加不再提醒
+	NicIncrease map[string]map[string]uint64 `json:"nic_increase,omitempty"`
+}
+
+// Start the observation period on the first run with learning_hours set
+func startLearning(config *Config, now time.Time) {
+	if config.LearningHours <= 0 || config.Statistics.Learning != nil {
+		return
+	}
+	config.Statistics.Learning = &LearningState{Started: now.Format(time.RFC3339)}
+	logf("Observation period started, anomaly alerts are only logged for the first %d hours\n", config.LearningHours)
+}
+
+// Whether the anomaly rules only observe, their alerts are logged instead of sent
+func learning(config *Config, now time.Time) bool {
+	state := config.Statistics.Learning
+	if config.LearningHours <= 0 || state == nil || state.Finished {
+		return false
+	}
+	started, err := time.Parse(time.RFC3339, state.Started)
+	if err != nil || now.Sub(started) >= time.Duration(config.LearningHours)*time.Hour {
+		state.Finished = true
+		logf("Observation period over, NIC baseline: %s\n", describeNicBaseline(state))
+		return false
+	}
+	return true
+}
+
+// Remember the largest increase of a NIC counter seen while learning
+func learnNicIncrease(config *Config, iface, name string, increase uint64) {
+	state := config.Statistics.Learning
+	if state.NicIncrease == nil {
+		state.NicIncrease = make(map[string]map[string]uint64)
+	}
+	if state.NicIncrease[iface] == nil {
+		state.NicIncrease[iface] = make(map[string]uint64)
+	}
+	state.NicIncrease[iface][name] = max(state.NicIncrease[iface][name], increase)
+}
+
+// The increase a NIC counter showed during the observation period
+func nicBaseline(config *Config, iface, name string) uint64 {
+	if state := config.Statistics.Learning; state != nil {
+		return state.NicIncrease[iface][name]
+	}
+	return 0
+}
+
+func describeNicBaseline(state *LearningState) string {
+	var parts []string
+	for iface, counters := range state.NicIncrease {
+		for name, increase := range counters {
+			if increase > 0 {
+				parts = append(parts, fmt.Sprintf("%s %s +%d", iface, name, increase))
+			}
+		}
+	}
+	if len(parts) == 0 {
+		return "no rising counters"
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Days shown on each side of the spike an alert links to
+const spikeContext = 3
+
+// A link into the dashboard, through public_url behind a reverse proxy or the listen address
+func dashboardURL(config *Config, path string) string {
+	if config.HTTP.PublicURL != "" {
+		return strings.TrimRight(config.HTTP.PublicURL, "/") + path
+	}
+	host := config.HTTP.Listen
+	if name, port, err := net.SplitHostPort(host); err == nil && (name == "" || name == "0.0.0.0" || name == "::") {
+		name, _ = os.Hostname()
+		host = net.JoinHostPort(name, port)
+	}
+	return "http://" + host + path
+}
+
+// The first day of the current period
+func periodStart(config *Config, now time.Time) time.Time {
+	start, err := time.ParseInLocation("2006-01-02", lastResetDate(config), time.Local)
+	if err != nil {
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	return start
+}
+
+// A line pointing at the dashboard chart zoomed to the busiest day of the period, empty
+// when the dashboard is off
+func alertLink(config *Config, now time.Time) string {
+	if config.HTTP.Listen == "" {
+		return ""
+	}
+	start := periodStart(config, now)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	spike, peak := "", uint64(0)
+	for _, day := range config.History.Days {
+		if day.Date >= lastResetDate(config) && day.Receive+day.Transmit > peak {
+			spike, peak = day.Date, day.Receive+day.Transmit
+		}
+	}
+	spikeDay, err := time.ParseInLocation("2006-01-02", spike, time.Local)
+	if err != nil {
+		return tr("\n详情：") + dashboardURL(config, "/")
+	}
+	from := spikeDay.AddDate(0, 0, -spikeContext)
+	if from.Before(start) {
+		from = start
+	}
+	to := spikeDay.AddDate(0, 0, spikeContext)
+	if to.After(today) {
+		to = today
+	}
+	query := url.Values{
+		"from":  {from.Format("2006-01-02")},
+		"to":    {to.Format("2006-01-02")},
+		"focus": {spike},
+	}
+	return fmt.Sprintf(tr("\n详情：%s"), dashboardURL(config, "/?"+query.Encode()))
+}
@@ -0,0 +1,24 @@
+package main
+
+import "runtime/debug"
+
+// Limits of the --low-memory profile, for OpenWrt devices with 64–128 MB of RAM
+const (
+	lowMemoryCommands  = 16      // commands applied per sample, further ones are dropped
+	lowMemoryTemplates = 64      // NetFlow v9/IPFIX templates kept by the flow collector
+	lowMemorySflow     = 16      // sFlow agents tracked by the flow collector
+	lowMemoryGCPercent = 20      // collect garbage sooner, trading CPU for a smaller heap
+	lowMemoryLimit     = 8 << 20 // soft limit of the Go heap in bytes
+)
+
+var lowMemory bool
+
+// Tune the runtime for the low memory profile
+func applyLowMemory() {
+	if !lowMemory {
+		return
+	}
+	debug.SetGCPercent(lowMemoryGCPercent)
+	debug.SetMemoryLimit(lowMemoryLimit)
+	logf("Low memory mode: history disabled, queues capped\n")
+}
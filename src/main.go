@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"flag"
@@ -9,7 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 )
@@ -24,7 +23,72 @@ type Statistics struct {
 	TotalTransmit uint64 `json:"total_transmit"`
 	LastReceive   uint64 `json:"last_receive"`
 	LastTransmit  uint64 `json:"last_transmit"`
-	LastReset     string `json:"last_reset"` // 新增字段，用于存储上次重置的时间
+	LastReset     string `json:"last_reset"` // 上次重置的时间，RFC3339格式，旧版本写入的日期也能读取
+
+	// 每个网卡上次读取的计数器，last_receive/last_transmit为它们的合计
+	Counters map[string]NetStats `json:"counters,omitempty"`
+
+	// 上次读取计数器的时间，启动时据此核对监控停止期间的流量
+	LastSample string `json:"last_sample,omitempty"`
+
+	// 暂停统计期间排除的流量，不计入total
+	ExcludedReceive  uint64      `json:"excluded_receive,omitempty"`
+	ExcludedTransmit uint64      `json:"excluded_transmit,omitempty"`
+	Pause            *PauseState `json:"pause,omitempty"`
+
+	// 系统休眠后首次采样的流量，计入total，但无法确定发生的时间，不计入每日流量和热力图
+	UnattributedReceive  uint64 `json:"unattributed_receive,omitempty"`
+	UnattributedTransmit uint64 `json:"unattributed_transmit,omitempty"`
+
+	// 程序自身发送消息产生的流量，exclude_self为true时不计入total
+	SelfReceive  uint64 `json:"self_receive,omitempty"`
+	SelfTransmit uint64 `json:"self_transmit,omitempty"`
+
+	// 按端口分类统计的流量
+	PortClasses map[string]NetStats `json:"port_classes,omitempty"`
+
+	// 已提醒过的持续上升的网卡计数器，按网卡保存，停止上升后清除，再次上升时重新提醒
+	NicRising map[string][]string `json:"nic_rising,omitempty"`
+
+	// 每条线路的流量和提醒状态
+	Wans map[string]WanStats `json:"wans,omitempty"`
+
+	// 预付费模式下累计充值的流量（GB），余额为它减去已使用的流量
+	PrepaidGB float64 `json:"prepaid_gb,omitempty"`
+
+	// 从上个周期结转到本周期的流量（GB），计入本周期的限额
+	RolloverGB float64 `json:"rollover_gb,omitempty"`
+
+	// 本周期已执行的分级限制
+	Ladder *LadderState `json:"ladder,omitempty"`
+
+	// 安装后的观察期，重置时保留
+	Learning *LearningState `json:"learning,omitempty"`
+
+	// 本周期因超限关机的时间，之后开机时进入安全模式
+	ShutdownAt string `json:"shutdown_at,omitempty"`
+
+	// 已发送安全模式通知的关机时间，之后每次开机只重新执行限制，不再通知
+	SafeModeNotified string `json:"safe_mode_notified,omitempty"`
+
+	// 正在倒计时或已取消的关机
+	Shutdown *ShutdownCountdown `json:"shutdown,omitempty"`
+
+	// 本周期内监控程序停止运行的时间段
+	Downtime []DowntimeGap `json:"downtime,omitempty"`
+
+	// 周期摘要发送失败、推迟重置的开始时间，此时本周期已存入history
+	ResetPending string `json:"reset_pending,omitempty"`
+
+	// 本周期上次发送阈值提醒或重复提醒的时间
+	Reminded string `json:"reminded,omitempty"`
+
+	// 上次定期自检的结果，重置时保留
+	SelfTest *SelfTestResult `json:"self_test,omitempty"`
+
+	// 本周期首次达到threshold和ratio的时间
+	ThresholdReached string `json:"threshold_reached,omitempty"`
+	RatioReached     string `json:"ratio_reached,omitempty"`
 }
 
 type Comparison struct {
@@ -32,13 +96,32 @@ type Comparison struct {
 	Limit     float64 `json:"limit"`     // 上限值
 	Threshold float64 `json:"threshold"` // 阈值
 	Ratio     float64 `json:"ratio"`     // 比率
+
+	// 未用完的流量结转到下个周期的上限（GB），0表示不结转
+	RolloverCap float64 `json:"rollover_cap,omitempty"`
+
+	// 为true时关机提醒送达后才关机，发送失败时下次采样重试；默认发送失败也照常关机
+	RequireNotice bool `json:"require_notice,omitempty"`
+
+	// 为true时从统计中扣除程序自身发送消息产生的流量
+	ExcludeSelf bool `json:"exclude_self,omitempty"`
+
+	// 用量达到限额的该比例后减少程序自身的流量，0表示达到ratio时
+	ConserveAt float64 `json:"conserve_at,omitempty"`
+
+	// 超过阈值后每隔多少小时重复提醒一次，附带当前用量，0表示只提醒一次
+	Remind int `json:"remind,omitempty"`
 }
 
 type TelegramMessage struct {
-	ThresholdStatus bool   `json:"threshold_status"`
-	RatioStatus     bool   `json:"ratio_status"`
-	Token           string `json:"token"`
-	ChatID          string `json:"chat_id"`
+	ThresholdStatus bool     `json:"threshold_status"`
+	RatioStatus     bool     `json:"ratio_status"`
+	Token           string   `json:"token"`
+	ChatID          string   `json:"chat_id"`
+	ChatIDs         []string `json:"chat_ids,omitempty"`          // 同时发送到的其他聊天，有一个收到就算发送成功
+	ParseMode       string   `json:"parse_mode,omitempty"`        // HTML或MarkdownV2，首行加粗、列表显示为圆点，为空时发送纯文本
+	ThreadID        int      `json:"message_thread_id,omitempty"` // 论坛群组中发送到的话题ID，对所有聊天生效
+	Silent          bool     `json:"silent,omitempty"`            // 为true时周期摘要及其附件静默发送，不发出提示音
 }
 
 type GotifyMessage struct {
@@ -48,45 +131,356 @@ type GotifyMessage struct {
 	AppToken        string `json:"app_token"`
 }
 
+type DiscordMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	WebhookURL      string `json:"webhook_url"` // 频道设置中创建的Webhook地址
+}
+
+type SlackMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	WebhookURL      string `json:"webhook_url"` // Incoming Webhook地址，设置后不使用token和channel
+	Token           string `json:"token"`       // Bot令牌，xoxb-开头
+	Channel         string `json:"channel"`     // Bot发送消息的频道ID或名称
+}
+
+type MockMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	File            string `json:"file"` // 消息写入的文件，为空时输出到标准输出
+}
+
 type Message struct {
-	Service  string          `json:"service"`
-	Telegram TelegramMessage `json:"telegram"`
-	Gotify   GotifyMessage   `json:"gotify"`
+	Service    string            `json:"service"`
+	Services   []string          `json:"services,omitempty"` // 同时发送的其他消息服务，每个服务单独记录提醒状态
+	Telegram   TelegramMessage   `json:"telegram"`
+	Gotify     GotifyMessage     `json:"gotify"`
+	Discord    DiscordMessage    `json:"discord"`
+	Slack      SlackMessage      `json:"slack"`
+	Email      EmailMessage      `json:"email"`
+	Webhook    WebhookMessage    `json:"webhook"`
+	Ntfy       NtfyMessage       `json:"ntfy"`
+	Pushover   PushoverMessage   `json:"pushover"`
+	Bark       BarkMessage       `json:"bark"`
+	ServerChan ServerChanMessage `json:"serverchan"`
+	DingTalk   DingTalkMessage   `json:"dingtalk"`
+	WeCom      WeComMessage      `json:"wecom"`
+	Feishu     FeishuMessage     `json:"feishu"`
+	Matrix     MatrixMessage     `json:"matrix"`
+	Teams      TeamsMessage      `json:"teams"`
+	Mock       MockMessage       `json:"mock"`
+
+	// 单条消息的最大字符数，超过时拆分成多条发送，0表示使用消息服务的限制（Telegram为4096）
+	MaxLength int `json:"max_length,omitempty"`
+
+	// 按消息类型（threshold、ratio、summary、error）指定发送的服务，未指定的类型发给service和services
+	Routes map[string][]string `json:"routes,omitempty"`
+
+	// 按消息服务（或default）指定连接使用的地址族，用于只有IPv6的主机
+	Network map[string]NetworkOptions `json:"network,omitempty"`
+
+	// 免打扰时段，例如"23:00-08:00"，期间阈值提醒和周期摘要推迟到时段结束后发送，关机警告不受影响
+	QuietHours string `json:"quiet_hours,omitempty"`
+
+	// 定期自检的时间，cron格式，例如"0 10 * * 1"表示每周一10点按阈值提醒的路由发送一条测试提醒
+	SelfTest string `json:"self_test,omitempty"`
+
+	// 阈值提醒的冷却时间（小时），这段时间内发送过的提醒不再发送，即使配置文件被重置
+	Cooldown int `json:"cooldown,omitempty"`
+
+	// 每小时最多发送的消息数（每个服务的每条消息都计数），超过时暂缓发送，0表示默认的30条，负数表示不限制
+	Burst int `json:"burst,omitempty"`
+
+	// 发送失败、等待重试的消息，由程序维护
+	Outbox []OutboxEntry `json:"outbox,omitempty"`
+}
+
+type Health struct {
+	Notify       bool `json:"notify"`        // 是否通过消息服务发送监控健康事件
+	ReadFailures int  `json:"read_failures"` // 连续读取网卡失败的次数
+	SaveFailures int  `json:"save_failures"` // 连续保存统计数据失败的次数
+	SendFailures int  `json:"send_failures"` // 连续发送消息失败的次数
 }
 
 type Config struct {
-	Device     string     `json:"device"`
-	Interface  string     `json:"interface"`
-	Interval   int        `json:"interval"`
-	StartDay   int        `json:"start_day"` // 统计起始日期
-	Statistics Statistics `json:"statistics"`
-	Comparison Comparison `json:"comparison"`
-	Message    Message    `json:"message"`
+	Device           string              `json:"device"`
+	Interface        string              `json:"interface"`
+	Interfaces       []string            `json:"interfaces"`        // 额外监控的网卡
+	Aggregation      string              `json:"aggregation"`       // bond/bridge/VLAN的统计方式：logical或physical
+	NotifyInterfaces bool                `json:"notify_interfaces"` // 发现新的匹配网卡时是否发送消息
+	Interval         int                 `json:"interval"`
+	StartDay         int                 `json:"start_day"` // 统计起始日期
+	Statistics       Statistics          `json:"statistics"`
+	Comparison       Comparison          `json:"comparison"`
+	Message          Message             `json:"message"`
+	Health           Health              `json:"health"`
+	NicHealth        NicHealth           `json:"nic_health"`
+	History          History             `json:"history"`
+	Clock            ClockCheck          `json:"clock"`
+	PortAccounting   PortAccounting      `json:"port_accounting"`
+	Collector        CollectorConfig     `json:"collector"`
+	Wans             []Wan               `json:"wans"`               // 多线路时每条线路的独立限额
+	Maintenance      []MaintenanceWindow `json:"maintenance"`        // 维护窗口，窗口内只提醒不执行关机等处理
+	Timezone         string              `json:"timezone"`           // 计费周期使用的时区，例如"Asia/Shanghai"，为空时使用系统时区
+	HTTP             HTTPConfig          `json:"http"`               // 网页面板
+	BillingCalendar  string              `json:"billing_calendar"`   // 计费周期日历，ICS文件路径或URL，设置后按日历中事件的日期重置统计，不再使用start_day
+	Prepaid          bool                `json:"prepaid"`            // 预付费模式：不按周期重置，限额为累计充值的流量
+	Plan             string              `json:"plan,omitempty"`     // 服务商套餐预设，例如"hetzner-cloud"，补全未填写的category、unit和start_day
+	Unit             string              `json:"unit,omitempty"`     // 流量单位，GiB（1024进制，默认）或GB（1000进制）
+	Language         string              `json:"language,omitempty"` // 内置消息的语言，zh-CN（默认）或en-US
+	Ladder           []LadderRung        `json:"ladder,omitempty"`   // 分级限制，按达到限额的比例依次限速、屏蔽端口或关机，重置时解除
+
+	// 超限关机后在同一周期内开机时执行的限制，格式与ladder的一级相同，action只能是limit或block
+	SafeMode *LadderRung `json:"safe_mode,omitempty"`
+
+	// 超限后到关机的倒计时秒数，默认30秒，倒计时期间可以取消
+	ShutdownDelay int `json:"shutdown_delay,omitempty"`
+
+	// 为true时不按网卡速率检查读数，超过速率上限的异常增量也计入统计
+	IgnoreLinkSpeed bool `json:"ignore_link_speed,omitempty"`
+
+	// 首次运行后的观察期（小时），期间网卡健康等异常提醒只写入日志，并记录正常的波动作为基准
+	LearningHours int `json:"learning_hours,omitempty"`
+
+	// 使用场景预设，例如"vps-quota"，补全未填写的提醒、分级限制和关机规则
+	Profile string `json:"profile,omitempty"`
+
+	// 读取时合并的其他配置文件，例如存放令牌的secrets.json，后面的文件覆盖前面的；
+	// 相对路径以配置文件所在目录为准，也可以是https地址，这些文件中的设置不会被写回配置文件
+	Include []string `json:"include,omitempty"`
+
+	// 远程附加文件的签名公钥（Ed25519，base64），设置后https地址的附加文件必须有匹配的.sig签名
+	IncludeKey string `json:"include_key,omitempty"`
+
+	// 不保存：关机警告等不能等待的消息，发送时由sendUrgentMessage设置
+	urgent bool
+
+	// 不保存：周期摘要等例行消息，发送时由sendRoutedMessage设置
+	routine bool
 }
 
-const bytesToGB = 1024 * 1024 * 1024
+// Buffer reused by every read of /proc/net/dev, the monitor samples from a single goroutine
+var netDevBuffer bytes.Buffer
 
-// Read the /proc/net/dev file to get network statistics for a specific interface
+// Read a /proc/net/dev style file to get network statistics for all interfaces
+func readNetDev(path string) (map[string]NetStats, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	netDevBuffer.Reset()
+	if _, err := netDevBuffer.ReadFrom(file); err != nil {
+		return nil, err
+	}
+	return parseNetDev(netDevBuffer.Bytes()), nil
+}
+
+// Parse the /proc/net/dev format. Only the two byte counters are decoded, in place,
+// so a sample allocates little more than the resulting map.
+func parseNetDev(data []byte) map[string]NetStats {
+	stats := make(map[string]NetStats)
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+
+		// Large counters follow the colon without a space, so split on it first
+		name, counters, found := bytes.Cut(line, []byte(":"))
+		if !found {
+			continue
+		}
+		receiveBytes, ok1 := netDevField(counters, 0)
+		transmitBytes, ok2 := netDevField(counters, 8)
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		stats[string(bytes.TrimSpace(name))] = NetStats{ReceiveBytes: receiveBytes, TransmitBytes: transmitBytes}
+	}
+	return stats
+}
+
+// Decode the n-th whitespace separated counter of a /proc/net/dev line
+func netDevField(counters []byte, n int) (uint64, bool) {
+	field := -1
+	inField := false
+	var value uint64
+	for _, c := range counters {
+		if c == ' ' || c == '\t' {
+			if inField && field == n {
+				return value, true
+			}
+			inField = false
+			continue
+		}
+		if !inField {
+			inField = true
+			field++
+		}
+		if field == n {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+			value = value*10 + uint64(c-'0')
+		}
+	}
+	return value, inField && field == n
+}
+
+// Get network statistics for a specific interface, optionally inside a namespace ("name@netns")
 func readNetworkStats(iface string) (NetStats, error) {
-	file, err := os.Open("/proc/net/dev")
+	name, netns := splitInterface(iface)
+	all, err := readNamespaceStats(netns)
 	if err != nil {
 		return NetStats{}, err
 	}
-	defer file.Close()
+	stats, ok := all[name]
+	if !ok {
+		return NetStats{}, fmt.Errorf("interface %s not found", iface)
+	}
+	return stats, nil
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, iface+":") {
-			fields := strings.Fields(line)
-			receiveBytes, _ := strconv.ParseUint(fields[1], 10, 64)
-			transmitBytes, _ := strconv.ParseUint(fields[9], 10, 64)
+// Add the traffic of every monitored interface since the previous sample to the totals
+func updateStatistics(config *Config, ifaces []string) error {
+	current, err := readCurrentStats(ifaces)
+	if err != nil {
+		return err
+	}
+	accountCounters(config, current)
+	return nil
+}
 
-			return NetStats{ReceiveBytes: receiveBytes, TransmitBytes: transmitBytes}, nil
+// Read the counters of the monitored interfaces, those not found are left out
+func readCurrentStats(ifaces []string) (map[string]NetStats, error) {
+	// Read each namespace's interface table once per sample
+	tables := make(map[string]map[string]NetStats)
+	var readErr error
+	for _, iface := range ifaces {
+		_, netns := splitInterface(iface)
+		if _, ok := tables[netns]; ok {
+			continue
+		}
+		table, err := readNamespaceStats(netns)
+		if err != nil {
+			logf("Failed to read network stats of namespace %q: %v\n", netns, err)
+			readErr = err
 		}
+		tables[netns] = table
+	}
+
+	current := make(map[string]NetStats)
+	for _, iface := range ifaces {
+		name, netns := splitInterface(iface)
+		stats, ok := tables[netns][name]
+		if !ok {
+			// Keep the previous counters, the interface may come back (e.g. ppp reconnect)
+			logf("Interface %s not found, skipped in this interval\n", iface)
+			continue
+		}
+		current[iface] = stats
+	}
+	if len(current) == 0 {
+		if readErr != nil {
+			return nil, readErr
+		}
+		return nil, fmt.Errorf("none of the monitored interfaces %v found", ifaces)
+	}
+	return current, nil
+}
+
+// Add the difference between the current and the previous cumulative counters to the totals
+func accountCounters(config *Config, current map[string]NetStats) {
+	if config.Statistics.Counters == nil {
+		config.Statistics.Counters = make(map[string]NetStats)
+		// Configs written before per-interface counters only kept a single pair of last values
+		if len(current) == 1 {
+			for key := range current {
+				config.Statistics.Counters[key] = NetStats{
+					ReceiveBytes:  config.Statistics.LastReceive,
+					TransmitBytes: config.Statistics.LastTransmit,
+				}
+			}
+		}
+	}
+
+	takeSelfTraffic(config, current)
+	paused := accountingPaused(config, time.Now())
+	var elapsed time.Duration
+	if lastSample, err := time.Parse(time.RFC3339, config.Statistics.LastSample); err == nil {
+		elapsed = time.Since(lastSample)
+	}
+
+	var lastReceive, lastTransmit uint64
+	for key, stats := range current {
+		last := config.Statistics.Counters[key]
+
+		// Check for system reboot by comparing previous and current values
+		if stats.ReceiveBytes < last.ReceiveBytes {
+			// System reboot detected for receive bytes, all bytes counted since are new
+			last.ReceiveBytes = 0
+		}
+		if stats.TransmitBytes < last.TransmitBytes {
+			// System reboot detected for transmit bytes
+			last.TransmitBytes = 0
+		}
+
+		// Update the total counts, unless the delta is more than the link can carry. A delta
+		// spanning a suspend isn't an interval's traffic, it is neither checked nor placed in time.
+		receive, transmit := stats.ReceiveBytes-last.ReceiveBytes, stats.TransmitBytes-last.TransmitBytes
+		switch {
+		case resumeGap > 0:
+			addUnattributedTraffic(config, key, receive, transmit, paused)
+		case !rejectOutlier(config, key, receive, transmit, elapsed):
+			addTraffic(config, key, receive, transmit, paused)
+		}
+
+		// Save the current stats as the "last" stats for the next check
+		config.Statistics.Counters[key] = stats
+		lastReceive += stats.ReceiveBytes
+		lastTransmit += stats.TransmitBytes
+	}
+
+	config.Statistics.LastReceive = lastReceive
+	config.Statistics.LastTransmit = lastTransmit
+	config.Statistics.LastSample = time.Now().Format(time.RFC3339)
+}
+
+// Add traffic of a counter to the totals, traffic during a pause is only recorded as excluded
+func addTraffic(config *Config, key string, receive, transmit uint64, paused bool) {
+	if paused {
+		config.Statistics.Pause.ExcludedReceive += receive
+		config.Statistics.Pause.ExcludedTransmit += transmit
+		config.Statistics.ExcludedReceive += receive
+		config.Statistics.ExcludedTransmit += transmit
+		return
 	}
+	config.Statistics.TotalReceive += receive
+	config.Statistics.TotalTransmit += transmit
+	addWanUsage(config, key, receive, transmit)
+	recordDailyUsage(config, time.Now(), receive, transmit)
+	recordHeatmap(config, time.Now(), receive+transmit)
+}
 
-	return NetStats{}, fmt.Errorf("interface %s not found", iface)
+// Add the traffic of the sample after a suspend. It counts towards the totals, but the
+// daily usage and the heatmap don't get it: when it happened is unknown, and booking it
+// all in the current hour would skew the rate estimate and the charts.
+func addUnattributedTraffic(config *Config, key string, receive, transmit uint64, paused bool) {
+	if paused {
+		addTraffic(config, key, receive, transmit, paused)
+		return
+	}
+	config.Statistics.TotalReceive += receive
+	config.Statistics.TotalTransmit += transmit
+	config.Statistics.UnattributedReceive += receive
+	config.Statistics.UnattributedTransmit += transmit
+	addWanUsage(config, key, receive, transmit)
 }
 
 // LoadConfig loads the config from the JSON file
@@ -99,50 +493,364 @@ func loadConfig(configFilePath string) (Config, error) {
 		}
 		return config, err
 	}
+	data, err = applyIncludes(configFilePath, data)
+	if err != nil {
+		return config, err
+	}
 	err = json.Unmarshal(data, &config)
 	return config, err
 }
 
+// Check the config values that would otherwise fail silently on every interval
+func validateConfig(config *Config) error {
+	// The plan and the profile fill in the rules below, so they go first
+	if err := applyPlan(config); err != nil {
+		return err
+	}
+	if err := applyProfile(config); err != nil {
+		return err
+	}
+	switch config.Unit {
+	case "", unitBinary, unitDecimal:
+	default:
+		return fmt.Errorf("invalid unit: %s, must be %s or %s", config.Unit, unitBinary, unitDecimal)
+	}
+	if err := validateLanguage(config.Language); err != nil {
+		return err
+	}
+
+	switch config.Comparison.Category {
+	case "download", "upload", "upload+download", "anymax":
+	default:
+		return fmt.Errorf("invalid comparison category: %s", config.Comparison.Category)
+	}
+
+	if config.Comparison.RolloverCap < 0 {
+		return fmt.Errorf("invalid rollover_cap: %.2f", config.Comparison.RolloverCap)
+	}
+	if config.Comparison.ConserveAt < 0 {
+		return fmt.Errorf("invalid conserve_at: %.2f", config.Comparison.ConserveAt)
+	}
+	if config.Comparison.Remind < 0 {
+		return fmt.Errorf("invalid remind: %d", config.Comparison.Remind)
+	}
+	if err := validateRoutes(config.Message.Routes); err != nil {
+		return err
+	}
+	if err := validateNetwork(config.Message.Network); err != nil {
+		return err
+	}
+	if config.LearningHours < 0 {
+		return fmt.Errorf("invalid learning_hours: %d", config.LearningHours)
+	}
+	if err := validateSelfTest(config.Message.SelfTest); err != nil {
+		return err
+	}
+	if config.Message.QuietHours != "" {
+		if _, _, err := parseQuietHours(config.Message.QuietHours); err != nil {
+			return err
+		}
+	}
+	if config.Message.Cooldown < 0 {
+		return fmt.Errorf("invalid message cooldown: %d", config.Message.Cooldown)
+	}
+	enabled := config.Message.allServices()
+	if slices.Contains(enabled, "telegram") {
+		if err := validateTelegram(config.Message.Telegram); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(enabled, "email") {
+		if err := validateEmail(config.Message.Email); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(enabled, "webhook") {
+		if err := validateWebhook(config.Message.Webhook); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(enabled, "ntfy") {
+		if err := validateNtfy(config.Message.Ntfy); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(enabled, "pushover") {
+		if err := validatePushover(config.Message.Pushover); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(enabled, "bark") && config.Message.Bark.Key == "" {
+		return fmt.Errorf("bark needs a key")
+	}
+	if slices.Contains(enabled, "serverchan") && config.Message.ServerChan.SendKey == "" {
+		return fmt.Errorf("serverchan needs a send_key")
+	}
+	if slices.Contains(enabled, "dingtalk") && config.Message.DingTalk.AccessToken == "" {
+		return fmt.Errorf("dingtalk needs an access_token")
+	}
+	if wecom := config.Message.WeCom; slices.Contains(enabled, "wecom") && (wecom.CorpID == "" || wecom.CorpSecret == "" || wecom.AgentID == 0) {
+		return fmt.Errorf("wecom needs corp_id, corp_secret and agent_id")
+	}
+	if slices.Contains(enabled, "feishu") && config.Message.Feishu.WebhookURL == "" {
+		return fmt.Errorf("feishu needs a webhook_url")
+	}
+	if matrix := config.Message.Matrix; slices.Contains(enabled, "matrix") && (matrix.Homeserver == "" || matrix.AccessToken == "" || matrix.RoomID == "") {
+		return fmt.Errorf("matrix needs homeserver, access_token and room_id")
+	}
+	if slices.Contains(enabled, "teams") {
+		if config.Message.Teams.WebhookURL == "" {
+			return fmt.Errorf("teams needs a webhook_url")
+		}
+		switch config.Message.Teams.Card {
+		case "", teamsAdaptive, teamsMessageCard:
+		default:
+			return fmt.Errorf("invalid teams card %q, must be adaptive or messagecard", config.Message.Teams.Card)
+		}
+	}
+	if config.ShutdownDelay < 0 {
+		return fmt.Errorf("invalid shutdown_delay: %d", config.ShutdownDelay)
+	}
+
+	if config.Prepaid && config.BillingCalendar != "" {
+		return fmt.Errorf("prepaid and billing_calendar can't be used together, a prepaid balance is never reset")
+	}
+
+	if config.BillingCalendar == "" && !config.Prepaid && (config.StartDay < 1 || config.StartDay > 31) {
+		return fmt.Errorf("invalid start_day: %d, must be between 1 and 31", config.StartDay)
+	}
+
+	switch config.Aggregation {
+	case "", aggregateLogical, aggregatePhysical:
+	default:
+		return fmt.Errorf("invalid aggregation: %s, must be logical or physical", config.Aggregation)
+	}
+
+	if err := validateLadder(config.Ladder); err != nil {
+		return err
+	}
+	if rung := config.SafeMode; rung != nil {
+		if rung.Action != rungLimit && rung.Action != rungBlock {
+			return fmt.Errorf("invalid safe_mode action: %s, must be limit or block", rung.Action)
+		}
+		// at doesn't apply to safe mode
+		check := *rung
+		check.At = 1
+		if err := validateLadder([]LadderRung{check}); err != nil {
+			return fmt.Errorf("invalid safe_mode: %v", err)
+		}
+	}
+
+	if config.PortAccounting.Enabled {
+		if err := validatePortClasses(config.PortAccounting.Classes); err != nil {
+			return err
+		}
+	}
+
+	if err := validateCollector(&config.Collector); err != nil {
+		return err
+	}
+
+	if err := validateWans(config.Wans); err != nil {
+		return err
+	}
+
+	if err := validateMaintenance(config.Maintenance); err != nil {
+		return err
+	}
+
+	if err := validateHTTP(&config.HTTP); err != nil {
+		return err
+	}
+
+	if config.Interval < 0 {
+		return fmt.Errorf("invalid interval: %d", config.Interval)
+	}
+
+	if config.Timezone != "" {
+		if _, err := time.LoadLocation(config.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q: %v", config.Timezone, err)
+		}
+	}
+
+	return nil
+}
+
+// Check the persisted statistics, an empty last_reset is allowed for a fresh config
+func validateStatistics(stats *Statistics) error {
+	if stats.LastReset == "" {
+		return nil
+	}
+	if _, err := parseLastReset(stats.LastReset); err != nil {
+		return fmt.Errorf("invalid last_reset %q, must be an RFC3339 time like 2006-01-02T15:04:05+08:00", stats.LastReset)
+	}
+	return nil
+}
+
+// Use the configured timezone for the billing period instead of the system's
+func applyTimezone(config *Config) {
+	if config.Timezone == "" {
+		return
+	}
+	if loc, err := time.LoadLocation(config.Timezone); err == nil {
+		time.Local = loc
+	}
+}
+
+// The encoding buffer and the last config saved, so an unchanged config isn't rewritten,
+// and the file as it was written with its parsed layout, so the next save doesn't parse
+// it again while nobody edited it
+var (
+	saveBuffer    bytes.Buffer
+	lastSavedPath string
+	lastSaved     []byte
+	lastWritten   []byte
+	lastLayout    *jsonNode
+)
+
 // SaveConfig saves the config to the JSON file
 func saveConfig(configFilePath string, config Config) error {
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
+	saveBuffer.Reset()
+	encoder := json.NewEncoder(&saveBuffer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+
+	// Skip the write when nothing changed, flash storage on routers wears with every
+	// write. The counters change with every sample, so this only saves the writes of a
+	// config saved again before the next sample, e.g. by a command or the API.
+	data := saveBuffer.Bytes()
+	publishSnapshot(data)
+	if configFilePath == lastSavedPath && bytes.Equal(data, lastSaved) {
+		return nil
+	}
+	// Unknown keys and the order of the keys in the file survive the rewrite, a file
+	// that can't be parsed is replaced by the plain encoding
+	content := data
+	var layout *jsonNode
+	if existing, err := os.ReadFile(configFilePath); err == nil {
+		old := lastLayout
+		if old == nil || configFilePath != lastSavedPath || !bytes.Equal(existing, lastWritten) {
+			if old, err = parseJSONNode(existing); err != nil {
+				err = fmt.Errorf("failed to parse existing config: %v", err)
+			}
+		}
+		if err == nil {
+			var merged []byte
+			if layout, merged, err = mergeConfigLayout(old, data); err == nil {
+				content = merged
+			}
+		}
+		if err != nil {
+			logf("Rewriting config without its layout: %v\n", err)
+		}
+		content = withoutIncludes(configFilePath, content, existing)
+	} else {
+		content = withoutIncludes(configFilePath, content, nil)
+	}
+	if err := os.WriteFile(configFilePath, content, 0644); err != nil {
 		return err
 	}
-	return os.WriteFile(configFilePath, data, 0644)
+	// The low memory profile gives the buffers back instead of keeping them for the next save
+	if lowMemory {
+		saveBuffer = bytes.Buffer{}
+		lastSavedPath, lastSaved, lastWritten, lastLayout = "", nil, nil, nil
+		return nil
+	}
+	lastSavedPath = configFilePath
+	lastSaved = append(lastSaved[:0], data...)
+	lastWritten = append(lastWritten[:0], content...)
+	// Include files take keys out of the written file, its layout is then parsed next time
+	lastLayout = layout
+	if configIncludes[configFilePath] != nil {
+		lastLayout = nil
+	}
+	return nil
 }
 
 // Check if the statistics need to be reset based on the start_day and current date
 func checkReset(config *Config) bool {
-	currentTime := time.Now()
+	return checkResetAt(config, time.Now())
+}
 
-	// Parse the last reset time from the config
-	lastReset, err := time.Parse("2006-01-02", config.Statistics.LastReset)
-	if err != nil {
-		// If there's an error parsing the last reset, assume we need to reset
+// Check if the statistics need to be reset at the given time
+func checkResetAt(config *Config, currentTime time.Time) bool {
+	// A fresh config starts its first period right away
+	if config.Statistics.LastReset == "" {
 		return true
 	}
+	// A damaged last_reset must not wipe the period, the totals are kept until it is fixed
+	if _, err := parseLastReset(config.Statistics.LastReset); err != nil {
+		logf("Invalid last_reset %q, reset skipped: %v\n", config.Statistics.LastReset, err)
+		return false
+	}
 
+	// A prepaid balance only changes with top-ups
+	if config.Prepaid {
+		return false
+	}
+
+	// Irregular periods come from the billing calendar instead of start_day
+	if config.BillingCalendar != "" {
+		return calendarResetDue(config, currentTime)
+	}
+
+	// Calculate the reset date for the current month
+	resetDate := resetDateOf(currentTime, config.StartDay)
+
+	// If the last reset was before the current reset date and now is after or on the reset date, reset statistics.
+	// The dates are compared as local calendar dates, parsing last_reset as UTC midnight made every
+	// sample of the reset day reset again west of UTC.
+	if lastResetDate(config) < resetDate.Format("2006-01-02") && currentTime.After(resetDate) {
+		return true
+	}
+
+	return false
+}
+
+// The reset date in the month of t, midnight local time on start_day, zero without a
+// start_day (a prepaid config may leave it at 0)
+func resetDateOf(t time.Time, startDay int) time.Time {
+	if startDay < 1 {
+		return time.Time{}
+	}
 	// Calculate the number of days in the current month
-	firstOfMonth := time.Date(currentTime.Year(), currentTime.Month(), 1, 0, 0, 0, 0, time.Local)
+	firstOfMonth := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
 	nextMonth := firstOfMonth.AddDate(0, 1, 0)          // First day of next month
 	lastDayOfMonth := nextMonth.AddDate(0, 0, -1).Day() // Get the last day of current month
 
 	// If start_day is greater than the last day of this month, adjust it to the last day
-	resetDay := config.StartDay
+	resetDay := startDay
 	if resetDay > lastDayOfMonth {
 		resetDay = lastDayOfMonth
 	}
 
-	// Calculate the reset date for the current month
-	resetDate := time.Date(currentTime.Year(), currentTime.Month(), resetDay, 0, 0, 0, 0, time.Local)
+	// Where DST skips midnight the time normalizes into the previous day, the reset day
+	// then starts when the clocks jump forward, where its zone begins
+	resetDate := time.Date(t.Year(), t.Month(), resetDay, 0, 0, 0, 0, time.Local)
+	if resetDate.Day() != resetDay {
+		resetDate, _ = time.Date(t.Year(), t.Month(), resetDay, 12, 0, 0, 0, time.Local).ZoneBounds()
+	}
+	return resetDate
+}
 
-	// If the last reset was before the current reset date and now is after or on the reset date, reset statistics
-	if lastReset.Before(resetDate) && currentTime.After(resetDate) {
-		return true
+// Read last_reset, older versions stored only the local date
+func parseLastReset(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
 	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
 
-	return false
+// The local date of the last reset, for comparing with daily records and reset dates.
+// An unreadable value is returned as it is.
+func lastResetDate(config *Config) string {
+	t, err := parseLastReset(config.Statistics.LastReset)
+	if err != nil {
+		return config.Statistics.LastReset
+	}
+	return t.Local().Format("2006-01-02")
 }
 
 // 发送统计摘要信息
@@ -154,88 +862,237 @@ func sendStatisticsSummary(config *Config) error {
 
 	// 计算使用率
 	var usagePercent float64
-	categoryUsage := "未知"
+	categoryUsage := tr("未知")
+	limit := effectiveLimit(config)
 
 	switch config.Comparison.Category {
 	case "download":
-		usagePercent = receiveGB / config.Comparison.Limit * 100
-		categoryUsage = fmt.Sprintf("下载流量：%.2f GB (%.1f%%)", receiveGB, usagePercent)
+		usagePercent = receiveGB / limit * 100
+		categoryUsage = fmt.Sprintf(tr("下载流量：%.2f GB (%.1f%%)"), receiveGB, usagePercent)
 	case "upload":
-		usagePercent = transmitGB / config.Comparison.Limit * 100
-		categoryUsage = fmt.Sprintf("上传流量：%.2f GB (%.1f%%)", transmitGB, usagePercent)
+		usagePercent = transmitGB / limit * 100
+		categoryUsage = fmt.Sprintf(tr("上传流量：%.2f GB (%.1f%%)"), transmitGB, usagePercent)
 	case "upload+download":
-		usagePercent = totalGB / config.Comparison.Limit * 100
-		categoryUsage = fmt.Sprintf("总流量：%.2f GB (%.1f%%)", totalGB, usagePercent)
+		usagePercent = totalGB / limit * 100
+		categoryUsage = fmt.Sprintf(tr("总流量：%.2f GB (%.1f%%)"), totalGB, usagePercent)
 	case "anymax":
 		maxGB := max(receiveGB, transmitGB)
-		usagePercent = maxGB / config.Comparison.Limit * 100
-		categoryUsage = fmt.Sprintf("最大单向流量：%.2f GB (%.1f%%)", maxGB, usagePercent)
+		usagePercent = maxGB / limit * 100
+		categoryUsage = fmt.Sprintf(tr("最大单向流量：%.2f GB (%.1f%%)"), maxGB, usagePercent)
+	}
+	if config.Comparison.Limit == 0 && len(config.Wans) > 0 {
+		categoryUsage = tr("不限总量，按线路分别限额")
+	}
+	limitText := fmt.Sprintf("%.2f GB", limit)
+	if config.Statistics.RolloverGB > 0 {
+		limitText += fmt.Sprintf(tr("（含上期结转%.2f GB）"), config.Statistics.RolloverGB)
+	}
+	if config.Prepaid {
+		categoryUsage = fmt.Sprintf(tr("预付费余额：%.2f GB（累计充值%.2f GB）"), prepaidBalance(config), limit)
 	}
-
-	// 上次重置时间
-	lastResetTime, _ := time.Parse("2006-01-02", config.Statistics.LastReset)
 
 	// 构建消息
 	message := fmt.Sprintf(
-		"周期统计摘要 (%s 至今):\n\n下载流量：%.2f GB\n上传流量：%.2f GB\n合计流量：%.2f GB\n\n计费方式：%s\n限额：%.2f GB\n%s",
-		lastResetTime.Format("2006-01-02"),
+		tr("周期统计摘要 (%s 至今):\n\n下载流量：%.2f GB\n上传流量：%.2f GB\n合计流量：%.2f GB\n\n计费方式：%s\n限额：%s\n%s"),
+		lastResetDate(config),
 		receiveGB,
 		transmitGB,
 		totalGB,
 		config.Comparison.Category,
-		config.Comparison.Limit,
+		limitText,
 		categoryUsage,
 	)
 
+	// 暂停统计期间排除的流量
+	if config.Statistics.ExcludedReceive+config.Statistics.ExcludedTransmit > 0 {
+		message += fmt.Sprintf(tr("\n\n暂停统计期间排除：下载%.2f GB，上传%.2f GB"),
+			float64(config.Statistics.ExcludedReceive)/bytesToGB,
+			float64(config.Statistics.ExcludedTransmit)/bytesToGB)
+	}
+
+	// 系统休眠后无法确定时间的流量
+	if config.Statistics.UnattributedReceive+config.Statistics.UnattributedTransmit > 0 {
+		message += fmt.Sprintf(tr("\n\n系统休眠后无法确定时间的流量（已计入合计，未计入每日流量）：下载%.2f GB，上传%.2f GB"),
+			float64(config.Statistics.UnattributedReceive)/bytesToGB,
+			float64(config.Statistics.UnattributedTransmit)/bytesToGB)
+	}
+
+	// 程序自身发送消息的流量
+	if self := describeSelfTraffic(config); self != "" {
+		message += "\n\n" + self
+	}
+
+	// 按端口分类的流量
+	if classes := describePortClasses(config); classes != "" {
+		message += tr("\n\n端口分类：\n") + classes
+	}
+
+	// 每条线路的流量
+	if wans := describeWans(config); wans != "" {
+		message += tr("\n\n线路：\n") + wans
+	}
+
+	// 流量最大的几天
+	if days := describeTopDays(config); days != "" {
+		message += tr("\n\n流量最大的日期：\n") + days
+	}
+
+	// 按星期和小时的流量分布
+	if heatmap := describeHeatmap(config.History.Heatmap); heatmap != "" {
+		message += tr("\n\n流量热力图（每格1小时，0~23时）：\n") + heatmap
+	}
+
+	// 达到阈值和限制的时间，与上个周期比较
+	if crossings := describeCrossings(config); crossings != "" {
+		message += "\n\n" + crossings
+	}
+
+	// 程序停止运行的时间，重启过时统计可能偏少
+	if downtime := describeDowntime(config, time.Now()); downtime != "" {
+		message += "\n\n" + downtime
+	}
+
+	// 周期内的备注、暂停等事件
+	if events := describeEvents(config); events != "" {
+		message += tr("\n\n备注：\n") + events
+	}
+
 	// 发送消息
-	return sendMessage(config, message)
+	// The period still ends on time, only the message waits in the outbox
+	if queueAfterQuietHours(config, config.Message.route(routeSummary), message, time.Now()) {
+		return nil
+	}
+	return sendRoutedMessage(config, routeSummary, message)
 }
 
+// Longest a reset waits for its summary to be sent
+const maxResetDelay = 24 * time.Hour
+
 // Reset statistics and also reset the Telegram status flags
 func resetStatistics(config *Config, configFilePath string) {
+	// Archive the ending period and save it before anything is cleared. When the save
+	// fails nothing is reset and the next loop tries again.
+	archivePeriod(config)
+	if config.Statistics.ResetPending == "" {
+		config.Statistics.ResetPending = time.Now().Format(time.RFC3339)
+	}
+	err := saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save the archived period, reset postponed: %v\n", err)
+		return
+	}
+
 	// 在重置之前发送统计摘要
-	err := sendStatisticsSummary(config)
+	err = sendStatisticsSummary(config)
+	reportHealth(config, healthSend, err)
 	if err != nil {
-		fmt.Printf("Failed to send statistics summary: %v\n", err)
+		logf("Failed to send statistics summary: %v\n", err)
+		// Wait for the summary, but a notifier that stays broken must not keep the
+		// period from ending
+		pending, _ := time.Parse(time.RFC3339, config.Statistics.ResetPending)
+		if time.Since(pending) < maxResetDelay {
+			logf("Reset postponed until the summary is sent\n")
+			return
+		}
+		logf("Summary still failing after %s, reset anyway, the totals are kept in the history\n", maxResetDelay)
+	} else if _, held := quietUntil(config, time.Now()); held {
+		logf("Quiet hours, summary attachments not sent\n")
+	} else if err := sendSummaryAttachments(config, time.Now()); err != nil {
+		logf("Failed to send summary attachments: %v\n", err)
 	}
 
+	// Carry the unused part of the limit over before the totals are cleared
+	config.Statistics.RolloverGB = rolloverGB(config)
+
 	// Reset statistics
 	config.Statistics.TotalReceive = 0
 	config.Statistics.TotalTransmit = 0
+	config.Statistics.ExcludedReceive = 0
+	config.Statistics.ExcludedTransmit = 0
+	config.Statistics.UnattributedReceive = 0
+	config.Statistics.UnattributedTransmit = 0
+	config.Statistics.SelfReceive = 0
+	config.Statistics.SelfTransmit = 0
+	config.Statistics.PortClasses = nil
+	config.Statistics.Wans = nil
 
 	// Reset the last reset date
-	config.Statistics.LastReset = time.Now().Format("2006-01-02")
-
-	// Reset Telegram status flags
-	config.Message.Telegram.ThresholdStatus = false
-	config.Message.Telegram.RatioStatus = false
-
-	// Reset Gotify status flags
-	config.Message.Gotify.ThresholdStatus = false
-	config.Message.Gotify.RatioStatus = false
+	config.Statistics.LastReset = time.Now().Format(time.RFC3339)
+	trimDowntime(config, time.Now())
+
+	// Lift the ladder's limits, the new period starts unrestricted
+	laddered := config.Statistics.Ladder != nil
+	releaseLadder(config)
+
+	// Reset the alert status flags of all services
+	clearAlertStatus(config)
+	config.Statistics.ShutdownAt = ""
+	config.Statistics.SafeModeNotified = ""
+	config.Statistics.Shutdown = nil
+	config.Statistics.Reminded = ""
+	config.Statistics.ResetPending = ""
+
+	// Start a new history for the new period, the daily usage is kept for rate estimates
+	config.History = History{Days: config.History.Days, Periods: config.History.Periods}
+	detail := tr("开始新的统计周期")
+	if config.Statistics.RolloverGB > 0 {
+		detail += fmt.Sprintf(tr("，上期结转%.2f GB"), config.Statistics.RolloverGB)
+		logf("Rolled %.2f GB over into the new period\n", config.Statistics.RolloverGB)
+	}
+	if laddered {
+		detail += tr("，分级限制已解除")
+	}
+	addEvent(config, eventReset, time.Now(), time.Time{}, detail)
 
 	// Save the reset config
 	err = saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
 	if err != nil {
-		fmt.Printf("Failed to save config after reset in resetStatistics: %v\n", err)
+		logf("Failed to save config after reset in resetStatistics: %v\n", err)
 	}
 }
 
-// Send a message to Telegram via Bot API
-func sendTelegramMessage(token, chatID, message, device string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token)
-
-	body := map[string]string{
-		"chat_id": chatID,
-		"text":    fmt.Sprintf("[%s] %s", device, message),
+// Send a message to each Telegram chat via Bot API
+func sendTelegramMessage(config *Config, message string) error {
+	telegram := config.Message.Telegram
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", telegram.Token)
+	text := fmt.Sprintf("[%s] %s", config.Device, message)
+	if telegram.ParseMode != "" {
+		text = formatTelegram(telegram.ParseMode, text)
 	}
-	jsonBody, _ := json.Marshal(body)
 
-	_, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return fmt.Errorf("failed to send message to Telegram: %v", err)
-	}
+	return sendTelegramChats(telegram, func(chatID string) error {
+		body := telegram.fields(chatID, config.routine)
+		body["text"] = text
+		if telegram.ParseMode != "" {
+			body["parse_mode"] = telegram.ParseMode
+		}
+		jsonBody, _ := json.Marshal(body)
 
+		resp, err := notifyClient("telegram").Post(url, "application/json", bytes.NewBuffer(jsonBody))
+		if err != nil {
+			return fmt.Errorf("failed to send message to Telegram: %v", err)
+		}
+		defer resp.Body.Close()
+		return checkTelegramResponse(resp)
+	})
+}
+
+// Read the Bot API reply, a wrong chat_id or a revoked token comes back with ok false
+// and a description of the problem
+func checkTelegramResponse(resp *http.Response) error {
+	var result struct {
+		OK          bool   `json:"ok"`
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read Telegram response: %s %v", resp.Status, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("got error from Telegram: %d %s", result.ErrorCode, result.Description)
+	}
 	return nil
 }
 
@@ -258,8 +1115,7 @@ func sendGotifyMessage(url, appToken, message, device string) error {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Gotify-Key", appToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := notifyClient("gotify").Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send message to Gotify: %v", err)
 	}
@@ -272,16 +1128,11 @@ func sendGotifyMessage(url, appToken, message, device string) error {
 	return nil
 }
 
-// Send message using the configured service
-func sendMessage(config *Config, message string) error {
-	switch config.Message.Service {
+// Send one message using the given service, within its length limit
+func sendMessagePart(config *Config, service, message string) error {
+	switch service {
 	case "telegram":
-		return sendTelegramMessage(
-			config.Message.Telegram.Token,
-			config.Message.Telegram.ChatID,
-			message,
-			config.Device,
-		)
+		return sendTelegramMessage(config, message)
 	case "gotify":
 		return sendGotifyMessage(
 			config.Message.Gotify.URL,
@@ -289,8 +1140,36 @@ func sendMessage(config *Config, message string) error {
 			message,
 			config.Device,
 		)
+	case "discord":
+		return sendDiscordMessage(config.Message.Discord.WebhookURL, message, config.Device)
+	case "slack":
+		return sendSlackMessage(config.Message.Slack, message, config.Device)
+	case "email":
+		return sendEmailMessage(config, message)
+	case "webhook":
+		return sendWebhookMessage(config, message)
+	case "ntfy":
+		return sendNtfyMessage(config, message)
+	case "pushover":
+		return sendPushoverMessage(config, message)
+	case "bark":
+		return sendBarkMessage(config, message)
+	case "serverchan":
+		return sendServerChanMessage(config.Message.ServerChan.SendKey, message, config.Device)
+	case "dingtalk":
+		return sendDingTalkMessage(config.Message.DingTalk, message, config.Device)
+	case "wecom":
+		return sendWeComMessage(config.Message.WeCom, message, config.Device)
+	case "feishu":
+		return sendFeishuMessage(config, message)
+	case "matrix":
+		return sendMatrixMessage(config.Message.Matrix, message, config.Device)
+	case "teams":
+		return sendTeamsMessage(config, message)
+	case "mock":
+		return sendMockMessage(config.Message.Mock.File, message, config.Device)
 	default:
-		return fmt.Errorf("unknown message service: %s", config.Message.Service)
+		return fmt.Errorf("unknown message service: %s", service)
 	}
 }
 
@@ -302,6 +1181,15 @@ func commandExists(cmd string) bool {
 
 // Perform comparison based on category and thresholds
 func performComparison(config *Config, configFilePath string) error {
+	// With per-WAN quotas the combined limit is optional
+	if config.Comparison.Limit == 0 && len(config.Wans) > 0 {
+		return nil
+	}
+	// Nothing to compare with before the first package is recorded
+	if config.Prepaid && config.Statistics.PrepaidGB <= 0 {
+		return nil
+	}
+
 	var valueInGB float64
 
 	switch config.Comparison.Category {
@@ -320,163 +1208,465 @@ func performComparison(config *Config, configFilePath string) error {
 		return fmt.Errorf("invalid comparison category: %s", config.Comparison.Category)
 	}
 
-	thresholdLimit := config.Comparison.Limit * config.Comparison.Threshold
-	ratioLimit := config.Comparison.Limit * config.Comparison.Ratio
+	thresholdLimit := effectiveLimit(config) * config.Comparison.Threshold
+	ratioLimit := effectiveLimit(config) * config.Comparison.Ratio
+	recordCrossings(config, valueInGB, thresholdLimit, ratioLimit, time.Now())
+
+	// Three stages with their own state: the evaluation above keeps when the limits were
+	// reached, each notification has a flag per service and the shutdown has shutdown_at.
+	// A failed send is tried again at the next interval, only with the services that
+	// missed it, and never holds the shutdown back.
+	if pending := pendingThreshold(config); valueInGB >= thresholdLimit && len(pending) > 0 {
+		notifyThreshold(config, configFilePath, valueInGB, pending)
+	} else if valueInGB >= thresholdLimit && !ratioEnforced(config) {
+		remindThreshold(config, configFilePath, valueInGB, time.Now())
+	}
 
-	// Compare with threshold and send message if needed
-	var thresholdStatus, ratioStatus bool
-	if config.Message.Service == "telegram" {
-		thresholdStatus = config.Message.Telegram.ThresholdStatus
-		ratioStatus = config.Message.Telegram.RatioStatus
-	} else if config.Message.Service == "gotify" {
-		thresholdStatus = config.Message.Gotify.ThresholdStatus
-		ratioStatus = config.Message.Gotify.RatioStatus
+	// Inside a maintenance window the shutdown waits until the window ends
+	if valueInGB >= ratioLimit && !ratioEnforced(config) && enforcementAllowed(config, "", tr("总流量")) {
+		enforceRatio(config, configFilePath, valueInGB)
 	}
 
-	// Compare with threshold and send message if needed
-	if valueInGB >= thresholdLimit && !thresholdStatus {
-		message := fmt.Sprintf("流量提醒：当前使用量为 %.2f GB，超过了设置的%.0f%%阈值", valueInGB, config.Comparison.Threshold*100)
-		err := sendMessage(config, message)
-		if err != nil {
-			fmt.Printf("Failed to send threshold message: %v\n", err)
-		} else {
-			// Update status based on selected service
-			if config.Message.Service == "telegram" {
-				config.Message.Telegram.ThresholdStatus = true
-			} else if config.Message.Service == "gotify" {
-				config.Message.Gotify.ThresholdStatus = true
-			}
+	return nil
+}
 
-			// Save the updated config to the file
-			err = saveConfig(configFilePath, *config)
-			if err != nil {
-				fmt.Printf("Failed to save config after threshold message: %v\n", err)
-			}
+// The services that haven't got the threshold alert of this period yet
+func pendingThreshold(config *Config) []string {
+	var pending []string
+	for _, service := range config.Message.route(routeThreshold) {
+		if flag, _ := alertStatus(config, service); flag == nil || !*flag {
+			pending = append(pending, service)
 		}
 	}
+	return pending
+}
 
-	// Check for shutdown warning and send message if needed
-	if valueInGB >= ratioLimit && !ratioStatus {
-		message := fmt.Sprintf("关机警告：当前使用量 %.2f GB，超过了限制的%.0f%%，即将关机！", valueInGB, config.Comparison.Ratio*100)
-		err := sendMessage(config, message)
-		if err != nil {
-			fmt.Printf("Failed to send ratio warning message: %v\n", err)
-		} else {
-			// Update status based on selected service
-			if config.Message.Service == "telegram" {
-				config.Message.Telegram.RatioStatus = true
-			} else if config.Message.Service == "gotify" {
-				config.Message.Gotify.RatioStatus = true
+// Send the threshold alert to the services still missing it, each service's flag is only
+// set once it got through
+func notifyThreshold(config *Config, configFilePath string, valueInGB float64, pending []string) {
+	message := thresholdMessage(config, valueInGB)
+	// Left pending, the next sample after the quiet hours sends it with the usage by then
+	if heldByQuietHours(config, routeThreshold, time.Now()) {
+		return
+	}
+	// An alert within the cooldown counts as delivered, e.g. after the config was reset
+	if alertCoolingDown(config, routeThreshold, time.Now()) {
+		logf("Threshold alert sent within the last %d hours, not sending it again\n", config.Message.Cooldown)
+		for _, service := range pending {
+			if flag, _ := alertStatus(config, service); flag != nil {
+				*flag = true
 			}
+		}
+		return
+	}
+	// The event is only recorded with the first delivery, not with the later retries
+	first := len(pending) == len(config.Message.route(routeThreshold))
+	sent, err := sendMessageTo(config, pending, message+alertLink(config, time.Now()))
+	reportHealth(config, healthSend, err)
+	if err != nil {
+		logf("Failed to send threshold message: %v\n", err)
+		return
+	}
+	recordAlert(routeThreshold, time.Now())
+	config.Statistics.Reminded = time.Now().Format(time.RFC3339)
+	for _, service := range sent {
+		if flag, _ := alertStatus(config, service); flag != nil {
+			*flag = true
+		}
+	}
+	if first {
+		addEvent(config, eventAlert, time.Now(), time.Time{}, message)
+	}
 
-			// Save the updated config to the file
-			err = saveConfig(configFilePath, *config)
-			if err != nil {
-				fmt.Printf("Failed to save config after ratio warning: %v\n", err)
-			}
+	// Save the updated config to the file
+	err = saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save config after threshold message: %v\n", err)
+	}
+}
 
-			// Wait for 30 seconds before shutting down
-			time.Sleep(30 * time.Second)
+// The threshold alert with the current usage, also sent by the reminders
+func thresholdMessage(config *Config, valueInGB float64) string {
+	message := fmt.Sprintf(tr("流量提醒：当前使用量为 %.2f GB，超过了设置的%.0f%%阈值"), valueInGB, config.Comparison.Threshold*100)
+	if config.Statistics.RolloverGB > 0 {
+		message += fmt.Sprintf(tr("（限额%.2f GB，含上期结转%.2f GB）"), effectiveLimit(config), config.Statistics.RolloverGB)
+	}
+	if config.Prepaid {
+		message = fmt.Sprintf(tr("流量提醒：预付费流量余额 %.2f GB，已使用了%.0f%%以上"), prepaidBalance(config), config.Comparison.Threshold*100)
+	}
+	// Tell the recipient how urgent it is
+	if estimate := estimateTimeToLimit(config, time.Now(), valueInGB); estimate != "" {
+		message += "，" + estimate
+	}
+	return message
+}
 
-			// Check if shutdown command exists, otherwise use poweroff
-			var cmd *exec.Cmd
-			if commandExists("shutdown") {
-				cmd = exec.Command("shutdown", "-h", "now")
-			} else {
-				cmd = exec.Command("poweroff")
-			}
+// Whether the ratio's shutdown already ran this period, is counting down or was
+// cancelled. A warning delivered to any service counts too, before shutdown_at existed
+// the warning and the shutdown always went together.
+func ratioEnforced(config *Config) bool {
+	if countdown := config.Statistics.Shutdown; countdown != nil && (countdown.Cancelled == "" || countdown.Source == shutdownRatio) {
+		return true
+	}
+	if config.Statistics.ShutdownAt != "" {
+		return true
+	}
+	for _, service := range config.Message.route(routeRatio) {
+		if _, flag := alertStatus(config, service); flag != nil && *flag {
+			return true
+		}
+	}
+	return false
+}
 
-			err := cmd.Run()
-			if err != nil {
-				fmt.Printf("Failed to execute shutdown command: %v\n", err)
-			}
+// Warn and start the shutdown countdown. The warning is best effort, the shutdown
+// happens either way and the next boot reports it through the safe mode message.
+func enforceRatio(config *Config, configFilePath string, valueInGB float64) {
+	message := fmt.Sprintf(tr("关机警告：当前使用量 %.2f GB，超过了限制的%.0f%%，即将关机！"), valueInGB, config.Comparison.Ratio*100)
+	if config.Statistics.RolloverGB > 0 {
+		message = fmt.Sprintf(tr("关机警告：当前使用量 %.2f GB，超过了限制的%.0f%%（限额%.2f GB，含上期结转%.2f GB），即将关机！"),
+			valueInGB, config.Comparison.Ratio*100, effectiveLimit(config), config.Statistics.RolloverGB)
+	}
+	if config.Prepaid {
+		message = fmt.Sprintf(tr("关机警告：预付费流量余额 %.2f GB，已使用了%.0f%%，即将关机！"), prepaidBalance(config), config.Comparison.Ratio*100)
+	}
+	at, notice := shutdownNotice(config)
+	sent, err := sendWarning(config, message+notice+alertLink(config, time.Now()))
+	detail := message
+	if err != nil && config.Comparison.RequireNotice {
+		logf("Failed to send ratio warning message, the shutdown waits for it: %v\n", err)
+		return
+	}
+	if err != nil {
+		logf("Failed to send ratio warning message, shutting down anyway: %v\n", err)
+		detail += tr("（提醒发送失败）")
+	}
+	for _, service := range sent {
+		if _, flag := alertStatus(config, service); flag != nil {
+			*flag = true
 		}
 	}
+	addEvent(config, eventEnforcement, time.Now(), time.Time{}, detail)
+	scheduleShutdown(config, shutdownRatio, fmt.Sprintf(tr("总流量超过了限制的%.0f%%"), config.Comparison.Ratio*100), at)
 
-	return nil
+	// Save the updated config to the file
+	err = saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save config after ratio warning: %v\n", err)
+	}
+}
+
+// The threshold and ratio flags of a message service, nil for an unknown one
+func alertStatus(config *Config, service string) (threshold, ratio *bool) {
+	switch service {
+	case "telegram":
+		return &config.Message.Telegram.ThresholdStatus, &config.Message.Telegram.RatioStatus
+	case "gotify":
+		return &config.Message.Gotify.ThresholdStatus, &config.Message.Gotify.RatioStatus
+	case "discord":
+		return &config.Message.Discord.ThresholdStatus, &config.Message.Discord.RatioStatus
+	case "slack":
+		return &config.Message.Slack.ThresholdStatus, &config.Message.Slack.RatioStatus
+	case "email":
+		return &config.Message.Email.ThresholdStatus, &config.Message.Email.RatioStatus
+	case "webhook":
+		return &config.Message.Webhook.ThresholdStatus, &config.Message.Webhook.RatioStatus
+	case "ntfy":
+		return &config.Message.Ntfy.ThresholdStatus, &config.Message.Ntfy.RatioStatus
+	case "pushover":
+		return &config.Message.Pushover.ThresholdStatus, &config.Message.Pushover.RatioStatus
+	case "bark":
+		return &config.Message.Bark.ThresholdStatus, &config.Message.Bark.RatioStatus
+	case "serverchan":
+		return &config.Message.ServerChan.ThresholdStatus, &config.Message.ServerChan.RatioStatus
+	case "dingtalk":
+		return &config.Message.DingTalk.ThresholdStatus, &config.Message.DingTalk.RatioStatus
+	case "wecom":
+		return &config.Message.WeCom.ThresholdStatus, &config.Message.WeCom.RatioStatus
+	case "feishu":
+		return &config.Message.Feishu.ThresholdStatus, &config.Message.Feishu.RatioStatus
+	case "matrix":
+		return &config.Message.Matrix.ThresholdStatus, &config.Message.Matrix.RatioStatus
+	case "teams":
+		return &config.Message.Teams.ThresholdStatus, &config.Message.Teams.RatioStatus
+	case "mock":
+		return &config.Message.Mock.ThresholdStatus, &config.Message.Mock.RatioStatus
+	}
+	return nil, nil
+}
+
+// Attempts at a shutdown warning and the wait between them, the shutdown's own grace
+// period follows the last one
+const (
+	warningAttempts   = 3
+	warningRetryDelay = 10 * time.Second
+)
+
+// Send a warning that precedes an enforcement, trying again a few times on failure.
+// Returns the services that got it, the error is only set when none did.
+func sendWarning(config *Config, message string) ([]string, error) {
+	var err error
+	for attempt := 1; attempt <= warningAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(warningRetryDelay)
+		}
+		var sent []string
+		sent, err = sendUrgentMessage(config, config.Message.route(routeRatio), message)
+		reportHealth(config, healthSend, err)
+		if err == nil {
+			return sent, nil
+		}
+		logf("Failed to send warning (attempt %d of %d): %v\n", attempt, warningAttempts, err)
+	}
+	return nil, err
+}
+
+// Power the system off, the countdown gave the warning time to arrive
+func powerOff() {
+	// Check if shutdown command exists, otherwise use poweroff
+	var cmd *exec.Cmd
+	if commandExists("shutdown") {
+		cmd = exec.Command("shutdown", "-h", "now")
+	} else {
+		cmd = exec.Command("poweroff")
+	}
+
+	err := cmd.Run()
+	if err != nil {
+		logf("Failed to execute shutdown command: %v\n", err)
+	}
 }
 
 func main() {
 	// Parse the command-line flag for the config file path
-	configFilePath := flag.String("c", "/path/to/config.json", "Path to the config JSON file")
+	// Subcommands such as `netmonitor pause` talk to the running monitor
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Exit(runCommand(os.Args[1], os.Args[2:]))
+	}
+
+	configFilePath := flag.String("c", defaultConfigPath, "Path to the config JSON file")
+	flag.BoolVar(&quiet, "quiet", false, "Suppress routine output, only print fatal errors to stderr")
+	flag.BoolVar(&lowMemory, "low-memory", false, "Reduce memory use for small routers: no history, capped queues")
+	flag.BoolVar(&debugMode, "debug", false, "Accept synthetic traffic from `netmonitor inject`, for staging only")
+	testNotify := flag.Bool("test-notify", false, "Send a test message through every message service and exit")
 	flag.Parse()
+	applyLowMemory()
 
 	// Load the config file (or create a new one if not exists)
 	config, err := loadConfig(*configFilePath)
 	if err != nil {
-		fmt.Printf("Failed to load config in main: %v\n", err)
-		return
+		exitWithError(loadErrorCode(err), fmt.Errorf("failed to load config: %v", err))
+	}
+
+	// Validate the config and the persisted statistics before starting
+	if err := validateConfig(&config); err != nil {
+		exitWithError(exitConfig, err)
+	}
+	if err := validateStatistics(&config.Statistics); err != nil {
+		exitWithError(exitStateCorrupt, err)
+	}
+	loadSendLog(*configFilePath)
+	if unknown, err := unknownConfigKeys(*configFilePath); err == nil {
+		for _, key := range unknown {
+			logf("Warning: unknown config key %s, the setting it was meant for keeps its default\n", key)
+		}
+	}
+	applyTimezone(&config)
+	applyUnit(&config)
+	applyLanguage(&config)
+	setupNotifyNetwork(config.Message)
+
+	// Check the credentials of the message services without starting the monitor
+	if *testNotify {
+		failed := false
+		for _, result := range sendTestMessages(&config) {
+			if result.err != nil {
+				failed = true
+				fmt.Printf("%s: %v\n", result.service, result.err)
+				continue
+			}
+			fmt.Printf("%s: ok\n", result.service)
+		}
+		if failed {
+			os.Exit(exitFailure)
+		}
+		os.Exit(exitOK)
+	}
+
+	// The billing calendar must be readable at startup, later failures keep the last copy
+	if config.BillingCalendar != "" {
+		if err := loadCalendar(config.BillingCalendar, time.Now()); err != nil {
+			exitWithError(exitConfig, fmt.Errorf("failed to load billing calendar: %v", err))
+		}
+	}
+
+	// Start the collector when the traffic is measured elsewhere, e.g. on the router
+	var coll collector
+	if config.Collector.Type != "" {
+		coll, err = startCollector(&config.Collector)
+		if err != nil {
+			exitWithError(exitFailure, err)
+		}
+	}
+
+	// Serve the dashboard, it shows the state of the last save
+	if config.HTTP.Listen != "" {
+		if err := startHTTPServer(config.HTTP, config, *configFilePath); err != nil {
+			exitWithError(exitFailure, err)
+		}
 	}
 
 	// Set the interface name (if not already set in config)
-	if config.Interface == "" {
+	if coll == nil && config.Interface == "" && len(config.Interfaces) == 0 && len(config.Wans) == 0 {
 		config.Interface = "eth0" // Default to eth0, you can change it or make it configurable
 	}
 
-	// Check if the interface exists
-	_, err = readNetworkStats(config.Interface)
-	if err != nil {
-		fmt.Printf("Error checking interface existing: %v\n", err)
-		return
+	// Resolve the monitored interfaces and check that they exist
+	ifaces, skipped := resolveInterfaces(&config)
+	for _, iface := range skipped {
+		logf("Interface %s is a member of another monitored interface, skipped to avoid double counting\n", iface)
+	}
+	for _, iface := range ifaces {
+		_, err = readNetworkStats(iface)
+		if err != nil {
+			exitWithError(exitInterface, err)
+		}
 	}
 
+	// Tell which optional features this system can't provide before they are used
+	logCapabilities(&config, *configFilePath)
+
+	// Create the nftables counters for the port classes, accounting still works without them
+	if config.PortAccounting.Enabled {
+		if err := setupPortAccounting(&config, ifaces); err != nil {
+			logf("Port class accounting disabled: %v\n", err)
+			config.PortAccounting.Enabled = false
+		}
+	}
+
+	// tc and nftables rules are gone after a reboot, the reached rungs are applied again
+	restoreLadder(&config)
+	checkSafeMode(&config, *configFilePath, ifaces)
+	startLearning(&config, time.Now())
+
 	// Use the interval defined in config.json
 	interval := config.Interval
 	if interval == 0 {
 		interval = 600 // Default to 600 seconds if not specified
 	}
 
+	// Account the traffic the counters kept while the monitor was stopped
+	if coll == nil {
+		reconcileCounters(&config, ifaces, time.Duration(interval)*time.Second, time.Now())
+	}
+
+	// Time spent suspended during the last wait, resampled right after resume
+	var suspended time.Duration
+
+	// Queued commands and a due countdown end the wait early, so they take effect right away
+	wake := func() bool {
+		return commandsPending(*configFilePath) || countdownDue(&config, time.Now())
+	}
+
 	for {
+		// Check the system clock before trusting it for the reset
+		clockSane := true
+		if config.Clock.Enabled {
+			clockSane = checkClock(&config)
+		}
+
 		// Check if the statistics need to be reset based on the start day
-		if checkReset(&config) {
-			//resetStatistics(&config) // Reset statistics and telegram statuses
-			resetStatistics(&config, *configFilePath)
+		if config.BillingCalendar != "" {
+			refreshCalendar(&config, time.Now())
+		}
+		// A reset postponed by a failed summary is retried until it goes through
+		if checkReset(&config) || config.Statistics.ResetPending != "" {
+			if !clockSane && config.Clock.DeferReset {
+				logf("System clock is not synchronized, reset deferred\n")
+			} else {
+				//resetStatistics(&config) // Reset statistics and telegram statuses
+				resetStatistics(&config, *configFilePath)
+			}
+		}
+
+		// Pick up interfaces matching the patterns that appeared since the last interval
+		if hasInterfacePatterns(&config) {
+			ifaces = rescanInterfaces(&config, ifaces)
 		}
 
-		stats, err := readNetworkStats(config.Interface)
+		// Attribute this interval's traffic by which WAN carries the default route now
+		updateWanRoutes(&config, time.Now())
+
+		totalBefore := config.Statistics.TotalReceive + config.Statistics.TotalTransmit
+		resumeGap = suspended
+		if coll != nil {
+			err = updateFromCollector(&config, coll)
+		} else {
+			err = updateStatistics(&config, ifaces)
+		}
+		resumeGap = 0
+		reportHealth(&config, healthRead, err)
 		if err != nil {
-			fmt.Printf("Error reading network stats: %v\n", err)
-			time.Sleep(time.Duration(interval) * time.Second)
+			logf("Error reading network stats: %v\n", err)
+			suspended = waitInterval(time.Duration(interval)*time.Second, wake)
 			continue
 		}
 
-		// Check for system reboot by comparing previous and current values
-		if stats.ReceiveBytes < config.Statistics.LastReceive {
-			// System reboot detected for receive bytes
-			config.Statistics.TotalReceive += config.Statistics.LastReceive
+		// Annotate the first sample after a resume, its delta covers the whole suspend
+		if suspended > 0 {
+			now := time.Now()
+			delta := config.Statistics.TotalReceive + config.Statistics.TotalTransmit - totalBefore
+			addEvent(&config, eventSuspend, now.Add(-suspended), now,
+				fmt.Sprintf(tr("系统休眠约%s，恢复后首次采样的%.2f GB无法确定发生的时间，计入合计但不计入每日流量"), suspended.Round(time.Second), float64(delta)/bytesToGB))
+			logf("System resumed after %s suspended, resampled immediately\n", suspended.Round(time.Second))
+			suspended = 0
 		}
-		if stats.TransmitBytes < config.Statistics.LastTransmit {
-			// System reboot detected for transmit bytes
-			config.Statistics.TotalTransmit += config.Statistics.LastTransmit
+
+		if config.PortAccounting.Enabled {
+			if err := updatePortClasses(&config); err != nil {
+				logf("Failed to update port class counters: %v\n", err)
+			}
 		}
 
-		// Update the total counts
-		config.Statistics.TotalReceive += stats.ReceiveBytes - config.Statistics.LastReceive
-		config.Statistics.TotalTransmit += stats.TransmitBytes - config.Statistics.LastTransmit
+		// Apply queued commands after sampling, so a pause starts exactly at this sample
+		applyCommands(&config, *configFilePath)
 
-		// Save the current stats as the "last" stats for the next check
-		config.Statistics.LastReceive = stats.ReceiveBytes
-		config.Statistics.LastTransmit = stats.TransmitBytes
+		// The day's email digest and the queued messages go out with this save
+		updateConserving(&config)
+		flushEmailDigest(&config, time.Now())
+		flushOutbox(&config, time.Now())
+		runSelfTest(&config, time.Now())
 
 		// Save the updated config to the file
 		err = saveConfig(*configFilePath, config)
+		reportHealth(&config, healthSave, err)
 		if err != nil {
-			fmt.Printf("Failed to update stats to config: %v\n", err)
+			logf("Failed to update stats to config: %v\n", err)
 		}
 
 		// Print the stats, in GB units for better readability
-		// fmt.Printf("Total Receive: %.2f GB, Total Transmit: %.2f GB\n",
+		// logf("Total Receive: %.2f GB, Total Transmit: %.2f GB\n",
 		// 	float64(config.Statistics.TotalReceive)/bytesToGB,
 		// 	float64(config.Statistics.TotalTransmit)/bytesToGB)
 
+		// Check the NIC error counters if enabled
+		if config.NicHealth.Enabled {
+			checkNicHealth(&config, ifaces)
+		}
+
 		// Perform comparison and check for warnings
 		//err = performComparison(&config)
 		err = performComparison(&config, *configFilePath)
 		if err != nil {
-			fmt.Printf("Comparison error: %v\n", err)
+			logf("Comparison error: %v\n", err)
 		}
+		checkWanQuotas(&config, *configFilePath)
+		checkLadder(&config, *configFilePath, ifaces)
+		runCountdown(&config, *configFilePath, time.Now())
 
-		// Wait for the next interval
-		time.Sleep(time.Duration(interval) * time.Second)
+		// Wait for the next interval, returns early after a suspend
+		suspended = waitInterval(time.Duration(interval)*time.Second, wake)
 	}
 }
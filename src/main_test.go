@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResumeSampleIsUnattributed(t *testing.T) {
+	quiet = true
+	config := &Config{}
+	config.Statistics.Counters = map[string]NetStats{"eth0": {ReceiveBytes: 1000, TransmitBytes: 100}}
+	config.Statistics.LastSample = time.Now().Add(-8 * time.Hour).Format(time.RFC3339)
+
+	resumeGap = 8 * time.Hour
+	accountCounters(config, map[string]NetStats{"eth0": {ReceiveBytes: 5000, TransmitBytes: 300}})
+	resumeGap = 0
+
+	if config.Statistics.TotalReceive != 4000 || config.Statistics.TotalTransmit != 200 {
+		t.Errorf("totals %d/%d, want 4000/200", config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+	}
+	if config.Statistics.UnattributedReceive != 4000 || config.Statistics.UnattributedTransmit != 200 {
+		t.Errorf("unattributed %d/%d, want 4000/200", config.Statistics.UnattributedReceive, config.Statistics.UnattributedTransmit)
+	}
+	if len(config.History.Days) != 0 || config.History.Heatmap != nil {
+		t.Errorf("resume sample booked in the daily usage or heatmap: %v", config.History.Days)
+	}
+
+	// The next regular sample is placed in time again
+	accountCounters(config, map[string]NetStats{"eth0": {ReceiveBytes: 6000, TransmitBytes: 300}})
+	if len(config.History.Days) != 1 || config.History.Days[0].Receive != 1000 {
+		t.Errorf("regular sample not in the daily usage: %v", config.History.Days)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MaintenanceWindow struct {
+	Schedule string `json:"schedule"` // 窗口开始时间，cron格式（分 时 日 月 周），例如"0 2 * * *"
+	Duration int    `json:"duration"` // 窗口持续的分钟数
+	Reason   string `json:"reason"`   // 说明，会出现在提醒中
+}
+
+// Longest supported window, a window is found by walking back minute by minute
+const maxMaintenanceMinutes = 7 * 24 * 60
+
+// A parsed cron schedule, one set of allowed values per field
+type cronSchedule struct {
+	minute, hour, day, month, weekday map[int]bool
+	anyDay, anyWeekday                bool
+}
+
+// Enforcement deferred by a maintenance window, keyed by "" for the global limit or
+// by WAN name, so the warning is only sent once per window
+var deferredEnforcement = map[string]bool{}
+
+// Parse a five-field cron expression supporting *, lists, ranges and steps
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q, expected 5 fields", expr)
+	}
+
+	limits := []struct{ min, max int }{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, 5)
+	for i, field := range fields {
+		set, err := parseCronField(field, limits[i].min, limits[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is both 0 and 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{
+		minute: sets[0], hour: sets[1], day: sets[2], month: sets[3], weekday: sets[4],
+		anyDay: fields[2] == "*", anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			var err error
+			rangePart = before
+			if step, err = strconv.Atoi(after); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", after)
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			low, high, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = strconv.Atoi(low); err != nil {
+				return nil, fmt.Errorf("invalid value %q", low)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(high); err != nil {
+					return nil, fmt.Errorf("invalid value %q", high)
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("value %q out of range %d-%d", rangePart, min, max)
+		}
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// Check whether the schedule fires at the given minute. Like cron, a restricted day of
+// month and day of week match when either of them matches.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minute[t.Minute()] || !s.hour[t.Hour()] || !s.month[int(t.Month())] {
+		return false
+	}
+	day, weekday := s.day[t.Day()], s.weekday[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Check the maintenance windows
+func validateMaintenance(windows []MaintenanceWindow) error {
+	for _, window := range windows {
+		if _, err := parseCron(window.Schedule); err != nil {
+			return err
+		}
+		if window.Duration <= 0 || window.Duration > maxMaintenanceMinutes {
+			return fmt.Errorf("invalid maintenance duration %d for %q, must be between 1 and %d minutes",
+				window.Duration, window.Schedule, maxMaintenanceMinutes)
+		}
+	}
+	return nil
+}
+
+// Find the maintenance window covering now, if any
+func activeMaintenance(config *Config, now time.Time) (MaintenanceWindow, bool) {
+	now = now.Truncate(time.Minute)
+	for _, window := range config.Maintenance {
+		schedule, err := parseCron(window.Schedule)
+		if err != nil {
+			continue
+		}
+		for i := 0; i < window.Duration; i++ {
+			if schedule.matches(now.Add(-time.Duration(i) * time.Minute)) {
+				return window, true
+			}
+		}
+	}
+	return MaintenanceWindow{}, false
+}
+
+// Decide whether an enforcement action may run now. Inside a maintenance window it is
+// deferred with a single notice, and runs on the first check after the window ends.
+func enforcementAllowed(config *Config, key, subject string) bool {
+	window, ok := activeMaintenance(config, time.Now())
+	if !ok {
+		delete(deferredEnforcement, key)
+		return true
+	}
+	if deferredEnforcement[key] {
+		return false
+	}
+	deferredEnforcement[key] = true
+
+	reason := window.Reason
+	if reason == "" {
+		reason = window.Schedule
+	}
+	logf("Enforcement for %s deferred by maintenance window %q\n", subject, reason)
+	message := fmt.Sprintf(tr("维护窗口（%s）中：%s已超过限制，窗口结束后再执行处理"), reason, subject)
+	addEvent(config, eventAlert, time.Now(), time.Time{}, message)
+	err := sendMessage(config, message)
+	reportHealth(config, healthSend, err)
+	if err != nil {
+		logf("Failed to send maintenance notice: %v\n", err)
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type MatrixMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	Homeserver      string `json:"homeserver"`     // 服务器地址，例如https://matrix.example.com
+	AccessToken     string `json:"access_token"`   // 发送消息的账号的访问令牌
+	RoomID          string `json:"room_id"`        // 房间ID，形如!abcdefg:example.com
+	HTML            bool   `json:"html,omitempty"` // 是否同时发送HTML格式，首行加粗，列表显示为列表
+}
+
+// Format a message as HTML: the first line bold, paragraphs at blank lines and the
+// "- " lines of the summary as lists
+func matrixHTML(message string) string {
+	var b strings.Builder
+	for i, block := range strings.Split(message, "\n\n") {
+		lines := strings.Split(block, "\n")
+		inList := false
+		b.WriteString("<p>")
+		for j, line := range lines {
+			item, isItem := strings.CutPrefix(line, "- ")
+			if isItem != inList {
+				if isItem {
+					b.WriteString("</p><ul>")
+				} else {
+					b.WriteString("</ul><p>")
+				}
+				inList = isItem
+			}
+			switch {
+			case isItem:
+				b.WriteString("<li>" + html.EscapeString(item) + "</li>")
+			case i == 0 && j == 0:
+				b.WriteString("<strong>" + html.EscapeString(line) + "</strong><br>")
+			default:
+				b.WriteString(html.EscapeString(line) + "<br>")
+			}
+		}
+		if inList {
+			b.WriteString("</ul>")
+		} else {
+			b.WriteString("</p>")
+		}
+	}
+	return strings.ReplaceAll(b.String(), "<p></p>", "")
+}
+
+// Send a message to a Matrix room through the client-server API
+func sendMatrixMessage(matrix MatrixMessage, message, device string) error {
+	text := fmt.Sprintf("[%s] %s", device, message)
+	body := map[string]string{"msgtype": "m.text", "body": text}
+	if matrix.HTML {
+		body["format"] = "org.matrix.custom.html"
+		body["formatted_body"] = matrixHTML(text)
+	}
+	jsonBody, _ := json.Marshal(body)
+
+	// The transaction ID only has to be unique for the access token
+	apiURL := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/netmonitor-%d",
+		strings.TrimRight(matrix.Homeserver, "/"), url.PathEscape(matrix.RoomID), time.Now().UnixNano())
+	req, err := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request to Matrix: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+matrix.AccessToken)
+
+	resp, err := notifyClient("matrix").Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message to Matrix: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("got error status from Matrix: %s %s", resp.Status, bytes.TrimSpace(reply))
+	}
+	return nil
+}
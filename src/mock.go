@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Write the message to a file or stdout instead of sending it, for offline tests of the alert pipeline
+func sendMockMessage(file, message, device string) error {
+	line := fmt.Sprintf("%s [%s] %s\n", time.Now().Format(time.RFC3339), device, message)
+	if file == "" {
+		_, err := os.Stdout.WriteString(line)
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open mock message file: %v", err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(line)
+	return err
+}
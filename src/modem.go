@@ -0,0 +1,276 @@
+//go:build !nocollector
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reads the carrier-side traffic counters from a Huawei LTE/5G router (HiLink web API)
+type huaweiCollector struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// Reads the traffic counters from a ZTE LTE/5G router (goform web API)
+type zteCollector struct {
+	baseURL  string
+	password string
+	client   *http.Client
+}
+
+// HTTP client keeping the router's session cookie
+func newModemClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar, Timeout: 10 * time.Second}
+}
+
+func startHuaweiCollector(config *CollectorConfig) (*huaweiCollector, error) {
+	c := &huaweiCollector{
+		baseURL:  strings.TrimRight(config.URL, "/"),
+		username: config.Username,
+		password: config.Password,
+		client:   newModemClient(),
+	}
+	if _, err := c.counters(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Fetch a fresh session cookie and request verification token
+func (c *huaweiCollector) session() (string, error) {
+	var info struct {
+		SesInfo string `xml:"SesInfo"`
+		TokInfo string `xml:"TokInfo"`
+	}
+	if err := c.getXML("/api/webserver/SesTokInfo", "", &info); err != nil {
+		return "", err
+	}
+
+	if name, value, ok := strings.Cut(info.SesInfo, "="); ok {
+		base, _ := url.Parse(c.baseURL)
+		c.client.Jar.SetCookies(base, []*http.Cookie{{Name: name, Value: value}})
+	}
+	return info.TokInfo, nil
+}
+
+// Log in with password_type 4, used by current HiLink firmware
+func (c *huaweiCollector) login() error {
+	token, err := c.session()
+	if err != nil {
+		return err
+	}
+
+	sha256Hex := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	hashed := base64.StdEncoding.EncodeToString([]byte(sha256Hex(c.password)))
+	password := base64.StdEncoding.EncodeToString([]byte(sha256Hex(c.username + hashed + token)))
+
+	body := fmt.Sprintf("<?xml version=\"1.0\" encoding=\"UTF-8\"?><request><Username>%s</Username><Password>%s</Password><password_type>4</password_type></request>",
+		xmlEscape(c.username), password)
+	req, err := http.NewRequest("POST", c.baseURL+"/api/user/login", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("__RequestVerificationToken", token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("huawei login failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"code"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid huawei login response: %v", err)
+	}
+	if result.XMLName.Local == "error" {
+		return fmt.Errorf("huawei login rejected with error code %s", result.Code)
+	}
+	return nil
+}
+
+// GET an API path and decode the XML response, API errors are returned as errors
+func (c *huaweiCollector) getXML(path, token string, v any) error {
+	req, err := http.NewRequest("GET", c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("__RequestVerificationToken", token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("huawei API %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		XMLName xml.Name
+		Code    string `xml:"code"`
+		Inner   []byte `xml:",innerxml"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("invalid huawei API %s response: %v", path, err)
+	}
+	if raw.XMLName.Local == "error" {
+		return &huaweiError{code: raw.Code}
+	}
+	return xml.Unmarshal([]byte("<response>"+string(raw.Inner)+"</response>"), v)
+}
+
+type huaweiError struct {
+	code string
+}
+
+func (e *huaweiError) Error() string {
+	return fmt.Sprintf("huawei API error code %s", e.code)
+}
+
+func (c *huaweiCollector) counters() (map[string]NetStats, error) {
+	var stats struct {
+		TotalUpload   uint64 `xml:"TotalUpload"`
+		TotalDownload uint64 `xml:"TotalDownload"`
+	}
+
+	token, err := c.session()
+	if err != nil {
+		return nil, err
+	}
+	err = c.getXML("/api/monitoring/traffic-statistics", token, &stats)
+	// 125002 and 100003 mean the session is missing or not logged in
+	if apiErr, ok := err.(*huaweiError); ok && c.password != "" && (apiErr.code == "125002" || apiErr.code == "100003") {
+		if err := c.login(); err != nil {
+			return nil, err
+		}
+		token, err = c.session()
+		if err != nil {
+			return nil, err
+		}
+		err = c.getXML("/api/monitoring/traffic-statistics", token, &stats)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]NetStats{
+		"huawei": {ReceiveBytes: stats.TotalDownload, TransmitBytes: stats.TotalUpload},
+	}, nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func startZteCollector(config *CollectorConfig) (*zteCollector, error) {
+	c := &zteCollector{
+		baseURL:  strings.TrimRight(config.URL, "/"),
+		password: config.Password,
+		client:   newModemClient(),
+	}
+	if c.password != "" {
+		if err := c.login(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := c.counters(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Log in with the base64 password scheme used by most MF/MC series firmware
+func (c *zteCollector) login() error {
+	form := url.Values{
+		"isTest":   {"false"},
+		"goformId": {"LOGIN"},
+		"password": {base64.StdEncoding.EncodeToString([]byte(c.password))},
+	}
+	req, err := http.NewRequest("POST", c.baseURL+"/goform/goform_set_cmd_process", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", c.baseURL+"/index.html")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("zte login failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid zte login response: %v", err)
+	}
+	if result.Result != "0" {
+		return fmt.Errorf("zte login rejected: %s", result.Result)
+	}
+	return nil
+}
+
+func (c *zteCollector) counters() (map[string]NetStats, error) {
+	query := url.Values{
+		"isTest":     {"false"},
+		"multi_data": {"1"},
+		"cmd":        {"monthly_rx_bytes,monthly_tx_bytes"},
+	}
+	req, err := http.NewRequest("GET", c.baseURL+"/goform/goform_get_cmd_process?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	// The firmware rejects requests without a Referer from its own UI
+	req.Header.Set("Referer", c.baseURL+"/index.html")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("zte API failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid zte API response: %v", err)
+	}
+	if result["monthly_rx_bytes"] == "" {
+		return nil, fmt.Errorf("zte API returned no traffic counters, a password may be required")
+	}
+	received, err := strconv.ParseUint(result["monthly_rx_bytes"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	sent, err := strconv.ParseUint(result["monthly_tx_bytes"], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// The monthly counters reset on the router's own day, which is handled like a reboot
+	return map[string]NetStats{
+		"zte": {ReceiveBytes: received, TransmitBytes: sent},
+	}, nil
+}
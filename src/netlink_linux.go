@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Attributes of an RTM_NEWLINK message that aren't in package syscall
+const (
+	iflaStats   = 7  // IFLA_STATS, struct rtnl_link_stats with 32 bit counters
+	iflaStats64 = 23 // IFLA_STATS64, struct rtnl_link_stats64
+)
+
+// Ask the kernel for the interface list over rtnetlink, which works without /proc or /sys.
+// Both stats structs start with rx_packets, tx_packets, rx_bytes, tx_bytes.
+func readNetlinkStats() (map[string]NetStats, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETLINK, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("netlink request failed: %v", err)
+	}
+	messages, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse netlink reply: %v", err)
+	}
+
+	stats := make(map[string]NetStats)
+	for _, message := range messages {
+		if message.Header.Type != syscall.RTM_NEWLINK {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&message)
+		if err != nil {
+			continue
+		}
+		var name string
+		var counters NetStats
+		found := false
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.IFLA_IFNAME:
+				name = strings.TrimRight(string(attr.Value), "\x00")
+			case iflaStats64:
+				if len(attr.Value) >= 32 {
+					counters.ReceiveBytes = binary.NativeEndian.Uint64(attr.Value[16:])
+					counters.TransmitBytes = binary.NativeEndian.Uint64(attr.Value[24:])
+					found = true
+				}
+			case iflaStats:
+				if len(attr.Value) >= 16 && !found {
+					counters.ReceiveBytes = uint64(binary.NativeEndian.Uint32(attr.Value[8:]))
+					counters.TransmitBytes = uint64(binary.NativeEndian.Uint32(attr.Value[12:]))
+				}
+			}
+		}
+		if name != "" {
+			stats[name] = counters
+		}
+	}
+	return stats, nil
+}
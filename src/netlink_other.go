@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// rtnetlink only exists on Linux
+func readNetlinkStats() (map[string]NetStats, error) {
+	return nil, errors.New("netlink is not supported on this system")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Split an interface spec "name@netns" into the device name and its network namespace.
+// The namespace is either a name under /run/netns, a path to a netns file, or "pid:<pid>".
+func splitInterface(spec string) (name, netns string) {
+	name, netns, _ = strings.Cut(spec, "@")
+	return name, netns
+}
+
+// Read the interface table as seen from inside a network namespace, "" is the host namespace
+func readNamespaceStats(netns string) (map[string]NetStats, error) {
+	if netns == "" {
+		return readHostStats()
+	}
+
+	// A process inside the namespace exposes its view under /proc/<pid>/net/dev
+	if pid, ok := strings.CutPrefix(netns, "pid:"); ok {
+		if _, err := strconv.Atoi(pid); err != nil {
+			return nil, fmt.Errorf("invalid namespace pid: %s", pid)
+		}
+		stats, err := readNetDev(filepath.Join("/proc", pid, "net", "dev"))
+		if err != nil {
+			return nil, fmt.Errorf("%v, other users' processes are hidden when /proc is mounted with hidepid", err)
+		}
+		return stats, nil
+	}
+
+	nsPath := netns
+	if !strings.Contains(netns, "/") {
+		nsPath = filepath.Join("/run/netns", netns)
+	}
+	if pid, err := namespacePid(nsPath); err == nil {
+		return readNetDev(filepath.Join("/proc", strconv.Itoa(pid), "net", "dev"))
+	}
+
+	// No process lives in the namespace, enter it with iproute2 instead
+	if !commandExists("ip") || strings.Contains(netns, "/") {
+		return nil, fmt.Errorf("no process found in network namespace %s", netns)
+	}
+	output, err := exec.Command("ip", "netns", "exec", netns, "cat", "/proc/net/dev").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read network namespace %s: %v", netns, err)
+	}
+	return parseNetDev(output), nil
+}
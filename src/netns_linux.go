@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Find a process whose network namespace is the one bound at nsPath
+func namespacePid(nsPath string) (int, error) {
+	var target syscall.Stat_t
+	if err := syscall.Stat(nsPath, &target); err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		var st syscall.Stat_t
+		if err := syscall.Stat(filepath.Join("/proc", entry.Name(), "ns", "net"), &st); err != nil {
+			continue
+		}
+		if st.Dev == target.Dev && st.Ino == target.Ino {
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no process in namespace %s", nsPath)
+}
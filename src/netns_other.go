@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Network namespaces are specific to Linux
+func namespacePid(nsPath string) (int, error) {
+	return 0, errors.New("network namespaces are not supported on this system")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Address families a message service can be pinned to
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+)
+
+// The key of network that applies to the services without their own entry
+const networkDefault = "default"
+
+type NetworkOptions struct {
+	Family    string `json:"family,omitempty"`    // 连接消息服务使用的地址族：ipv4或ipv6，为空时自动选择（IPv4和IPv6并行尝试）
+	Interface string `json:"interface,omitempty"` // 连接消息服务使用的网卡，例如不计流量的管理网卡，仅Linux，需要root权限
+	Source    string `json:"source,omitempty"`    // 连接消息服务使用的源IP地址，必须是本机的地址
+}
+
+// The transport of http.DefaultTransport before the HTTP recording wraps it, the dialer
+// for the message services is installed on it
+var baseTransport = http.DefaultTransport.(*http.Transport)
+
+// The network options of each message service, set once at startup
+var notifyNetwork map[string]NetworkOptions
+
+type notifyServiceKey struct{}
+
+func validateNetwork(network map[string]NetworkOptions) error {
+	for key, options := range network {
+		if key != networkDefault && serviceCapabilities[key] == 0 {
+			return fmt.Errorf("invalid message network key %q, must be a message service or default", key)
+		}
+		switch options.Family {
+		case "", familyIPv4, familyIPv6:
+		default:
+			return fmt.Errorf("invalid address family %q for %s, must be ipv4 or ipv6", options.Family, key)
+		}
+		if options.Interface != "" && !bindToDeviceSupported() {
+			return fmt.Errorf("network interface for %s can't be set on this system", key)
+		}
+		if options.Source != "" {
+			source := net.ParseIP(options.Source)
+			if source == nil {
+				return fmt.Errorf("invalid source address %q for %s", options.Source, key)
+			}
+			if options.Family == familyIPv4 && source.To4() == nil || options.Family == familyIPv6 && source.To4() != nil {
+				return fmt.Errorf("source address %s for %s doesn't match address family %s", options.Source, key, options.Family)
+			}
+		}
+	}
+	return nil
+}
+
+// Install the dialer that applies the network options and counts the own traffic,
+// requests of other parts of the program keep dialing as before
+func setupNotifyNetwork(message Message) {
+	notifyNetwork = message.Network
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	baseTransport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if service, ok := ctx.Value(notifyServiceKey{}).(string); ok {
+			return dialService(ctx, service, network, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// Dial a connection of a message service with its network options
+func dialService(ctx context.Context, service, network, addr string) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	if options, ok := serviceNetwork(service); ok {
+		conn, err = dialWithOptions(ctx, options, network, addr)
+	} else {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		conn, err = dialer.DialContext(ctx, network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn}, nil
+}
+
+// The network options of a service, its own or the default ones
+func serviceNetwork(service string) (NetworkOptions, bool) {
+	if options, ok := notifyNetwork[service]; ok {
+		return options, true
+	}
+	options, ok := notifyNetwork[networkDefault]
+	return options, ok
+}
+
+// A round tripper that marks the requests of one message service, so the dialer
+// applies its options and counts its traffic
+type notifyTransport struct {
+	service string
+}
+
+func (t notifyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(context.WithValue(req.Context(), notifyServiceKey{}, t.service))
+	// Connections dialed with the options aren't kept for other requests to reuse
+	if _, ok := serviceNetwork(t.service); ok {
+		req.Close = true
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// The HTTP client for a message service's requests
+func notifyClient(service string) *http.Client {
+	return &http.Client{Transport: notifyTransport{service}}
+}
+
+// Open a TCP connection for a message service that doesn't speak HTTP
+func dialNotify(service, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return dialService(ctx, service, "tcp", addr)
+}
+
+// Dial with the address family, interface and source address the options pin. Without
+// a family Go tries IPv6 and IPv4 in parallel (happy eyeballs), which is what works on
+// single-stack hosts too; a source address narrows it to its own family.
+func dialWithOptions(ctx context.Context, options NetworkOptions, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if options.Interface != "" {
+		dialer.Control = bindToDevice(options.Interface)
+	}
+	if source := net.ParseIP(options.Source); source != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: source}
+		if options.Family == "" && source.To4() != nil {
+			options.Family = familyIPv4
+		} else if options.Family == "" {
+			options.Family = familyIPv6
+		}
+	}
+	switch options.Family {
+	case familyIPv4:
+		network = "tcp4"
+	case familyIPv6:
+		network = "tcp6"
+		addr = nat64Address(ctx, addr)
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// NAT64 prefix of the network, found once through the DNS64 resolver
+var nat64 struct {
+	once   sync.Once
+	prefix net.IP
+}
+
+// Well-known IPv4 addresses of ipv4only.arpa (RFC 7050), a DNS64 resolver answers
+// with them embedded in its prefix
+var ipv4OnlyAddresses = []string{"192.0.0.170", "192.0.0.171"}
+
+// Find the NAT64 prefix by asking for the IPv6 addresses of ipv4only.arpa, which only
+// has IPv4 ones. Only the /96 prefixes are recognized, they are the common ones.
+func nat64Prefix(ctx context.Context) net.IP {
+	nat64.once.Do(func() {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip6", "ipv4only.arpa")
+		if err != nil {
+			return
+		}
+		for _, ip := range ips {
+			if ip.To4() == nil && slices.Contains(ipv4OnlyAddresses, net.IP(ip[12:]).String()) {
+				nat64.prefix = slices.Clone(ip[:12])
+				logf("Found NAT64 prefix %s/96, IPv4-only message services are reached through it\n", append(slices.Clone(nat64.prefix), 0, 0, 0, 0))
+				return
+			}
+		}
+	})
+	return nat64.prefix
+}
+
+// Turn an address without IPv6 into one behind the NAT64 gateway. Names that resolve
+// to IPv6 (DNS64 synthesizes them already) and hosts without NAT64 stay as they are.
+func nat64Address(ctx context.Context, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	var ipv4 net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ipv4 = ip.To4()
+	} else if ips, err := net.DefaultResolver.LookupIP(ctx, "ip6", host); err == nil && len(ips) > 0 {
+		return addr
+	} else if ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host); err == nil && len(ips) > 0 {
+		ipv4 = ips[0].To4()
+	}
+	prefix := nat64Prefix(ctx)
+	if ipv4 == nil || prefix == nil {
+		return addr
+	}
+	return net.JoinHostPort(append(slices.Clone(prefix), ipv4...).String(), port)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type NicHealth struct {
+	Enabled     bool     `json:"enabled"`      // 是否检查网卡健康计数器
+	Counters    []string `json:"counters"`     // 关注的计数器名称，支持通配符，如rx_queue_*_drops
+	MinIncrease uint64   `json:"min_increase"` // 单个周期内增加多少才提醒，默认1
+}
+
+// Counters watched when none are configured, available on most drivers
+var defaultNicCounters = []string{"rx_missed_errors", "rx_crc_errors", "rx_fifo_errors", "rx_over_errors", "tx_fifo_errors"}
+
+// Counter values from the previous interval per interface, kept in memory only
+var lastNicCounters = map[string]map[string]uint64{}
+
+// Read the NIC statistics via `ethtool -S`, falling back to sysfs when ethtool is unavailable
+func readNicCounters(iface string) (map[string]uint64, error) {
+	if commandExists("ethtool") {
+		output, err := exec.Command("ethtool", "-S", iface).Output()
+		if err == nil {
+			return parseEthtoolStats(output), nil
+		}
+	}
+	return readSysfsCounters(iface)
+}
+
+// Parse the "name: value" lines printed by `ethtool -S`
+func parseEthtoolStats(output []byte) map[string]uint64 {
+	counters := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		number, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		counters[strings.TrimSpace(name)] = number
+	}
+	return counters
+}
+
+// Read the generic counters from /sys/class/net/<iface>/statistics
+func readSysfsCounters(iface string) (map[string]uint64, error) {
+	dir := filepath.Join("/sys/class/net", iface, "statistics")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]uint64)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		number, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue
+		}
+		counters[entry.Name()] = number
+	}
+	return counters, nil
+}
+
+// Check whether a counter name matches one of the watched patterns
+func watchedNicCounter(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare the watched NIC counters with the previous interval and alert on rising values
+func checkNicHealth(config *Config, ifaces []string) {
+	patterns := config.NicHealth.Counters
+	if len(patterns) == 0 {
+		patterns = defaultNicCounters
+	}
+	minIncrease := config.NicHealth.MinIncrease
+	if minIncrease == 0 {
+		minIncrease = 1
+	}
+
+	observing := learning(config, time.Now())
+	for _, iface := range ifaces {
+		// ethtool and sysfs only see the host namespace
+		if _, netns := splitInterface(iface); netns != "" {
+			continue
+		}
+		counters, err := readNicCounters(iface)
+		if err != nil {
+			logf("Failed to read NIC statistics of %s: %v\n", iface, err)
+			continue
+		}
+
+		// The first sample only builds the baseline
+		previous, ok := lastNicCounters[iface]
+		lastNicCounters[iface] = counters
+		if !ok {
+			continue
+		}
+
+		var rising, names []string
+		for name, value := range counters {
+			if !watchedNicCounter(patterns, name) {
+				continue
+			}
+			last, ok := previous[name]
+			if !ok || value < last {
+				continue
+			}
+			// The increases seen while observing are normal for this NIC
+			if observing {
+				learnNicIncrease(config, iface, name, value-last)
+			} else if value-last <= nicBaseline(config, iface, name) {
+				continue
+			}
+			if value-last < minIncrease {
+				continue
+			}
+			rising = append(rising, fmt.Sprintf(tr("%s 增加了 %d（当前 %d）"), name, value-last, value))
+			names = append(names, name)
+		}
+		sort.Strings(rising)
+		sort.Strings(names)
+
+		message := fmt.Sprintf(tr("网卡异常：%s 的错误计数器持续上升\n%s"), iface, strings.Join(rising, "\n"))
+		if observing {
+			if len(rising) > 0 {
+				logf("%s\nObservation period, NIC health alert not sent\n", message)
+			}
+			continue
+		}
+		// Only a counter that starts rising alerts, one that keeps rising was reported already
+		if !updateNicRising(config, iface, names) {
+			continue
+		}
+		logf("%s\n", message)
+		err = sendMessage(config, message)
+		reportHealth(config, healthSend, err)
+		if err != nil {
+			logf("Failed to send NIC health message: %v\n", err)
+		}
+	}
+}
+
+// Remember the counters of an interface that are rising now, reports whether one of
+// them wasn't rising at the previous sample
+func updateNicRising(config *Config, iface string, names []string) bool {
+	alerted := config.Statistics.NicRising[iface]
+	started := false
+	for _, name := range names {
+		if !slices.Contains(alerted, name) {
+			started = true
+		}
+	}
+	for _, name := range alerted {
+		if !slices.Contains(names, name) {
+			logf("NIC counter %s of %s stopped rising\n", name, iface)
+		}
+	}
+	if len(names) == 0 {
+		delete(config.Statistics.NicRising, iface)
+		return false
+	}
+	if config.Statistics.NicRising == nil {
+		config.Statistics.NicRising = make(map[string][]string)
+	}
+	config.Statistics.NicRising[iface] = names
+	return started
+}
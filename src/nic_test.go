@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestUpdateNicRising(t *testing.T) {
+	quiet = true
+	config := &Config{}
+	steps := []struct {
+		names []string
+		alert bool
+	}{
+		{[]string{"rx_missed_errors"}, true},
+		{[]string{"rx_missed_errors"}, false},
+		{[]string{"rx_crc_errors", "rx_missed_errors"}, true},
+		{[]string{"rx_crc_errors"}, false},
+		{nil, false},
+		{[]string{"rx_crc_errors"}, true},
+	}
+	for i, step := range steps {
+		if got := updateNicRising(config, "eth0", step.names); got != step.alert {
+			t.Errorf("step %d: alert %v, want %v", i, got, step.alert)
+		}
+	}
+}
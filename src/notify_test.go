@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendTelegramMessage(t *testing.T) {
+	quiet = true
+	replay := replayHTTP(t, "telegram")
+	config := &Config{Device: "router"}
+	config.Message.Telegram = TelegramMessage{Token: "123456:test", ChatID: "1001", ChatIDs: []string{"1002"}}
+
+	// Delivered to one of the chats, the other one's error is only logged
+	if err := sendTelegramMessage(config, "quota"); err != nil {
+		t.Fatal(err)
+	}
+	for i, chat := range []string{"1001", "1002"} {
+		body := replay.body(t, i)
+		if body["chat_id"] != chat || body["text"] != "[router] quota" {
+			t.Errorf("request %d: %v", i, body)
+		}
+	}
+
+	config.Message.Telegram = TelegramMessage{Token: "123456:revoked", ChatID: "1001"}
+	err := sendTelegramMessage(config, "quota")
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("revoked token: %v", err)
+	}
+}
+
+func TestSendBarkMessage(t *testing.T) {
+	quiet = true
+	replay := replayHTTP(t, "bark")
+	config := &Config{Device: "router", urgent: true}
+	config.Message.Bark = BarkMessage{Key: "key"}
+
+	if err := sendBarkMessage(config, "shutdown"); err != nil {
+		t.Fatal(err)
+	}
+	body := replay.body(t, 0)
+	if body["device_key"] != "key" || body["level"] != "timeSensitive" || body["group"] != "netMonitor" {
+		t.Errorf("request: %v", body)
+	}
+
+	config.Message.Bark.URL = "https://bark.example.com/"
+	err := sendBarkMessage(config, "shutdown")
+	if err == nil || !strings.Contains(err.Error(), "device not found") {
+		t.Errorf("unknown device: %v", err)
+	}
+}
+
+func TestSendNtfyMessage(t *testing.T) {
+	quiet = true
+	replay := replayHTTP(t, "ntfy")
+	config := &Config{Device: "router"}
+	config.Message.Ntfy = NtfyMessage{Topic: "router-alerts"}
+
+	if err := sendNtfyMessage(config, "quota"); err != nil {
+		t.Fatal(err)
+	}
+	body := replay.body(t, 0)
+	if body["topic"] != "router-alerts" || body["priority"] != 4.0 || body["title"] != "router" {
+		t.Errorf("request: %v", body)
+	}
+
+	// Shutdown warnings go out with the urgent priority
+	config.urgent = true
+	if err := sendNtfyMessage(config, "shutdown"); err != nil {
+		t.Fatal(err)
+	}
+	if body := replay.body(t, 1); body["priority"] != 5.0 {
+		t.Errorf("urgent request: %v", body)
+	}
+
+	config.Message.Ntfy.URL = "https://ntfy.example.com/"
+	err := sendNtfyMessage(config, "quota")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("forbidden topic: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The payload when no template is configured, every field once
+const defaultWebhookTemplate = `{"device": "{{device}}", "message": "{{message}}", "usage": {{usage}}, "limit": {{limit}}, "percent": {{percent}}, "category": "{{category}}", "time": "{{time}}"}`
+
+type WebhookMessage struct {
+	ThresholdStatus bool              `json:"threshold_status"`
+	RatioStatus     bool              `json:"ratio_status"`
+	URL             string            `json:"url"`               // 接收POST请求的地址
+	Template        string            `json:"template"`          // JSON模板，{{message}}等占位符在发送时替换，为空时使用默认格式
+	Headers         map[string]string `json:"headers,omitempty"` // 附加的请求头，如Authorization
+}
+
+// Check the webhook settings when it is the selected service. The template is filled
+// with sample values, it has to give valid JSON for any message.
+func validateWebhook(webhook WebhookMessage) error {
+	if webhook.URL == "" {
+		return fmt.Errorf("webhook needs a url")
+	}
+	sample := webhookPayload(webhook.Template, map[string]string{
+		"device": "device", "message": "line \"one\"\nline two", "category": "download",
+		"time": time.Now().Format(time.RFC3339), "usage": "1.00", "limit": "2.00", "percent": "50.0",
+	})
+	if !json.Valid([]byte(sample)) {
+		return fmt.Errorf("webhook template doesn't give valid JSON: %s", sample)
+	}
+	return nil
+}
+
+// Fill the template. Text is JSON-escaped so it can stand between quotes, numbers are
+// plain so they can stand without.
+func webhookPayload(template string, fields map[string]string) string {
+	if template == "" {
+		template = defaultWebhookTemplate
+	}
+	var pairs []string
+	for name, value := range fields {
+		switch name {
+		case "usage", "limit", "percent":
+		default:
+			escaped, _ := json.Marshal(value)
+			value = string(escaped[1 : len(escaped)-1])
+		}
+		pairs = append(pairs, "{{"+name+"}}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// POST the message with the period's usage to the configured URL
+func sendWebhookMessage(config *Config, message string) error {
+	webhook := config.Message.Webhook
+	usage := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+	limit := effectiveLimit(config)
+	percent := 0.0
+	if limit > 0 {
+		percent = usage / limit * 100
+	}
+	payload := webhookPayload(webhook.Template, map[string]string{
+		"device":   config.Device,
+		"message":  message,
+		"category": config.Comparison.Category,
+		"time":     time.Now().Format(time.RFC3339),
+		"usage":    fmt.Sprintf("%.2f", usage),
+		"limit":    fmt.Sprintf("%.2f", limit),
+		"percent":  fmt.Sprintf("%.1f", percent),
+	})
+
+	req, err := http.NewRequest("POST", webhook.URL, strings.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := notifyClient("webhook").Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("got error status from webhook: %s %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
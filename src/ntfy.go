@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ntfy's public server, used when no url is set
+const defaultNtfyURL = "https://ntfy.sh"
+
+type NtfyMessage struct {
+	ThresholdStatus bool     `json:"threshold_status"`
+	RatioStatus     bool     `json:"ratio_status"`
+	URL             string   `json:"url"`                       // 服务器地址，为空时使用https://ntfy.sh
+	Topic           string   `json:"topic"`                     // 发布到的主题
+	Token           string   `json:"token,omitempty"`           // 访问令牌，需要登录的服务器使用
+	Username        string   `json:"username,omitempty"`        // 或者使用用户名和密码登录
+	Password        string   `json:"password,omitempty"`        // 登录密码
+	Priority        int      `json:"priority,omitempty"`        // 流量提醒等消息的优先级1-5，默认4
+	Tags            []string `json:"tags,omitempty"`            // 流量提醒等消息的标签，默认warning
+	UrgentPriority  int      `json:"urgent_priority,omitempty"` // 关机警告和倒计时提醒的优先级，默认5
+	UrgentTags      []string `json:"urgent_tags,omitempty"`     // 关机警告的标签，默认rotating_light
+}
+
+// Check the ntfy settings when it is the selected service
+func validateNtfy(ntfy NtfyMessage) error {
+	if ntfy.Topic == "" {
+		return fmt.Errorf("ntfy needs a topic")
+	}
+	for _, priority := range []int{ntfy.Priority, ntfy.UrgentPriority} {
+		if priority < 0 || priority > 5 {
+			return fmt.Errorf("invalid ntfy priority %d, must be 1 to 5", priority)
+		}
+	}
+	return nil
+}
+
+// Publish a message to the topic, shutdown warnings with the urgent priority and tags
+func sendNtfyMessage(config *Config, message string) error {
+	ntfy := config.Message.Ntfy
+	priority, tags := ntfy.Priority, ntfy.Tags
+	if priority == 0 {
+		priority = 4
+	}
+	if len(tags) == 0 {
+		tags = []string{"warning"}
+	}
+	if config.urgent {
+		priority, tags = ntfy.UrgentPriority, ntfy.UrgentTags
+		if priority == 0 {
+			priority = 5
+		}
+		if len(tags) == 0 {
+			tags = []string{"rotating_light"}
+		}
+	}
+
+	// Published as JSON to the server's root, the topic goes in the body
+	jsonBody, _ := json.Marshal(map[string]any{
+		"topic":    ntfy.Topic,
+		"title":    config.Device,
+		"message":  message,
+		"priority": priority,
+		"tags":     tags,
+	})
+	url := ntfy.URL
+	if url == "" {
+		url = defaultNtfyURL
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(url, "/"), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request to ntfy: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ntfy.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+ntfy.Token)
+	} else if ntfy.Username != "" {
+		req.SetBasicAuth(ntfy.Username, ntfy.Password)
+	}
+
+	resp, err := notifyClient("ntfy").Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message to ntfy: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("got error status from ntfy: %s", resp.Status)
+	}
+	return nil
+}
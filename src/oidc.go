@@ -0,0 +1,299 @@
+//go:build !noweb
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookies of the OIDC login
+const (
+	sessionCookie  = "netmonitor_session"
+	stateCookie    = "netmonitor_state"
+	sessionTimeout = 12 * time.Hour
+)
+
+// The endpoints from the provider's discovery document, fetched at the first login
+type oidcEndpoints struct {
+	Authorization string `json:"authorization_endpoint"`
+	Token         string `json:"token_endpoint"`
+	Userinfo      string `json:"userinfo_endpoint"`
+}
+
+var oidcState struct {
+	sync.Mutex
+	endpoints *oidcEndpoints
+}
+
+// Sessions are signed with a key made at startup, a restart logs everyone out
+var sessionKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+type session struct {
+	Name    string `json:"name"`
+	Role    string `json:"role"`
+	Expires int64  `json:"expires"`
+}
+
+// Check the OIDC settings
+func validateOIDC(config *OIDCConfig) error {
+	if config.Issuer == "" {
+		return nil
+	}
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return fmt.Errorf("oidc needs client_id and redirect_url")
+	}
+	if _, err := url.Parse(config.RedirectURL); err != nil {
+		return fmt.Errorf("invalid oidc redirect_url: %v", err)
+	}
+	for group, role := range config.Roles {
+		if role != roleAdmin && role != roleViewer {
+			return fmt.Errorf("invalid role of oidc group %s: %s", group, role)
+		}
+	}
+	return nil
+}
+
+// Fetch the provider's endpoints once, a failed fetch is retried at the next login
+func discoverOIDC(config *OIDCConfig) (*oidcEndpoints, error) {
+	oidcState.Lock()
+	defer oidcState.Unlock()
+	if oidcState.endpoints != nil {
+		return oidcState.endpoints, nil
+	}
+
+	resp, err := http.Get(strings.TrimRight(config.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch oidc discovery: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got error status from oidc discovery: %s", resp.Status)
+	}
+	var endpoints oidcEndpoints
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+		return nil, fmt.Errorf("invalid oidc discovery: %v", err)
+	}
+	if endpoints.Authorization == "" || endpoints.Token == "" || endpoints.Userinfo == "" {
+		return nil, fmt.Errorf("oidc discovery lacks authorization, token or userinfo endpoint")
+	}
+	oidcState.endpoints = &endpoints
+	return &endpoints, nil
+}
+
+// Sign a session into a cookie value
+func encodeSession(s session) string {
+	data, _ := json.Marshal(s)
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Check a session cookie's signature and expiry
+func decodeSession(value string) (session, bool) {
+	var s session
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return s, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return s, false
+	}
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return s, false
+	}
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write(data)
+	if !hmac.Equal(given, mac.Sum(nil)) || json.Unmarshal(data, &s) != nil {
+		return s, false
+	}
+	return s, time.Now().Unix() < s.Expires
+}
+
+// The user of a valid session cookie
+func sessionPrincipal(r *http.Request) (principal, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return principal{}, false
+	}
+	s, ok := decodeSession(cookie.Value)
+	if !ok {
+		return principal{}, false
+	}
+	return principal{name: s.Name, role: s.Role}, true
+}
+
+// The highest role of the user's groups, empty when no group is mapped
+func oidcRole(config *OIDCConfig, claims map[string]any) string {
+	claim := config.GroupsClaim
+	if claim == "" {
+		claim = "groups"
+	}
+	var groups []string
+	switch value := claims[claim].(type) {
+	case string:
+		groups = strings.Split(value, ",")
+	case []any:
+		for _, group := range value {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+	}
+
+	role := ""
+	for _, group := range groups {
+		switch config.Roles[strings.TrimSpace(group)] {
+		case roleAdmin:
+			return roleAdmin
+		case roleViewer:
+			role = roleViewer
+		}
+	}
+	return role
+}
+
+// GET /auth/login, send the browser to the provider
+func handleOIDCLogin(config *OIDCConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoints, err := discoverOIDC(config)
+		if err != nil {
+			logf("OIDC login failed: %v\n", err)
+			http.Error(w, "login provider unavailable", http.StatusBadGateway)
+			return
+		}
+
+		secret := make([]byte, 16)
+		rand.Read(secret)
+		state := hex.EncodeToString(secret)
+		http.SetCookie(w, &http.Cookie{Name: stateCookie, Value: state, Path: "/auth/", MaxAge: 600,
+			HttpOnly: true, Secure: strings.HasPrefix(config.RedirectURL, "https:"), SameSite: http.SameSiteLaxMode})
+
+		query := url.Values{
+			"response_type": {"code"},
+			"client_id":     {config.ClientID},
+			"redirect_uri":  {config.RedirectURL},
+			"scope":         {"openid profile email groups"},
+			"state":         {state},
+		}
+		http.Redirect(w, r, endpoints.Authorization+"?"+query.Encode(), http.StatusFound)
+	}
+}
+
+// GET /auth/callback, exchange the code and look the user up. The claims come from
+// the userinfo endpoint over TLS, so the ID token's signature needn't be checked here.
+func handleOIDCCallback(config *OIDCConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(stateCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.URL.Query().Get("state"))) != 1 {
+			http.Error(w, "invalid login state, please try again", http.StatusBadRequest)
+			return
+		}
+		claims, err := exchangeOIDCCode(config, r.URL.Query().Get("code"))
+		if err != nil {
+			logf("OIDC login failed: %v\n", err)
+			http.Error(w, "login failed", http.StatusBadGateway)
+			return
+		}
+
+		name := ""
+		for _, key := range []string{"preferred_username", "email", "sub"} {
+			if value, ok := claims[key].(string); ok && value != "" {
+				name = value
+				break
+			}
+		}
+		role := oidcRole(config, claims)
+		if role == "" {
+			logAuthFailure(r, "no-role", name)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		secure := strings.HasPrefix(config.RedirectURL, "https:")
+		http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth/", MaxAge: -1})
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    encodeSession(session{Name: name, Role: role, Expires: time.Now().Add(sessionTimeout).Unix()}),
+			Path:     "/",
+			MaxAge:   int(sessionTimeout.Seconds()),
+			HttpOnly: true,
+			Secure:   secure,
+			// Cross-site posts don't carry the session, which protects the control forms
+			SameSite: http.SameSiteLaxMode,
+		})
+		logf("OIDC user %s logged in as %s\n", name, role)
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
+
+// Trade the authorization code for an access token and fetch the user's claims
+func exchangeOIDCCode(config *OIDCConfig, code string) (map[string]any, error) {
+	endpoints, err := discoverOIDC(config)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.PostForm(endpoints.Token, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %v", err)
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got error status from token endpoint: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("no access token in token response")
+	}
+
+	req, err := http.NewRequest("GET", endpoints.Userinfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	info, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch userinfo: %v", err)
+	}
+	defer info.Body.Close()
+	if info.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got error status from userinfo endpoint: %s", info.Status)
+	}
+	var claims map[string]any
+	if err := json.NewDecoder(info.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("invalid userinfo: %v", err)
+	}
+	return claims, nil
+}
+
+// GET /auth/logout
+func handleOIDCLogout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	fmt.Fprintln(w, "logged out")
+}
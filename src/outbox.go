@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	sendAttempts     = 3           // tries of a message part before the send fails
+	sendRetryDelay   = time.Second // wait before the second try, doubled for each further one
+	outboxLimit      = 100         // queued messages kept, the oldest are dropped beyond it
+	outboxRetryDelay = time.Minute // wait before the first retry from the queue, doubled up to outboxMaxDelay
+	outboxMaxDelay   = time.Hour
+	outboxMaxAge     = 24 * time.Hour // queued messages are dropped when still undelivered after this
+)
+
+type OutboxEntry struct {
+	Service     string `json:"service"`
+	Message     string `json:"message"`
+	Time        string `json:"time"`         // 消息产生的时间，RFC3339格式
+	Attempts    int    `json:"attempts"`     // 从队列中重试的次数
+	NextAttempt string `json:"next_attempt"` // 下次重试的时间，RFC3339格式
+}
+
+// Send a message part, trying again after a short and growing wait so a brief outage of
+// the service doesn't lose it. Near the limit only urgent messages are tried again
+// right away, the others go to the queue.
+func sendPartWithRetry(config *Config, service, part string) error {
+	attempts := sendAttempts
+	if conserveActive && !config.urgent {
+		attempts = 1
+	}
+	delay := sendRetryDelay
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if err = sendMessagePart(config, service, part); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Send a message to the services and queue it for those that didn't get it, the queue
+// is retried on the following samples. The error is only set when none got it.
+func sendQueuedMessage(config *Config, services []string, message string) error {
+	sent, err := sendMessageTo(config, services, message)
+	now := time.Now()
+	for _, service := range services {
+		if !slices.Contains(sent, service) {
+			queueMessage(config, service, message, now)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%v, queued for retry", err)
+	}
+	return nil
+}
+
+// Add a message to the outbox, it is saved with the config so a restart doesn't lose it
+func queueMessage(config *Config, service, message string, now time.Time) {
+	queueMessageAt(config, service, message, now, now.Add(outboxRetryDelay))
+}
+
+// Add a message to the outbox that isn't sent before next
+func queueMessageAt(config *Config, service, message string, now, next time.Time) {
+	outbox := append(config.Message.Outbox, OutboxEntry{
+		Service:     service,
+		Message:     message,
+		Time:        now.Format(time.RFC3339),
+		NextAttempt: next.Format(time.RFC3339),
+	})
+	if len(outbox) > outboxLimit {
+		logf("Outbox full, dropped %d of the oldest queued messages\n", len(outbox)-outboxLimit)
+		outbox = outbox[len(outbox)-outboxLimit:]
+	}
+	config.Message.Outbox = outbox
+}
+
+// Retry the queued messages that are due, oldest first. A service that fails again
+// keeps the rest of its messages for its next retry, so a long outage costs one try
+// per sample.
+func flushOutbox(config *Config, now time.Time) {
+	if len(config.Message.Outbox) == 0 {
+		return
+	}
+	// Health events sent meanwhile queue their own entries behind these
+	queued := config.Message.Outbox
+	config.Message.Outbox = nil
+	var kept []OutboxEntry
+	failed := make(map[string]string)
+	for _, entry := range queued {
+		queuedAt, _ := time.Parse(time.RFC3339, entry.Time)
+		if now.Sub(queuedAt) > outboxMaxAge {
+			logf("Dropped message to %s queued at %s, undelivered for %s\n", entry.Service, entry.Time, outboxMaxAge)
+			continue
+		}
+		next, _ := time.Parse(time.RFC3339, entry.NextAttempt)
+		if now.Before(next) {
+			kept = append(kept, entry)
+			continue
+		}
+		if retryAt, ok := failed[entry.Service]; ok {
+			entry.NextAttempt = retryAt
+			kept = append(kept, entry)
+			continue
+		}
+
+		message := entry.Message + fmt.Sprintf(tr("\n（延迟送达，原定于%s发送）"), queuedAt.Local().Format("01-02 15:04"))
+		err := sendServiceMessage(config, entry.Service, message)
+		reportHealth(config, healthSend, err)
+		if err == nil {
+			logf("Delivered message to %s queued at %s\n", entry.Service, entry.Time)
+			continue
+		}
+		entry.Attempts++
+		entry.NextAttempt = now.Add(outboxDelay(entry.Attempts)).Format(time.RFC3339)
+		failed[entry.Service] = entry.NextAttempt
+		logf("Queued message to %s failed again (retry %d), next at %s: %v\n", entry.Service, entry.Attempts, entry.NextAttempt, err)
+		kept = append(kept, entry)
+	}
+	config.Message.Outbox = append(kept, config.Message.Outbox...)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Room above the link speed before a delta counts as impossible, some drivers update
+// their counters in bursts and the sample times are only to the second
+const outlierMargin = 1.5
+
+// The most bytes the interface can move in one direction within the elapsed time,
+// zero when the link speed isn't known (virtual interfaces, other namespaces)
+func linkCapacity(iface string, elapsed time.Duration) uint64 {
+	name, netns := splitInterface(iface)
+	if netns != "" || elapsed <= 0 {
+		return 0
+	}
+	data, err := os.ReadFile(filepath.Join("/sys/class/net", name, "speed"))
+	if err != nil {
+		return 0
+	}
+	mbit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || mbit <= 0 {
+		return 0
+	}
+	return uint64(float64(mbit) * 1e6 / 8 * (elapsed.Seconds() + 1) * outlierMargin)
+}
+
+// Check a counter's delta against the link speed. An impossible delta, from a driver
+// glitch or a corrupted counter, is left out of the totals and noted in the history;
+// the counter itself is still taken as the base of the next delta.
+func rejectOutlier(config *Config, key string, receive, transmit uint64, elapsed time.Duration) bool {
+	if config.IgnoreLinkSpeed || config.Collector.Type != "" {
+		return false
+	}
+	capacity := linkCapacity(key, elapsed)
+	if capacity == 0 || receive <= capacity && transmit <= capacity {
+		return false
+	}
+	now := time.Now()
+	detail := fmt.Sprintf(tr("网卡%s的读数异常：%s内下载%.2f GB、上传%.2f GB，超过了网卡速率的上限，已从统计中排除"),
+		key, elapsed.Round(time.Second), float64(receive)/bytesToGB, float64(transmit)/bytesToGB)
+	addEvent(config, eventOutlier, now.Add(-elapsed), now, detail)
+	logf("Impossible reading on %s: %d/%d bytes in %s exceed the link speed, excluded\n",
+		key, receive, transmit, elapsed.Round(time.Second))
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type PauseState struct {
+	Since            string `json:"since"`           // 开始时间，RFC3339格式
+	Until            string `json:"until,omitempty"` // 截止时间，为空表示直到手动恢复
+	Reason           string `json:"reason,omitempty"`
+	By               string `json:"by,omitempty"`      // 暂停统计的用户
+	ExcludedReceive  uint64 `json:"excluded_receive"`  // 本次暂停期间排除的下载流量
+	ExcludedTransmit uint64 `json:"excluded_transmit"` // 本次暂停期间排除的上传流量
+}
+
+// Check whether accounting is paused, an expired pause is ended first
+func accountingPaused(config *Config, now time.Time) bool {
+	pause := config.Statistics.Pause
+	if pause == nil {
+		return false
+	}
+	if pause.Until != "" {
+		until, err := time.Parse(time.RFC3339, pause.Until)
+		if err == nil && !now.Before(until) {
+			resumeAccounting(config, until)
+			return false
+		}
+	}
+	return true
+}
+
+// Start excluding traffic from the billable totals
+func pauseAccounting(config *Config, command Command) {
+	if config.Statistics.Pause != nil {
+		// Extend or shorten the running pause
+		config.Statistics.Pause.Until = command.Until
+		if command.Reason != "" {
+			config.Statistics.Pause.Reason = command.Reason
+		}
+	} else {
+		config.Statistics.Pause = &PauseState{
+			Since:  time.Now().Format(time.RFC3339),
+			Until:  command.Until,
+			Reason: command.Reason,
+			By:     command.By,
+		}
+	}
+
+	if command.Until != "" {
+		logf("Accounting paused until %s: %s\n", command.Until, command.Reason)
+	} else {
+		logf("Accounting paused until resumed: %s\n", command.Reason)
+	}
+}
+
+// End the pause and record the excluded traffic in the history
+func resumeAccounting(config *Config, end time.Time) {
+	pause := config.Statistics.Pause
+	if pause == nil {
+		return
+	}
+	config.Statistics.Pause = nil
+
+	since, err := time.Parse(time.RFC3339, pause.Since)
+	if err != nil {
+		since = end
+	}
+	excludedGB := float64(pause.ExcludedReceive+pause.ExcludedTransmit) / bytesToGB
+	detail := fmt.Sprintf(tr("暂停统计，排除下载%.2f GB、上传%.2f GB"), float64(pause.ExcludedReceive)/bytesToGB, float64(pause.ExcludedTransmit)/bytesToGB)
+	if pause.Reason != "" {
+		detail += "：" + pause.Reason
+	}
+	addEventBy(config, eventPause, since, end, detail, pause.By)
+
+	logf("Accounting resumed, %.2f GB excluded during the pause\n", excludedGB)
+}
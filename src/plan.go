@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Units of the traffic figures, providers differ in what a GB is
+const (
+	unitBinary  = "GiB" // 1 GB = 1024³ bytes
+	unitDecimal = "GB"  // 1 GB = 1000³ bytes
+)
+
+// Bytes per unit, set from the config's unit at startup
+var (
+	sizeBase  = 1024.0
+	bytesToGB = sizeBase * sizeBase * sizeBase
+)
+
+// How a provider meters its traffic allowance
+type planPreset struct {
+	category string // 计入限额的方向
+	unit     string // 流量单位
+	startDay int    // 重置日，0表示按购买日重置，需要自己填写start_day
+}
+
+// Presets selected with `plan`, from the providers' published metering rules
+var planPresets = map[string]planPreset{
+	"hetzner-cloud":      {category: "upload", unit: unitBinary, startDay: 1},
+	"aws-lightsail":      {category: "upload+download", unit: unitBinary, startDay: 1},
+	"digitalocean":       {category: "upload", unit: unitBinary, startDay: 1},
+	"vultr":              {category: "upload", unit: unitBinary, startDay: 1},
+	"linode":             {category: "upload", unit: unitDecimal, startDay: 1},
+	"tencent-lighthouse": {category: "upload", unit: unitBinary, startDay: 1},
+	"aliyun-swas":        {category: "upload", unit: unitBinary},
+}
+
+// Names of the presets for error messages
+func planNames() string {
+	var names []string
+	for name := range planPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Fill in what the plan's preset defines and the config leaves empty, explicit values win
+func applyPlan(config *Config) error {
+	if config.Plan == "" {
+		return nil
+	}
+	preset, ok := planPresets[config.Plan]
+	if !ok {
+		return fmt.Errorf("unknown plan %q, must be one of: %s", config.Plan, planNames())
+	}
+	if config.Comparison.Category == "" {
+		config.Comparison.Category = preset.category
+	}
+	if config.Unit == "" {
+		config.Unit = preset.unit
+	}
+	if config.StartDay == 0 && preset.startDay != 0 {
+		config.StartDay = preset.startDay
+	}
+	return nil
+}
+
+// Use the configured unit for all traffic figures
+func applyUnit(config *Config) {
+	if config.Unit == unitDecimal {
+		sizeBase = 1000
+	} else {
+		sizeBase = 1024
+	}
+	bytesToGB = sizeBase * sizeBase * sizeBase
+}
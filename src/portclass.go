@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// nftables table owned by netmonitor, recreated at every start
+const nftTable = "netmonitor"
+
+type PortClass struct {
+	Name  string   `json:"name"`  // 分类名称，只能包含字母、数字和下划线
+	Ports []string `json:"ports"` // 端口或端口范围，例如"443"、"6881-6889"
+}
+
+type PortAccounting struct {
+	Enabled bool        `json:"enabled"` // 是否通过nftables计数器按端口分类统计
+	Classes []PortClass `json:"classes"`
+}
+
+var (
+	portClassName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	portPattern   = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+)
+
+// nftables counter values from the previous sample, they restart at zero with the table
+var lastPortCounters = map[string]uint64{}
+
+// Check the port classes before they are turned into nftables rules
+func validatePortClasses(classes []PortClass) error {
+	seen := make(map[string]bool)
+	for _, class := range classes {
+		if !portClassName.MatchString(class.Name) {
+			return fmt.Errorf("invalid port class name %q, only letters, digits and _ are allowed", class.Name)
+		}
+		if seen[class.Name] {
+			return fmt.Errorf("duplicate port class %q", class.Name)
+		}
+		seen[class.Name] = true
+		if len(class.Ports) == 0 {
+			return fmt.Errorf("port class %q has no ports", class.Name)
+		}
+		for _, port := range class.Ports {
+			if !portPattern.MatchString(port) {
+				return fmt.Errorf("invalid port %q in port class %q", port, class.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Build the nftables script with one rx and one tx counter per class. A packet is counted
+// by the first class whose port matches either side, so classes never overlap.
+func buildPortClassRules(classes []PortClass, ifaces []string) string {
+	var quoted []string
+	for _, iface := range ifaces {
+		quoted = append(quoted, fmt.Sprintf("%q", iface))
+	}
+	ifaceSet := "{ " + strings.Join(quoted, ", ") + " }"
+
+	var b strings.Builder
+	// Declaring the table first makes the delete succeed when it doesn't exist yet
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %s\n", nftTable, nftTable)
+	fmt.Fprintf(&b, "table inet %s {\n", nftTable)
+	for _, class := range classes {
+		fmt.Fprintf(&b, "\tcounter %s_rx {}\n\tcounter %s_tx {}\n", class.Name, class.Name)
+	}
+
+	chains := []struct{ name, hook, match, suffix string }{
+		{"input", "input", "iifname", "rx"},
+		{"output", "output", "oifname", "tx"},
+	}
+	for _, chain := range chains {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %s priority -150; policy accept;\n", chain.name, chain.hook)
+		for _, class := range classes {
+			ports := "{ " + strings.Join(class.Ports, ", ") + " }"
+			for _, side := range []string{"sport", "dport"} {
+				fmt.Fprintf(&b, "\t\t%s %s meta l4proto { tcp, udp } th %s %s counter name \"%s_%s\" accept\n",
+					chain.match, ifaceSet, side, ports, class.Name, chain.suffix)
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Create the nftables table with the port class counters for the monitored interfaces
+func setupPortAccounting(config *Config, ifaces []string) error {
+	if !commandExists("nft") {
+		return fmt.Errorf("nft command not found")
+	}
+
+	// nftables only sees the host namespace
+	var hostIfaces []string
+	for _, iface := range ifaces {
+		if name, netns := splitInterface(iface); netns == "" {
+			hostIfaces = append(hostIfaces, name)
+		}
+	}
+	if len(hostIfaces) == 0 {
+		return fmt.Errorf("no monitored interface in the host namespace")
+	}
+
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(buildPortClassRules(config.PortAccounting.Classes, hostIfaces))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create nftables counters: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	lastPortCounters = map[string]uint64{}
+	return nil
+}
+
+// Read the byte values of the netmonitor nftables counters
+func readPortCounters() (map[string]uint64, error) {
+	output, err := exec.Command("nft", "-j", "list", "counters", "table", "inet", nftTable).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nftables counters: %v", err)
+	}
+
+	var result struct {
+		Nftables []struct {
+			Counter *struct {
+				Name  string `json:"name"`
+				Bytes uint64 `json:"bytes"`
+			} `json:"counter"`
+		} `json:"nftables"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(output)).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]uint64)
+	for _, item := range result.Nftables {
+		if item.Counter != nil {
+			counters[item.Counter.Name] = item.Counter.Bytes
+		}
+	}
+	return counters, nil
+}
+
+// Add the traffic of each port class since the previous sample to the period totals
+func updatePortClasses(config *Config) error {
+	counters, err := readPortCounters()
+	if err != nil {
+		return err
+	}
+
+	if config.Statistics.PortClasses == nil {
+		config.Statistics.PortClasses = make(map[string]NetStats)
+	}
+	for _, class := range config.PortAccounting.Classes {
+		receive := portCounterDelta(counters, class.Name+"_rx")
+		transmit := portCounterDelta(counters, class.Name+"_tx")
+		// Traffic during a pause is not billable, same as the totals
+		if config.Statistics.Pause != nil {
+			continue
+		}
+		stats := config.Statistics.PortClasses[class.Name]
+		stats.ReceiveBytes += receive
+		stats.TransmitBytes += transmit
+		config.Statistics.PortClasses[class.Name] = stats
+	}
+	return nil
+}
+
+// Difference of a counter since the previous sample, a smaller value means the table was recreated
+func portCounterDelta(counters map[string]uint64, name string) uint64 {
+	value := counters[name]
+	last := lastPortCounters[name]
+	lastPortCounters[name] = value
+	if value < last {
+		return value
+	}
+	return value - last
+}
+
+// Describe the split by port class for the period summary, the rest is listed as other traffic
+func describePortClasses(config *Config) string {
+	if len(config.Statistics.PortClasses) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(config.Statistics.PortClasses))
+	for name := range config.Statistics.PortClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	var classReceive, classTransmit uint64
+	for _, name := range names {
+		stats := config.Statistics.PortClasses[name]
+		classReceive += stats.ReceiveBytes
+		classTransmit += stats.TransmitBytes
+		lines = append(lines, fmt.Sprintf(tr("- %s：下载%.2f GB，上传%.2f GB"), name,
+			float64(stats.ReceiveBytes)/bytesToGB, float64(stats.TransmitBytes)/bytesToGB))
+	}
+
+	// The nftables counters only see the host's own traffic, so the rest is an estimate
+	var otherReceive, otherTransmit uint64
+	if config.Statistics.TotalReceive > classReceive {
+		otherReceive = config.Statistics.TotalReceive - classReceive
+	}
+	if config.Statistics.TotalTransmit > classTransmit {
+		otherTransmit = config.Statistics.TotalTransmit - classTransmit
+	}
+	lines = append(lines, fmt.Sprintf(tr("- 其他：下载%.2f GB，上传%.2f GB"),
+		float64(otherReceive)/bytesToGB, float64(otherTransmit)/bytesToGB))
+
+	return strings.Join(lines, "\n")
+}
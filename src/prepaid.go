@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const actionTopup = "topup"
+
+// The limit the usage is compared with: the purchased packages in prepaid mode,
+// the configured limit plus the data carried over from the last period otherwise
+func effectiveLimit(config *Config) float64 {
+	if config.Prepaid {
+		return config.Statistics.PrepaidGB
+	}
+	return config.Comparison.Limit + config.Statistics.RolloverGB
+}
+
+// The unused data of the ending period that rolls over into the next, up to rollover_cap
+func rolloverGB(config *Config) float64 {
+	if config.Prepaid || config.Comparison.RolloverCap <= 0 || config.Comparison.Limit <= 0 {
+		return 0
+	}
+	used := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+	return min(max(effectiveLimit(config)-used, 0), config.Comparison.RolloverCap)
+}
+
+// Clear the alert flags of all message services, so the alerts can be sent again
+func clearAlertStatus(config *Config) {
+	// Reset Telegram status flags
+	config.Message.Telegram.ThresholdStatus = false
+	config.Message.Telegram.RatioStatus = false
+
+	// Reset Gotify status flags
+	config.Message.Gotify.ThresholdStatus = false
+	config.Message.Gotify.RatioStatus = false
+
+	// Reset Discord status flags
+	config.Message.Discord.ThresholdStatus = false
+	config.Message.Discord.RatioStatus = false
+
+	// Reset Slack status flags
+	config.Message.Slack.ThresholdStatus = false
+	config.Message.Slack.RatioStatus = false
+
+	// Reset email status flags
+	config.Message.Email.ThresholdStatus = false
+	config.Message.Email.RatioStatus = false
+
+	// Reset webhook status flags
+	config.Message.Webhook.ThresholdStatus = false
+	config.Message.Webhook.RatioStatus = false
+
+	// Reset ntfy status flags
+	config.Message.Ntfy.ThresholdStatus = false
+	config.Message.Ntfy.RatioStatus = false
+
+	// Reset pushover status flags
+	config.Message.Pushover.ThresholdStatus = false
+	config.Message.Pushover.RatioStatus = false
+
+	// Reset bark status flags
+	config.Message.Bark.ThresholdStatus = false
+	config.Message.Bark.RatioStatus = false
+
+	// Reset serverchan status flags
+	config.Message.ServerChan.ThresholdStatus = false
+	config.Message.ServerChan.RatioStatus = false
+
+	// Reset dingtalk status flags
+	config.Message.DingTalk.ThresholdStatus = false
+	config.Message.DingTalk.RatioStatus = false
+
+	// Reset wecom status flags
+	config.Message.WeCom.ThresholdStatus = false
+	config.Message.WeCom.RatioStatus = false
+
+	// Reset feishu status flags
+	config.Message.Feishu.ThresholdStatus = false
+	config.Message.Feishu.RatioStatus = false
+
+	// Reset matrix status flags
+	config.Message.Matrix.ThresholdStatus = false
+	config.Message.Matrix.RatioStatus = false
+
+	// Reset teams status flags
+	config.Message.Teams.ThresholdStatus = false
+	config.Message.Teams.RatioStatus = false
+
+	// Reset mock status flags
+	config.Message.Mock.ThresholdStatus = false
+	config.Message.Mock.RatioStatus = false
+
+	// The limits count as not reached again
+	config.Statistics.ThresholdReached = ""
+	config.Statistics.RatioReached = ""
+}
+
+// Add a purchased package queued by `netmonitor topup`. The alerts are armed again,
+// they fire once more if the balance is still low after the top-up.
+func topUp(config *Config, command Command) {
+	if !config.Prepaid {
+		logf("Ignored top-up, prepaid mode is not enabled\n")
+		return
+	}
+	gb := float64(command.Bytes) / bytesToGB
+	config.Statistics.PrepaidGB += gb
+	clearAlertStatus(config)
+
+	detail := fmt.Sprintf(tr("充值%.2f GB，余额%.2f GB"), gb, prepaidBalance(config))
+	if command.Reason != "" {
+		detail += "：" + command.Reason
+	}
+	addEventBy(config, eventTopup, time.Now(), time.Time{}, detail, command.By)
+	logf("Topped up %.2f GB, %.2f GB purchased in total\n", gb, config.Statistics.PrepaidGB)
+}
+
+// The remaining prepaid balance in GB, negative when overdrawn
+func prepaidBalance(config *Config) float64 {
+	return config.Statistics.PrepaidGB - categoryUsageGB(config.Comparison.Category,
+		config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+}
+
+// netmonitor topup [--reason text] 50GB
+func runTopupCommand(args []string) int {
+	flags := flag.NewFlagSet("topup", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	reason := flags.String("reason", "", "Note recorded with the top-up, e.g. the order number")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: netmonitor topup [--reason text] <size, e.g. 50GB>")
+		return exitUsage
+	}
+
+	config, err := loadConfig(*configFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return loadErrorCode(err)
+	}
+	if !config.Prepaid {
+		fmt.Fprintln(os.Stderr, "prepaid mode is not enabled, set prepaid to true first")
+		return exitConfig
+	}
+
+	// The size is read in the unit the provider counts in
+	if err := applyPlan(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return exitConfig
+	}
+	if err := applyProfile(&config); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid config: %v\n", err)
+		return exitConfig
+	}
+	applyUnit(&config)
+	applyLanguage(&config)
+	size, err := parseSize(flags.Arg(0))
+	if err != nil || size == 0 {
+		fmt.Fprintf(os.Stderr, "invalid size %q, use e.g. 50GB\n", flags.Arg(0))
+		return exitUsage
+	}
+
+	if err := queueCommand(*configFilePath, Command{Action: actionTopup, Bytes: size, Reason: *reason}); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue top-up: %v\n", err)
+		return exitFailure
+	}
+	fmt.Printf("Top-up of %.2f GB queued\n", float64(size)/bytesToGB)
+	return exitOK
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Sources of the host's interface counters, tried in this order
+var hostSources = []struct {
+	name string
+	read func() (map[string]NetStats, error)
+}{
+	{"/proc/net/dev", func() (map[string]NetStats, error) { return readNetDev("/proc/net/dev") }},
+	{"sysfs", readSysfsStats},
+	{"netlink", readNetlinkStats},
+}
+
+// The source the host's counters are read from. It only moves on when the current one
+// fails, containers and hardened hosts may hide /proc/net or not mount /proc at all.
+var hostSource int
+
+// Read the host namespace's interface table from the first source that works
+func readHostStats() (map[string]NetStats, error) {
+	for {
+		source := hostSources[hostSource]
+		table, err := source.read()
+		if err == nil && len(table) == 0 {
+			err = errors.New("no interfaces listed")
+		}
+		if err == nil {
+			return table, nil
+		}
+		if hostSource == len(hostSources)-1 {
+			return nil, fmt.Errorf("failed to read interface counters from %s: %v", source.name, err)
+		}
+		hostSource++
+		logf("Cannot read interface counters from %s (%v), falling back to %s\n", source.name, err, hostSources[hostSource].name)
+	}
+}
+
+// Read the byte counters of every interface under /sys/class/net
+func readSysfsStats() (map[string]NetStats, error) {
+	entries, err := os.ReadDir("/sys/class/net")
+	if err != nil {
+		return nil, err
+	}
+	counter := func(iface, name string) (uint64, error) {
+		data, err := os.ReadFile(filepath.Join("/sys/class/net", iface, "statistics", name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	stats := make(map[string]NetStats)
+	for _, entry := range entries {
+		receive, err := counter(entry.Name(), "rx_bytes")
+		if err != nil {
+			continue
+		}
+		transmit, err := counter(entry.Name(), "tx_bytes")
+		if err != nil {
+			continue
+		}
+		stats[entry.Name()] = NetStats{ReceiveBytes: receive, TransmitBytes: transmit}
+	}
+	return stats, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A typical setup selected with `profile`, the rules a user would otherwise wire by hand
+type profilePreset struct {
+	category      string       // 计入限额的方向，plan已填写时以plan为准
+	unit          string       // 流量单位
+	interval      int          // 采样间隔秒数
+	threshold     float64      // 提醒阈值
+	ratio         float64      // 关机比例
+	shutdownDelay int          // 关机倒计时秒数
+	ladder        []LadderRung // 关机前的分级限制
+	safeMode      *LadderRung  // 超限关机后开机时的限制
+}
+
+var profilePresets = map[string]profilePreset{
+	// A VPS with a monthly allowance: slow down near the limit, power off just before
+	// the overage and keep SSH reachable after the next boot
+	"vps-quota": {
+		interval:      300,
+		threshold:     0.8,
+		ratio:         0.95,
+		shutdownDelay: 300,
+		ladder:        []LadderRung{{At: 0.9, Action: rungLimit, Rate: "10mbit"}},
+		safeMode:      &LadderRung{Action: rungBlock, Allow: []string{"22"}},
+	},
+	// A home router on a capped line: throttle instead of cutting the household off,
+	// power off only far beyond the limit
+	"home-router": {
+		category:      "upload+download",
+		interval:      300,
+		threshold:     0.8,
+		ratio:         1.5,
+		shutdownDelay: 600,
+		ladder:        []LadderRung{{At: 1, Action: rungLimit, Rate: "5mbit"}},
+	},
+	// A seedbox metered on upload: seed slower and slower as the limit comes closer
+	"seedbox": {
+		category:      "upload",
+		interval:      300,
+		threshold:     0.8,
+		ratio:         1,
+		shutdownDelay: 300,
+		ladder: []LadderRung{
+			{At: 0.85, Action: rungLimit, Rate: "100mbit"},
+			{At: 0.95, Action: rungLimit, Rate: "10mbit"},
+		},
+	},
+	// A mobile data plan counted in decimal GB: sample often, warn early and leave only
+	// SSH and DNS open before the data runs out
+	"metered-lte": {
+		category:      "upload+download",
+		unit:          unitDecimal,
+		interval:      60,
+		threshold:     0.7,
+		ratio:         1,
+		shutdownDelay: 120,
+		ladder: []LadderRung{
+			{At: 0.85, Action: rungLimit, Rate: "2mbit"},
+			{At: 0.95, Action: rungBlock, Allow: []string{"22", "53"}},
+		},
+	},
+}
+
+// Names of the profiles for error messages
+func profileNames() string {
+	var names []string
+	for name := range profilePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Fill in what the profile defines and the config leaves empty, explicit values win.
+// Runs after the plan, the provider's metering is more specific than the scenario.
+func applyProfile(config *Config) error {
+	if config.Profile == "" {
+		return nil
+	}
+	preset, ok := profilePresets[config.Profile]
+	if !ok {
+		return fmt.Errorf("unknown profile %q, must be one of: %s", config.Profile, profileNames())
+	}
+	if config.Comparison.Category == "" {
+		config.Comparison.Category = preset.category
+	}
+	if config.Unit == "" {
+		config.Unit = preset.unit
+	}
+	if config.Interval == 0 {
+		config.Interval = preset.interval
+	}
+	if config.Comparison.Threshold == 0 {
+		config.Comparison.Threshold = preset.threshold
+	}
+	if config.Comparison.Ratio == 0 {
+		config.Comparison.Ratio = preset.ratio
+	}
+	if config.ShutdownDelay == 0 {
+		config.ShutdownDelay = preset.shutdownDelay
+	}
+	if config.Ladder == nil {
+		config.Ladder = preset.ladder
+	}
+	if config.SafeMode == nil {
+		config.SafeMode = preset.safeMode
+	}
+	return nil
+}
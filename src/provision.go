@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+const defaultUnitPath = "/etc/systemd/system/netmonitor.service"
+
+// Flags of the common settings, each a shortcut for --set with the key
+var provisionShortcuts = []struct {
+	flag, key, usage string
+}{
+	{"device", "device", "Device name shown in the messages"},
+	{"interface", "interface", "Network interface to monitor"},
+	{"interval", "interval", "Seconds between samples"},
+	{"start-day", "start_day", "Day of the month the statistics are reset"},
+	{"timezone", "timezone", "Timezone of the billing period, e.g. Asia/Shanghai"},
+	{"plan", "plan", "Provider plan preset, e.g. hetzner-cloud"},
+	{"profile", "profile", "Usage profile preset, e.g. vps-quota"},
+	{"category", "comparison.category", "What counts against the limit: download, upload, upload+download or anymax"},
+	{"limit", "comparison.limit", "Traffic limit in GB"},
+	{"threshold", "comparison.threshold", "Share of the limit that sends the alert, e.g. 0.8"},
+	{"ratio", "comparison.ratio", "Share of the limit that shuts the system down, e.g. 0.95"},
+}
+
+type ProvisionResult struct {
+	OK            bool              `json:"ok"`
+	Error         string            `json:"error,omitempty"`
+	Config        string            `json:"config"`
+	ConfigChanged bool              `json:"config_changed"`
+	Unit          string            `json:"unit,omitempty"` // 未安装服务时为空
+	UnitChanged   bool              `json:"unit_changed"`
+	ServiceAction string            `json:"service_action,omitempty"` // started、restarted或unchanged
+	Notifications map[string]string `json:"notifications,omitempty"`  // 每个消息服务的测试结果，ok或错误信息
+}
+
+// netmonitor provision --device vps1 --interface eth0 --limit 1000 --service telegram --set message.telegram.token=123:abc
+func runProvisionCommand(args []string) int {
+	flags := flag.NewFlagSet("provision", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	var settings []string
+	flags.Func("set", "A setting as key=value, e.g. message.telegram.chat_id=-100123 (repeatable)", func(setting string) error {
+		settings = append(settings, setting)
+		return nil
+	})
+	shortcuts := make([]*string, len(provisionShortcuts))
+	for i, shortcut := range provisionShortcuts {
+		shortcuts[i] = flags.String(shortcut.flag, "", shortcut.usage)
+	}
+	services := flags.String("service", "", "Message services, comma separated, e.g. telegram,email")
+	install := flags.Bool("install", true, "Install the systemd service and (re)start it")
+	unitPath := flags.String("unit", defaultUnitPath, "Path of the systemd unit file")
+	test := flags.Bool("test", true, "Send a test message through every message service")
+	// The environment goes first, the command line overrides it
+	if err := applyEnvFlags(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitUsage
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	// The result on stdout is the only output
+	quiet = true
+
+	path, _ := filepath.Abs(*configFilePath)
+	result := ProvisionResult{Config: path}
+	finish := func(code int, err error) int {
+		result.OK = err == nil
+		if err != nil {
+			result.Error = err.Error()
+		}
+		output, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(output))
+		return code
+	}
+
+	// Collect the settings, the shortcuts go first so --set can refine them
+	for i, shortcut := range provisionShortcuts {
+		if *shortcuts[i] != "" {
+			settings = append([]string{shortcut.key + "=" + *shortcuts[i]}, settings...)
+		}
+	}
+	if *services != "" {
+		names := strings.Split(*services, ",")
+		others, _ := json.Marshal(names[1:])
+		settings = append([]string{"message.service=" + names[0], "message.services=" + string(others)}, settings...)
+	}
+	overrides := make(map[string]any)
+	for _, setting := range settings {
+		if err := setOverride(overrides, setting); err != nil {
+			return finish(exitUsage, err)
+		}
+	}
+
+	config, err := provisionConfig(path, overrides)
+	if err != nil {
+		return finish(exitConfig, err)
+	}
+	if config.Interface != "" {
+		if _, err := readNetworkStats(config.Interface); err != nil {
+			return finish(exitInterface, err)
+		}
+	}
+
+	// The running monitor rewrites the config on every save, it is stopped before the
+	// new config is written and read the file again
+	active := *install && commandExists("systemctl") && serviceActive(unitName(*unitPath))
+	existing, _ := os.ReadFile(path)
+	if active && configDiffers(path, existing, config) {
+		if output, err := exec.Command("systemctl", "stop", unitName(*unitPath)).CombinedOutput(); err != nil {
+			return finish(exitFailure, fmt.Errorf("failed to stop the service: %v %s", err, bytes.TrimSpace(output)))
+		}
+		if config, err = provisionConfig(path, overrides); err != nil {
+			return finish(exitConfig, err)
+		}
+		existing, _ = os.ReadFile(path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return finish(exitFailure, err)
+	}
+	if err := saveConfig(path, config); err != nil {
+		return finish(exitFailure, fmt.Errorf("failed to write config: %v", err))
+	}
+	written, _ := os.ReadFile(path)
+	result.ConfigChanged = !bytes.Equal(existing, written)
+
+	if *install {
+		result.Unit = *unitPath
+		if err := installService(path, &result); err != nil {
+			return finish(exitFailure, err)
+		}
+	}
+
+	if *test {
+		if err := testNotifications(config, &result); err != nil {
+			return finish(exitFailure, err)
+		}
+	}
+	return finish(exitOK, nil)
+}
+
+// Set every flag to NETMONITOR_<FLAG> where that is set, the lines of NETMONITOR_SET
+// are one setting each
+func applyEnvFlags(flags *flag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		name := "NETMONITOR_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+		values := []string{value}
+		if f.Name == "set" {
+			values = strings.FieldsFunc(value, func(r rune) bool { return r == '\n' })
+		}
+		for _, value := range values {
+			if setErr := flags.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid %s: %v", name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// Put a key=value setting into the overrides. The key is checked against the config,
+// and the value is taken as it is for text settings and parsed as JSON for the others.
+func setOverride(overrides map[string]any, setting string) error {
+	key, value, ok := strings.Cut(setting, "=")
+	if !ok {
+		return fmt.Errorf("setting %q is not key=value", setting)
+	}
+	parts := strings.Split(key, ".")
+	node := overrides
+	t := reflect.TypeOf(Config{})
+	for i, part := range parts {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("unknown config key: %s, %s can only be set as a whole", key, strings.Join(parts[:i], "."))
+		}
+		known := jsonFields(t)
+		fieldType, ok := known[part]
+		if !ok {
+			if suggestion := closestKey(part, known); suggestion != "" {
+				return fmt.Errorf("unknown config key: %s (did you mean %s?)", key, suggestion)
+			}
+			return fmt.Errorf("unknown config key: %s", key)
+		}
+		t = fieldType
+		if i == len(parts)-1 {
+			break
+		}
+		child, _ := node[part].(map[string]any)
+		if child == nil {
+			child = make(map[string]any)
+			node[part] = child
+		}
+		node = child
+	}
+
+	last := parts[len(parts)-1]
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String {
+		node[last] = value
+		return nil
+	}
+	var parsed any
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+	node[last] = parsed
+	return nil
+}
+
+// Load the config at path, or start from an empty one, and apply the overrides. The
+// config is checked like at startup, but saved without the plan and profile filled in.
+func provisionConfig(path string, overrides map[string]any) (Config, error) {
+	config, err := loadConfig(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to load config: %v", err)
+	}
+	data, _ := json.Marshal(overrides)
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid setting: %v", err)
+	}
+	check := config
+	if err := validateConfig(&check); err != nil {
+		return config, fmt.Errorf("invalid config: %v", err)
+	}
+	return config, nil
+}
+
+// Whether saving the config would change the file
+func configDiffers(path string, existing []byte, config Config) bool {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil || len(existing) == 0 {
+		return true
+	}
+	if merged, err := preserveConfigLayout(existing, append(data, '\n')); err == nil {
+		data = merged
+	}
+	return !bytes.Equal(existing, withoutIncludes(path, data, existing))
+}
+
+// Write the systemd unit, enable the service and start it, or restart it when the
+// config or the unit changed
+func installService(configFilePath string, result *ProvisionResult) error {
+	if !commandExists("systemctl") {
+		return fmt.Errorf("systemctl not found, the service can only be installed with systemd")
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the netmonitor binary: %v", err)
+	}
+	dir := filepath.Dir(configFilePath)
+	unit := fmt.Sprintf(`[Unit]
+Description=Network Bandwidth Monitor
+After=network.target
+
+[Service]
+WorkingDirectory=%s
+ExecStart=%s -c %s
+StandardOutput=file:%s
+StandardError=file:%s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, dir, binary, configFilePath, filepath.Join(dir, "output.log"), filepath.Join(dir, "error.log"))
+
+	existing, _ := os.ReadFile(result.Unit)
+	result.UnitChanged = string(existing) != unit
+	if result.UnitChanged {
+		if err := os.WriteFile(result.Unit, []byte(unit), 0644); err != nil {
+			return fmt.Errorf("failed to write unit: %v", err)
+		}
+	}
+
+	name := unitName(result.Unit)
+	active := serviceActive(name)
+	steps := [][]string{{"enable", name}}
+	if result.UnitChanged {
+		steps = append([][]string{{"daemon-reload"}}, steps...)
+	}
+	switch {
+	case !active:
+		steps, result.ServiceAction = append(steps, []string{"start", name}), "started"
+	case result.ConfigChanged || result.UnitChanged:
+		steps, result.ServiceAction = append(steps, []string{"restart", name}), "restarted"
+	default:
+		result.ServiceAction = "unchanged"
+	}
+	for _, step := range steps {
+		if output, err := exec.Command("systemctl", step...).CombinedOutput(); err != nil {
+			return fmt.Errorf("systemctl %s failed: %v %s", strings.Join(step, " "), err, bytes.TrimSpace(output))
+		}
+	}
+	return nil
+}
+
+// The service name systemd gives a unit file
+func unitName(unitPath string) string {
+	return strings.TrimSuffix(filepath.Base(unitPath), ".service")
+}
+
+func serviceActive(name string) bool {
+	return exec.Command("systemctl", "is-active", "--quiet", name).Run() == nil
+}
+
+// Send a test message through each message service and record how it went, it fails
+// when one of them didn't get it
+func testNotifications(config Config, result *ProvisionResult) error {
+	if err := validateConfig(&config); err != nil {
+		return err
+	}
+	setupNotifyNetwork(config.Message)
+	result.Notifications = make(map[string]string)
+	var failed []string
+	for _, test := range sendTestMessages(&config) {
+		if test.err != nil {
+			result.Notifications[test.service] = test.err.Error()
+			failed = append(failed, test.service)
+			continue
+		}
+		result.Notifications[test.service] = "ok"
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("test message not delivered to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
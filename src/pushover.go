@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Pushover's emergency priority repeats the notification until it is acknowledged
+const pushoverEmergency = 2
+
+type PushoverMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	Token           string `json:"token"`              // 应用的API令牌
+	User            string `json:"user"`               // 用户或群组的key
+	Priority        int    `json:"priority,omitempty"` // 流量提醒等消息的优先级，-2到1，默认0
+	Retry           int    `json:"retry,omitempty"`    // 关机警告未确认时重复提醒的间隔秒数，至少30，默认60
+	Expire          int    `json:"expire,omitempty"`   // 关机警告重复提醒的最长秒数，最多10800，默认3600
+}
+
+// Check the Pushover settings when it is the selected service
+func validatePushover(pushover PushoverMessage) error {
+	if pushover.Token == "" || pushover.User == "" {
+		return fmt.Errorf("pushover needs token and user")
+	}
+	if pushover.Priority < -2 || pushover.Priority > 1 {
+		return fmt.Errorf("invalid pushover priority %d, must be -2 to 1", pushover.Priority)
+	}
+	if pushover.Retry != 0 && pushover.Retry < 30 {
+		return fmt.Errorf("invalid pushover retry %d, must be at least 30 seconds", pushover.Retry)
+	}
+	if pushover.Expire < 0 || pushover.Expire > 10800 {
+		return fmt.Errorf("invalid pushover expire %d, must be at most 10800 seconds", pushover.Expire)
+	}
+	return nil
+}
+
+// Send a message through Pushover. Shutdown warnings go out as emergencies that keep
+// alerting until acknowledged or expired.
+func sendPushoverMessage(config *Config, message string) error {
+	pushover := config.Message.Pushover
+	form := url.Values{
+		"token":    {pushover.Token},
+		"user":     {pushover.User},
+		"title":    {config.Device},
+		"message":  {message},
+		"priority": {strconv.Itoa(pushover.Priority)},
+	}
+	if config.urgent {
+		retry, expire := pushover.Retry, pushover.Expire
+		if retry == 0 {
+			retry = 60
+		}
+		if expire == 0 {
+			expire = 3600
+		}
+		form.Set("priority", strconv.Itoa(pushoverEmergency))
+		form.Set("retry", strconv.Itoa(retry))
+		form.Set("expire", strconv.Itoa(expire))
+	}
+
+	resp, err := notifyClient("pushover").PostForm("https://api.pushover.net/1/messages.json", form)
+	if err != nil {
+		return fmt.Errorf("failed to send message to Pushover: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// Failures come with a 4xx status and the reasons in the body
+	var result struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode >= 400 || result.Status != 1 {
+		return fmt.Errorf("got error from Pushover: %s %v", resp.Status, result.Errors)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The end of the quiet window each kind of message was last held for, so the hold is
+// logged once per window rather than on every sample
+var quietNoted = map[string]time.Time{}
+
+// Parse "23:00-08:00" into the minutes of the day the window starts and ends at,
+// a window ending before it starts runs over midnight
+func parseQuietHours(text string) (start, end int, err error) {
+	from, to, ok := strings.Cut(text, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quiet_hours %q, expected e.g. 23:00-08:00", text)
+	}
+	minutes := func(clock string) (int, error) {
+		t, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return 0, fmt.Errorf("invalid quiet_hours %q, expected e.g. 23:00-08:00", text)
+		}
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if start, err = minutes(from); err != nil {
+		return 0, 0, err
+	}
+	if end, err = minutes(to); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("invalid quiet_hours %q, the window is empty", text)
+	}
+	return start, end, nil
+}
+
+// The end of the quiet window the time falls in, ok is false outside of it
+func quietUntil(config *Config, now time.Time) (until time.Time, ok bool) {
+	if config.Message.QuietHours == "" {
+		return time.Time{}, false
+	}
+	start, end, err := parseQuietHours(config.Message.QuietHours)
+	if err != nil {
+		return time.Time{}, false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch {
+	case start < end && minute >= start && minute < end:
+		return midnight.Add(time.Duration(end) * time.Minute), true
+	case start > end && minute >= start:
+		return midnight.AddDate(0, 0, 1).Add(time.Duration(end) * time.Minute), true
+	case start > end && minute < end:
+		return midnight.Add(time.Duration(end) * time.Minute), true
+	}
+	return time.Time{}, false
+}
+
+// Whether a message of the kind waits for the end of the quiet hours
+func heldByQuietHours(config *Config, kind string, now time.Time) bool {
+	until, ok := quietUntil(config, now)
+	if !ok {
+		return false
+	}
+	if !quietNoted[kind].Equal(until) {
+		quietNoted[kind] = until
+		logf("Quiet hours, %s message held until %s\n", kind, until.Format("15:04"))
+	}
+	return true
+}
+
+// Queue a message for the end of the quiet hours instead of sending it now
+func queueAfterQuietHours(config *Config, services []string, message string, now time.Time) bool {
+	until, ok := quietUntil(config, now)
+	if !ok {
+		return false
+	}
+	for _, service := range services {
+		queueMessageAt(config, service, message, now, until)
+	}
+	logf("Quiet hours, message queued for %s\n", until.Format("15:04"))
+	return true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	defaultBurst = 30        // messages per hour when burst isn't set
+	burstWindow  = time.Hour // the window burst counts the messages in
+)
+
+// When messages went out, kept next to the config file so alerts don't fire again
+// after the config was reset or replaced by hand
+type SendLog struct {
+	Alerts map[string]string `json:"alerts,omitempty"` // 每类提醒上次发送的时间，RFC3339格式
+	Recent []string          `json:"recent,omitempty"` // 最近一小时内发送的消息的时间
+}
+
+var sendLog struct {
+	SendLog
+	path    string
+	limited bool // the burst limit held messages back, logged once until it lets them pass
+}
+
+func sendLogPath(configFilePath string) string {
+	return configFilePath + ".sent"
+}
+
+// Read the send log of the config, a missing or broken one starts empty
+func loadSendLog(configFilePath string) {
+	sendLog.path = sendLogPath(configFilePath)
+	sendLog.SendLog = SendLog{}
+	data, err := os.ReadFile(sendLog.path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &sendLog.SendLog); err != nil {
+		logf("Ignoring broken send log %s: %v\n", sendLog.path, err)
+	}
+}
+
+func saveSendLog() {
+	if sendLog.path == "" {
+		return
+	}
+	data, _ := json.Marshal(sendLog.SendLog)
+	if err := os.WriteFile(sendLog.path, data, 0600); err != nil {
+		logf("Failed to save send log: %v\n", err)
+	}
+}
+
+// Whether an alert of the kind went out within the cooldown hours
+func alertCoolingDown(config *Config, kind string, now time.Time) bool {
+	if config.Message.Cooldown <= 0 {
+		return false
+	}
+	last, err := time.Parse(time.RFC3339, sendLog.Alerts[kind])
+	return err == nil && now.Sub(last) < time.Duration(config.Message.Cooldown)*time.Hour
+}
+
+func recordAlert(kind string, now time.Time) {
+	if sendLog.Alerts == nil {
+		sendLog.Alerts = make(map[string]string)
+	}
+	sendLog.Alerts[kind] = now.Format(time.RFC3339)
+	saveSendLog()
+}
+
+// Count a message against the burst limit. Urgent messages always pass and still
+// count, the others are refused once burst messages went out within the last hour.
+func takeBurst(config *Config, now time.Time) error {
+	limit := config.Message.Burst
+	if limit == 0 {
+		limit = defaultBurst
+	}
+	var recent []string
+	for _, sent := range sendLog.Recent {
+		if t, err := time.Parse(time.RFC3339, sent); err == nil && now.Sub(t) < burstWindow {
+			recent = append(recent, sent)
+		}
+	}
+	sendLog.Recent = recent
+	if limit > 0 && len(recent) >= limit && !config.urgent {
+		if !sendLog.limited {
+			sendLog.limited = true
+			logf("Sent %d messages within the last hour, holding the others back\n", len(recent))
+		}
+		return fmt.Errorf("burst limit of %d messages per hour reached", limit)
+	}
+	sendLog.limited = false
+	sendLog.Recent = append(sendLog.Recent, now.Format(time.RFC3339))
+	saveSendLog()
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Account the traffic the kernel counted while the monitor wasn't running, before the
+// first regular sample. Without a reboot the counters kept going and the whole delta
+// since the last sample is real traffic. After a reboot the counters started again
+// from zero: everything since the boot is counted, the traffic between the last sample
+// and the reboot is lost. When a reset falls into the downtime, the delta is split by
+// time and the share before the reset goes to the ending period.
+func reconcileCounters(config *Config, ifaces []string, interval time.Duration, now time.Time) {
+	lastSample, err := time.Parse(time.RFC3339, config.Statistics.LastSample)
+	if err != nil || config.Statistics.Counters == nil || !now.After(lastSample) {
+		return
+	}
+	current, err := readCurrentStats(ifaces)
+	if err != nil {
+		// The first regular sample reports the error
+		return
+	}
+
+	start, rebooted := lastSample, false
+	if uptime, err := readUptime(); err == nil {
+		if boot := now.Add(-uptime); boot.After(lastSample) {
+			start, rebooted = boot, true
+		}
+	}
+	if rebooted {
+		// Old values below the new counters would hide the traffic since the boot
+		for key := range current {
+			config.Statistics.Counters[key] = NetStats{}
+		}
+	}
+
+	delta := make(map[string]NetStats)
+	var total uint64
+	for key, stats := range current {
+		last := config.Statistics.Counters[key]
+		var d NetStats
+		if stats.ReceiveBytes >= last.ReceiveBytes {
+			d.ReceiveBytes = stats.ReceiveBytes - last.ReceiveBytes
+		} else {
+			d.ReceiveBytes = stats.ReceiveBytes
+		}
+		if stats.TransmitBytes >= last.TransmitBytes {
+			d.TransmitBytes = stats.TransmitBytes - last.TransmitBytes
+		} else {
+			d.TransmitBytes = stats.TransmitBytes
+		}
+		delta[key] = d
+		total += d.ReceiveBytes + d.TransmitBytes
+	}
+
+	// Only the share before a reset in between is accounted here, the first sample
+	// after the reset adds the rest to the new period
+	share := 1.0
+	reset := time.Time{}
+	if checkReset(config) {
+		if next := nextResetDate(config, lastSample); !next.IsZero() && next.Before(now) {
+			reset = next
+			share = max(0, min(1, float64(reset.Sub(start))/float64(now.Sub(start))))
+		}
+	}
+	if share > 0 {
+		if share < 1 {
+			for key, stats := range current {
+				last := config.Statistics.Counters[key]
+				if stats.ReceiveBytes < last.ReceiveBytes || stats.TransmitBytes < last.TransmitBytes {
+					last = NetStats{}
+				}
+				current[key] = NetStats{
+					ReceiveBytes:  last.ReceiveBytes + uint64(float64(delta[key].ReceiveBytes)*share),
+					TransmitBytes: last.TransmitBytes + uint64(float64(delta[key].TransmitBytes)*share),
+				}
+			}
+		}
+		accountCounters(config, current)
+	}
+
+	downtime := now.Sub(lastSample)
+	if !rebooted && downtime < 2*interval {
+		// A quick restart, nothing worth noting
+		return
+	}
+	detail := fmt.Sprintf(tr("监控停止约%s，期间网卡计数器增加的%.2f GB已计入统计"), downtime.Round(time.Second), float64(total)/bytesToGB)
+	if rebooted {
+		detail = fmt.Sprintf(tr("监控停止约%s，期间系统于%s重启，重启后的%.2f GB已计入统计，重启前未采样的流量无法统计"),
+			downtime.Round(time.Second), start.Local().Format("01-02 15:04"), float64(total)/bytesToGB)
+	}
+	if !reset.IsZero() {
+		detail += fmt.Sprintf(tr("，其中%s之前的%.0f%%按时间比例计入上个周期"), reset.Format("2006-01-02"), share*100)
+	}
+	addEvent(config, eventDowntime, lastSample, now, detail)
+	recordDowntime(config, lastSample, now, rebooted)
+	logf("Monitor was stopped for %s, reconciled %.2f GB from the counters (reboot: %v)\n",
+		downtime.Round(time.Second), float64(total)/bytesToGB, rebooted)
+}
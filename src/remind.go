@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Send the threshold alert again with the current usage every remind hours while the
+// usage stays above the threshold, until the ratio's shutdown takes over
+func remindThreshold(config *Config, configFilePath string, valueInGB float64, now time.Time) {
+	if config.Comparison.Remind <= 0 {
+		return
+	}
+	last, err := time.Parse(time.RFC3339, config.Statistics.Reminded)
+	if err != nil {
+		// Alerted before reminders were kept, the first one follows a full interval later
+		config.Statistics.Reminded = now.Format(time.RFC3339)
+		return
+	}
+	if now.Sub(last) < time.Duration(config.Comparison.Remind)*time.Hour || heldByQuietHours(config, "reminder", now) {
+		return
+	}
+
+	message := thresholdMessage(config, valueInGB)
+	if reached := config.Statistics.ThresholdReached; reached != "" {
+		message += fmt.Sprintf(tr("\n（重复提醒，%s起超过阈值）"), formatEventTime(Event{Time: reached}))
+	}
+	err = sendRoutedMessage(config, routeThreshold, message+alertLink(config, now))
+	reportHealth(config, healthSend, err)
+	if err != nil {
+		logf("Failed to send threshold reminder: %v\n", err)
+		return
+	}
+	logf("Threshold reminder sent, usage %.2f GB\n", valueInGB)
+	config.Statistics.Reminded = now.Format(time.RFC3339)
+	err = saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save config after threshold reminder: %v\n", err)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	remoteIncludeTimeout = 30 * time.Second // an offline host falls back to the cache after this
+	remoteIncludeMaxSize = 1 << 20
+)
+
+// The last copy of a remote include file, kept so the monitor starts with it when the
+// server can't be reached
+type RemoteInclude struct {
+	ETag      string `json:"etag,omitempty"`
+	Signature string `json:"signature,omitempty"` // 下载时的签名，读取缓存时重新校验
+	Fetched   string `json:"fetched"`             // 下载时间，RFC3339格式
+	Data      []byte `json:"data"`
+}
+
+func remoteIncludeCachePath(configFilePath string) string {
+	return configFilePath + ".remote"
+}
+
+func isRemoteInclude(include string) bool {
+	return strings.HasPrefix(include, "https://") || strings.HasPrefix(include, "http://")
+}
+
+// Decode the base64 Ed25519 public key that remote includes are signed with
+func parseIncludeKey(key string) (ed25519.PublicKey, error) {
+	if key == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid include_key, must be a base64 Ed25519 public key")
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+func verifyInclude(key ed25519.PublicKey, data []byte, signature string) error {
+	if key == nil {
+		return nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil || !ed25519.Verify(key, data, sig) {
+		return fmt.Errorf("bad signature")
+	}
+	return nil
+}
+
+func readRemoteCache(configFilePath string) map[string]RemoteInclude {
+	cache := make(map[string]RemoteInclude)
+	if data, err := os.ReadFile(remoteIncludeCachePath(configFilePath)); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+func writeRemoteCache(configFilePath string, cache map[string]RemoteInclude) {
+	data, _ := json.MarshalIndent(cache, "", "  ")
+	if err := os.WriteFile(remoteIncludeCachePath(configFilePath), data, 0600); err != nil {
+		logf("Failed to save remote include cache: %v\n", err)
+	}
+}
+
+// GET a remote file, the body is empty when the server answers 304 to the ETag
+func fetchRemote(url, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	client := &http.Client{Timeout: remoteIncludeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("got error status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, remoteIncludeMaxSize))
+	return data, resp.Header.Get("ETag"), err
+}
+
+// Download a remote include, checking its signature at <url>.sig when a key is set.
+// Unchanged files are answered from the cache by their ETag; when the server can't be
+// reached or the download doesn't verify, the cached copy is used if it still does.
+func readRemoteInclude(configFilePath, url string, key ed25519.PublicKey) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("remote include %s must use https", url)
+	}
+	cache := readRemoteCache(configFilePath)
+	cached, hasCache := cache[url]
+	if hasCache && verifyInclude(key, cached.Data, cached.Signature) != nil {
+		logf("Ignoring cached copy of %s, its signature doesn't match include_key\n", url)
+		hasCache = false
+	}
+	etag := ""
+	if hasCache {
+		etag = cached.ETag
+	}
+
+	data, newETag, err := fetchRemote(url, etag)
+	if err == nil && data == nil {
+		return cached.Data, nil
+	}
+	signature := ""
+	if err == nil && key != nil {
+		var sig []byte
+		if sig, _, err = fetchRemote(url+".sig", ""); err == nil {
+			signature = string(sig)
+			err = verifyInclude(key, data, signature)
+		}
+	}
+	if err != nil {
+		if !hasCache {
+			return nil, err
+		}
+		logf("Failed to fetch remote include %s, using the copy from %s: %v\n", url, cached.Fetched, err)
+		return cached.Data, nil
+	}
+	cache[url] = RemoteInclude{
+		ETag:      newETag,
+		Signature: signature,
+		Fetched:   time.Now().Format(time.RFC3339),
+		Data:      data,
+	}
+	writeRemoteCache(configFilePath, cache)
+	return data, nil
+}
+
+// netmonitor config keygen --key signing.key
+func runConfigKeygen(args []string) int {
+	flags := flag.NewFlagSet("config keygen", flag.ContinueOnError)
+	keyPath := flags.String("key", "signing.key", "File to write the private key to")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to generate key: %v\n", err)
+		return exitFailure
+	}
+	seed := base64.StdEncoding.EncodeToString(private.Seed()) + "\n"
+	if err := os.WriteFile(*keyPath, []byte(seed), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write key: %v\n", err)
+		return exitFailure
+	}
+	fmt.Printf("Private key written to %s, keep it off the monitored hosts\n", *keyPath)
+	fmt.Printf("include_key: %s\n", base64.StdEncoding.EncodeToString(public))
+	return exitOK
+}
+
+// netmonitor config sign --key signing.key rules.json, writes rules.json.sig
+func runConfigSign(args []string) int {
+	flags := flag.NewFlagSet("config sign", flag.ContinueOnError)
+	keyPath := flags.String("key", "signing.key", "Private key written by `netmonitor config keygen`")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: netmonitor config sign [--key signing.key] <file>...")
+		return exitUsage
+	}
+	encoded, err := os.ReadFile(*keyPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read key: %v\n", err)
+		return exitFailure
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		fmt.Fprintf(os.Stderr, "invalid key in %s\n", *keyPath)
+		return exitUsage
+	}
+	private := ed25519.NewKeyFromSeed(seed)
+	for _, path := range flags.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read %s: %v\n", path, err)
+			return exitFailure
+		}
+		if _, err := parseJSONNode(data); err != nil {
+			fmt.Fprintf(os.Stderr, "%s is not valid JSON: %v\n", path, err)
+			return exitConfig
+		}
+		signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, data)) + "\n"
+		if err := os.WriteFile(path+".sig", []byte(signature), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write signature: %v\n", err)
+			return exitFailure
+		}
+		fmt.Printf("Signed %s\n", path)
+	}
+	return exitOK
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// Run the tests in a zone, resetDateOf and checkResetAt work in local time
+func inZone(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	saved := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = saved })
+	return loc
+}
+
+func TestResetDateOf(t *testing.T) {
+	cases := []struct {
+		zone     string
+		month    string // 2006-01
+		startDay int
+		want     string
+	}{
+		// Clamped to the last day, across leap and common years
+		{"UTC", "2024-02", 31, "2024-02-29T00:00:00Z"},
+		{"UTC", "2024-02", 29, "2024-02-29T00:00:00Z"},
+		{"UTC", "2023-02", 29, "2023-02-28T00:00:00Z"},
+		{"UTC", "2100-02", 29, "2100-02-28T00:00:00Z"},
+		{"UTC", "2000-02", 30, "2000-02-29T00:00:00Z"},
+		{"UTC", "2024-04", 31, "2024-04-30T00:00:00Z"},
+		// DST starting at 02:00 leaves midnight alone
+		{"Europe/Berlin", "2024-03", 31, "2024-03-31T00:00:00+01:00"},
+		{"Europe/Berlin", "2024-10", 27, "2024-10-27T00:00:00+02:00"},
+		// DST skipping midnight, the day starts when the clocks jump
+		{"America/Santiago", "2024-09", 8, "2024-09-08T01:00:00-03:00"},
+		{"America/Sao_Paulo", "2018-11", 4, "2018-11-04T01:00:00-02:00"},
+		{"Asia/Beirut", "2024-03", 31, "2024-03-31T01:00:00+03:00"},
+	}
+	for _, c := range cases {
+		t.Run(c.zone+" "+c.month, func(t *testing.T) {
+			loc := inZone(t, c.zone)
+			month, err := time.ParseInLocation("2006-01", c.month, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resetDateOf(month, c.startDay).Format(time.RFC3339); got != c.want {
+				t.Errorf("resetDateOf(%s, %d) = %s, want %s", c.month, c.startDay, got, c.want)
+			}
+		})
+	}
+}
+
+// The reset date is the first instant of start_day, or of the last day of shorter months
+func TestResetDateOfProperties(t *testing.T) {
+	for _, zone := range []string{"UTC", "America/Santiago", "Asia/Beirut", "Australia/Lord_Howe"} {
+		loc := inZone(t, zone)
+		property := func(day uint8, hours uint32) bool {
+			startDay := int(day)%31 + 1
+			now := time.Date(2000, 1, 1, 0, 0, 0, 0, loc).Add(time.Duration(hours%(100*365*24)) * time.Hour)
+			reset := resetDateOf(now, startDay)
+			lastDay := time.Date(now.Year(), now.Month()+1, 0, 12, 0, 0, 0, loc).Day()
+			return reset.Year() == now.Year() && reset.Month() == now.Month() &&
+				reset.Day() == min(startDay, lastDay) &&
+				reset.Add(-time.Nanosecond).Day() != reset.Day()
+		}
+		if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+			t.Errorf("%s: %v", zone, err)
+		}
+	}
+}
+
+// Run checkResetAt at every sample time over the months, the way the monitor loop
+// does: each billing period is reset exactly once, and the resets only move forward
+func TestCheckResetOncePerPeriod(t *testing.T) {
+	quiet = true
+	step, months := 10*time.Minute, 24
+	if testing.Short() {
+		step, months = time.Hour, 6
+	}
+	for _, zone := range []string{"UTC", "Europe/Berlin", "America/Santiago", "Australia/Sydney"} {
+		for _, startDay := range []int{1, 15, 28, 29, 30, 31} {
+			loc := inZone(t, zone)
+			// From January of a leap year, so Feb 29 is crossed
+			from := time.Date(2024, time.January, 10, 0, 0, 0, 0, loc)
+			end := from.AddDate(0, months, 0)
+			config := Config{StartDay: startDay}
+			config.Statistics.LastReset = resetDateOf(from, startDay).AddDate(0, -1, 0).Format(time.RFC3339)
+
+			var resets []time.Time
+			for now := from; now.Before(end); now = now.Add(step) {
+				if checkResetAt(&config, now) {
+					if len(resets) > 0 && !now.After(resets[len(resets)-1]) {
+						t.Errorf("%s start_day %d: reset at %s not after %s", zone, startDay, now, resets[len(resets)-1])
+					}
+					resets = append(resets, now)
+					config.Statistics.LastReset = now.Format(time.RFC3339)
+				}
+			}
+
+			for month := time.Date(2024, time.February, 1, 0, 0, 0, 0, loc); month.Before(end); month = month.AddDate(0, 1, 0) {
+				start, next := resetDateOf(month, startDay), resetDateOf(month.AddDate(0, 1, 0), startDay)
+				if !next.Before(end) {
+					break
+				}
+				count := 0
+				for _, reset := range resets {
+					if !reset.Before(start) && reset.Before(next) {
+						count++
+					}
+				}
+				if count != 1 {
+					t.Errorf("%s start_day %d: period from %s reset %d times", zone, startDay, start.Format(time.RFC3339), count)
+				}
+			}
+		}
+	}
+}
+
+// A prepaid config may leave start_day at 0, nothing computes a reset date for it
+func TestPrepaidHasNoResets(t *testing.T) {
+	quiet = true
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, inZone(t, "Europe/Berlin"))
+	config := &Config{Prepaid: true}
+	config.Statistics.LastReset = now.AddDate(0, -2, 0).Format(time.RFC3339)
+
+	if reset := nextResetDate(config, now); !reset.IsZero() {
+		t.Errorf("nextResetDate = %s, want zero", reset)
+	}
+	if end := periodEnd(config, now); !end.Equal(now) {
+		t.Errorf("periodEnd = %s, want now", end)
+	}
+	if checkResetAt(config, now) {
+		t.Error("prepaid balance reset")
+	}
+	if !resetDateOf(now, 0).IsZero() {
+		t.Error("resetDateOf start_day 0 isn't zero")
+	}
+	if lines := upcomingResets(now, 0, 12); lines != nil {
+		t.Errorf("upcomingResets start_day 0 = %v", lines)
+	}
+
+	// Without prepaid, a missing start_day has no next reset either
+	config.Prepaid = false
+	if reset := nextResetDate(config, now); !reset.IsZero() {
+		t.Errorf("nextResetDate start_day 0 = %s, want zero", reset)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Kinds of messages that routes can send to their own services, other messages go
+// to service and services
+const (
+	routeThreshold = "threshold" // 阈值提醒
+	routeRatio     = "ratio"     // 关机警告和关机倒计时
+	routeSummary   = "summary"   // 周期摘要及附件
+	routeError     = "error"     // 监控健康事件
+)
+
+var routeKinds = []string{routeThreshold, routeRatio, routeSummary, routeError}
+
+// The services a kind of message goes to, its route or else the enabled services. An
+// empty route sends nothing.
+func (m Message) route(kind string) []string {
+	if services, ok := m.Routes[kind]; ok {
+		return services
+	}
+	return m.services()
+}
+
+// Every service some message goes to, these are the ones that need their settings
+func (m Message) allServices() []string {
+	services := m.services()
+	kinds := make([]string, 0, len(m.Routes))
+	for kind := range m.Routes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		for _, service := range m.Routes[kind] {
+			if !slices.Contains(services, service) {
+				services = append(services, service)
+			}
+		}
+	}
+	return services
+}
+
+func validateRoutes(routes map[string][]string) error {
+	for kind := range routes {
+		if !slices.Contains(routeKinds, kind) {
+			return fmt.Errorf("invalid message route %q, must be threshold, ratio, summary or error", kind)
+		}
+		// A misspelled service would only fail when the alert is due
+		for _, service := range routes[kind] {
+			if serviceCapabilities[service] == 0 {
+				return fmt.Errorf("invalid service %q in message route %s", service, kind)
+			}
+		}
+	}
+	return nil
+}
+
+// Send a message to the services of its kind, like sendMessage it counts as sent once
+// one of them got it
+func sendRoutedMessage(config *Config, kind, message string) error {
+	// A copy would lose what the services keep in the config, such as the email digest
+	config.routine = kind == routeSummary
+	defer func() { config.routine = false }()
+	_, err := sendMessageTo(config, config.Message.route(kind), message)
+	return err
+}
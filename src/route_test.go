@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestValidateRoutes(t *testing.T) {
+	cases := []struct {
+		routes map[string][]string
+		ok     bool
+	}{
+		{map[string][]string{routeThreshold: {"telegram", "ntfy"}, routeSummary: {}}, true},
+		{map[string][]string{"thresholds": {"telegram"}}, false},
+		{map[string][]string{routeThreshold: {"telegarm"}}, false},
+		{map[string][]string{routeError: {""}}, false},
+	}
+	for _, c := range cases {
+		if err := validateRoutes(c.routes); (err == nil) != c.ok {
+			t.Errorf("validateRoutes(%v) = %v", c.routes, err)
+		}
+	}
+}
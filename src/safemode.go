@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Remember that the monitor is about to power the machine off, so a boot later in the
+// same period can tell it came back from an enforced shutdown
+func markShutdown(config *Config) {
+	config.Statistics.ShutdownAt = time.Now().Format(time.RFC3339)
+}
+
+// Check at startup whether the machine was shut down by the monitor earlier in this
+// period. The ratio was already crossed, so no alert would fire again; safe_mode is
+// applied right away and a warning sent instead of letting the quota run further. The
+// limit is applied on every boot, the warning only once per enforced shutdown.
+func checkSafeMode(config *Config, configFilePath string, ifaces []string) {
+	shutdownAt := config.Statistics.ShutdownAt
+	if shutdownAt == "" || checkReset(config) {
+		// A new period is due, the reset lifts everything anyway
+		return
+	}
+
+	message := fmt.Sprintf(tr("安全模式：本机于%s因流量超限被关机，本周期内再次开机"), formatEventTime(Event{Time: shutdownAt}))
+	if rung := config.SafeMode; rung != nil {
+		host := hostInterfaces(ifaces)
+		if err := applyRung(*rung, host); err != nil {
+			logf("Failed to apply safe mode: %v\n", err)
+			message += tr("，限制执行失败，请尽快检查")
+		} else {
+			message += tr("，已") + describeRung(*rung)
+		}
+		state := config.Statistics.Ladder
+		if state == nil {
+			state = &LadderState{}
+		}
+		state.Interfaces, state.SafeMode = host, true
+		config.Statistics.Ladder = state
+	} else {
+		message += tr("，没有配置safe_mode，流量不受限制")
+	}
+	logf("Booted after an enforced shutdown at %s\n", shutdownAt)
+
+	// Another restart after the shutdown, the warning already went out
+	if config.Statistics.SafeModeNotified != shutdownAt {
+		config.Statistics.SafeModeNotified = shutdownAt
+		addEvent(config, eventEnforcement, time.Now(), time.Time{}, message)
+		err := sendMessage(config, message+alertLink(config, time.Now()))
+		reportHealth(config, healthSend, err)
+		if err != nil {
+			logf("Failed to send safe mode message: %v\n", err)
+		}
+	}
+	err := saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save config after safe mode: %v\n", err)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Restarts after an enforced shutdown warn once, a later shutdown warns again
+func TestSafeModeNoticeOncePerShutdown(t *testing.T) {
+	quiet = true
+	dir := t.TempDir()
+	messages := filepath.Join(dir, "messages")
+	config := &Config{Device: "router", StartDay: 1}
+	config.Message.Service = "mock"
+	config.Message.Mock.File = messages
+	config.Statistics.LastReset = time.Now().Format(time.RFC3339)
+	markShutdown(config)
+
+	sent := func() int {
+		data, _ := os.ReadFile(messages)
+		return strings.Count(string(data), "\n")
+	}
+	for boot := 0; boot < 3; boot++ {
+		checkSafeMode(config, filepath.Join(dir, "config.json"), nil)
+	}
+	if n := sent(); n != 1 {
+		t.Errorf("%d safe mode messages after three boots, want 1", n)
+	}
+
+	config.Statistics.ShutdownAt = time.Now().Add(time.Minute).Format(time.RFC3339)
+	checkSafeMode(config, filepath.Join(dir, "config.json"), nil)
+	if n := sent(); n != 2 {
+		t.Errorf("%d safe mode messages after the second shutdown, want 2", n)
+	}
+}
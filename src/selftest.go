@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The outcome of the last scheduled self-test, kept across resets
+type SelfTestResult struct {
+	Time   string            `json:"time"`             // 自检的时间，RFC3339格式
+	Failed map[string]string `json:"failed,omitempty"` // 没有收到测试提醒的服务及错误
+}
+
+// When the monitor started, a schedule that fired before it isn't caught up on the
+// first run
+var selfTestSince = time.Now()
+
+// Check the self-test schedule
+func validateSelfTest(schedule string) error {
+	if schedule == "" {
+		return nil
+	}
+	_, err := parseCron(schedule)
+	return err
+}
+
+// Whether the schedule fired since the last self-test, looking back at most a week
+func selfTestDue(config *Config, now time.Time) bool {
+	schedule, err := parseCron(config.Message.SelfTest)
+	if err != nil {
+		return false
+	}
+	since := selfTestSince
+	if result := config.Statistics.SelfTest; result != nil {
+		if last, err := time.Parse(time.RFC3339, result.Time); err == nil && last.After(since) {
+			since = last
+		}
+	}
+	since = since.Truncate(time.Minute)
+	for t := now.Truncate(time.Minute); t.After(since) && now.Sub(t) < 7*24*time.Hour; t = t.Add(-time.Minute) {
+		if schedule.matches(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send a labeled test alert the way a threshold alert goes, through the routes, the
+// length limits and the retries, and record which services didn't get it. A failure
+// is reported as a health event, a broken token shows up before a real alert needs it.
+func runSelfTest(config *Config, now time.Time) {
+	if config.Message.SelfTest == "" || !selfTestDue(config, now) || heldByQuietHours(config, "self-test", now) {
+		return
+	}
+	services := config.Message.route(routeThreshold)
+	if len(services) == 0 {
+		return
+	}
+	message := tr("[测试] 定期自检：这是一条测试提醒，不是真实的流量提醒，收到说明提醒能正常送达") + alertLink(config, now)
+
+	// One service at a time, so the result tells which one is broken
+	result := &SelfTestResult{Time: now.Format(time.RFC3339)}
+	var failures []string
+	for _, service := range services {
+		err := sendServiceMessage(config, service, message)
+		if err == nil {
+			continue
+		}
+		if result.Failed == nil {
+			result.Failed = make(map[string]string)
+		}
+		result.Failed[service] = err.Error()
+		failures = append(failures, fmt.Sprintf("%s: %v", service, err))
+	}
+	config.Statistics.SelfTest = result
+	if len(failures) == 0 {
+		logf("Self-test alert delivered to %s\n", strings.Join(services, ", "))
+		return
+	}
+	logf("Self-test alert failed, %s\n", strings.Join(failures, "; "))
+	sendHealthEvent(config, fmt.Sprintf(tr("定期自检失败，测试提醒没有送达：%s"), strings.Join(failures, "; ")))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"sync/atomic"
+)
+
+// Bytes of the message services' connections not yet taken by a sample
+var selfTraffic struct {
+	receive  atomic.Uint64
+	transmit atomic.Uint64
+}
+
+// A connection of a message service that counts what it carries. The count includes
+// TLS, not the TCP/IP headers, so it's a little below what the interface sees.
+type countingConn struct {
+	net.Conn
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	selfTraffic.receive.Add(uint64(n))
+	return n, err
+}
+
+func (c countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	selfTraffic.transmit.Add(uint64(n))
+	return n, err
+}
+
+// Own traffic that exceeded the counters of its sample, deducted from the next ones
+var selfPending NetStats
+
+// Add the own traffic since the previous sample to the period's figures. With
+// exclude_self it's taken off the counters of the main interface before they're
+// accounted.
+func takeSelfTraffic(config *Config, current map[string]NetStats) {
+	receive, transmit := selfTraffic.receive.Swap(0), selfTraffic.transmit.Swap(0)
+	config.Statistics.SelfReceive += receive
+	config.Statistics.SelfTransmit += transmit
+	if !config.Comparison.ExcludeSelf || len(current) == 0 {
+		return
+	}
+	key := selfTrafficKey(config, current)
+	stats := current[key]
+	last := config.Statistics.Counters[key]
+	if stats.ReceiveBytes < last.ReceiveBytes {
+		last.ReceiveBytes = 0
+	}
+	if stats.TransmitBytes < last.TransmitBytes {
+		last.TransmitBytes = 0
+	}
+	receive += selfPending.ReceiveBytes
+	transmit += selfPending.TransmitBytes
+	deductReceive := min(receive, stats.ReceiveBytes-last.ReceiveBytes)
+	deductTransmit := min(transmit, stats.TransmitBytes-last.TransmitBytes)
+	selfPending = NetStats{ReceiveBytes: receive - deductReceive, TransmitBytes: transmit - deductTransmit}
+
+	// Moving the previous counters forward leaves the deducted bytes out of the delta
+	last.ReceiveBytes += deductReceive
+	last.TransmitBytes += deductTransmit
+	config.Statistics.Counters[key] = last
+}
+
+// The counters the own traffic is deducted from: the interface of `interface`, or
+// the first of the others when it isn't among them
+func selfTrafficKey(config *Config, current map[string]NetStats) string {
+	if _, ok := current[config.Interface]; ok {
+		return config.Interface
+	}
+	keys := make([]string, 0, len(current))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys[0]
+}
+
+// The own traffic line of the summary
+func describeSelfTraffic(config *Config) string {
+	statistics := config.Statistics
+	if statistics.SelfReceive+statistics.SelfTransmit == 0 {
+		return ""
+	}
+	text := fmt.Sprintf(tr("程序自身发送消息的流量：下载%.2f MB，上传%.2f MB"),
+		float64(statistics.SelfReceive)/sizeBase/sizeBase,
+		float64(statistics.SelfTransmit)/sizeBase/sizeBase)
+	if config.Comparison.ExcludeSelf {
+		text += tr("（已从统计中扣除）")
+	}
+	return text
+}
@@ -0,0 +1,250 @@
+//go:build !noweb
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The user a request is authenticated as
+type principal struct {
+	name, role, token string
+}
+
+// The state shown by the HTTP server. The monitor publishes every saved config here
+// instead of sharing its own, so requests never race with the sampling loop.
+var snapshot struct {
+	sync.RWMutex
+	enabled bool
+	data    []byte
+}
+
+// Keep a copy of the saved config for the HTTP server
+func publishSnapshot(data []byte) {
+	snapshot.Lock()
+	defer snapshot.Unlock()
+	if snapshot.enabled {
+		snapshot.data = append(snapshot.data[:0], data...)
+	}
+}
+
+// Decode the last published config, every request gets its own copy
+func loadSnapshot() (Config, error) {
+	snapshot.RLock()
+	defer snapshot.RUnlock()
+	var config Config
+	if len(snapshot.data) == 0 {
+		return config, fmt.Errorf("no statistics yet")
+	}
+	err := json.Unmarshal(snapshot.data, &config)
+	return config, err
+}
+
+// Check the HTTP settings
+func validateHTTP(config *HTTPConfig) error {
+	if config.Listen == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(config.Listen); err != nil {
+		return fmt.Errorf("invalid http listen address %q: %v", config.Listen, err)
+	}
+	if config.PublicURL != "" {
+		if u, err := url.Parse(config.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid http public_url %q, must be an http(s) URL", config.PublicURL)
+		}
+	}
+	if err := validateOIDC(&config.OIDC); err != nil {
+		return err
+	}
+	if _, err := parseCIDRs(config.Allow); err != nil {
+		return fmt.Errorf("invalid http allow: %v", err)
+	}
+	if _, err := parseCIDRs(config.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid http trusted_proxies: %v", err)
+	}
+	names, tokens := map[string]bool{"admin": config.Token != ""}, map[string]bool{config.Token: config.Token != ""}
+	for _, user := range config.Users {
+		if user.Name == "" || user.Token == "" {
+			return fmt.Errorf("http user needs a name and a token")
+		}
+		if names[user.Name] || tokens[user.Token] {
+			return fmt.Errorf("duplicate http user or token: %s", user.Name)
+		}
+		names[user.Name], tokens[user.Token] = true, true
+		switch user.Role {
+		case roleAdmin, roleViewer:
+		default:
+			return fmt.Errorf("invalid role of http user %s: %s", user.Name, user.Role)
+		}
+	}
+	for _, hook := range config.Webhooks {
+		if hook.Name == "" || hook.Token == "" {
+			return fmt.Errorf("webhook needs a name and a token")
+		}
+		if tokens[hook.Token] {
+			return fmt.Errorf("duplicate token of webhook %s", hook.Name)
+		}
+		tokens[hook.Token] = true
+		for _, action := range hook.Actions {
+			if !webhookActions[action] {
+				return fmt.Errorf("invalid action of webhook %s: %s", hook.Name, action)
+			}
+		}
+	}
+	return nil
+}
+
+// Start the HTTP server in the background. The port is bound here, so a taken port
+// fails at startup instead of in a log line nobody reads.
+func startHTTPServer(config HTTPConfig, initial Config, configFilePath string) error {
+	// Validated already
+	httpGuard.allow, _ = parseCIDRs(config.Allow)
+	httpGuard.proxies, _ = parseCIDRs(config.TrustedProxies)
+	if config.AuthLog != "" {
+		file, err := os.OpenFile(config.AuthLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to open http auth log: %v", err)
+		}
+		httpGuard.authLog = file
+	}
+
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to start http server: %v", err)
+	}
+	if config.Token == "" && len(config.Users) == 0 && config.OIDC.Issuer == "" {
+		if host, _, _ := net.SplitHostPort(config.Listen); !isLoopback(host) {
+			logf("Warning: http server on %s has no token, anyone on the network can see and control the statistics\n", config.Listen)
+		}
+	}
+
+	snapshot.Lock()
+	snapshot.enabled = true
+	snapshot.Unlock()
+	if data, err := json.Marshal(initial); err == nil {
+		publishSnapshot(data)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", requireRole(config, roleViewer, handleDashboard))
+	mux.HandleFunc("/api/status", requireRole(config, roleViewer, handleAPIStatus))
+	for _, action := range []string{actionReset, actionPause, actionResume, actionAnnotate, actionEvaluate, actionCancelShutdown} {
+		mux.HandleFunc("/api/"+action, requireRole(config, roleAdmin, handleAPIControl(configFilePath, action)))
+	}
+	mux.HandleFunc("/reports/", requireRole(config, roleViewer, handleReport))
+	mux.HandleFunc("/api/webhook", handleWebhook(config, configFilePath))
+	if config.OIDC.Issuer != "" {
+		mux.HandleFunc("/auth/login", handleOIDCLogin(&config.OIDC))
+		mux.HandleFunc("/auth/callback", handleOIDCCallback(&config.OIDC))
+		mux.HandleFunc("/auth/logout", handleOIDCLogout)
+	}
+	// The status page checks the share token itself, it changes while the server runs
+	mux.HandleFunc("/status", handleStatus)
+	server := &http.Server{
+		Handler:           allowlisted(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			logf("HTTP server stopped: %v\n", err)
+		}
+	}()
+	logf("HTTP server listening on %s\n", listener.Addr())
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Find the user of a request. The token is accepted as a bearer token, as the password
+// of a browser login, or as the token query or form parameter so the dashboard can be
+// bookmarked. With OIDC a login session works as well. Without any of them configured
+// everyone is an admin.
+func authenticate(config HTTPConfig, r *http.Request) (principal, bool) {
+	if config.Token == "" && len(config.Users) == 0 && config.OIDC.Issuer == "" {
+		return principal{name: "anonymous", role: roleAdmin}, true
+	}
+	if config.OIDC.Issuer != "" {
+		if user, ok := sessionPrincipal(r); ok {
+			return user, true
+		}
+	}
+
+	given := r.FormValue("token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		given = bearer
+	} else if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	if given == "" {
+		return principal{}, false
+	}
+
+	users := config.Users
+	if config.Token != "" {
+		users = append([]HTTPUser{{Name: "admin", Token: config.Token, Role: roleAdmin}}, users...)
+	}
+	for _, user := range users {
+		if subtle.ConstantTimeCompare([]byte(given), []byte(user.Token)) == 1 {
+			return principal{name: user.Name, role: user.Role, token: user.Token}, true
+		}
+	}
+	return principal{}, false
+}
+
+// Only let users with the role, or a higher one, through
+func requireRole(config HTTPConfig, role string, next func(http.ResponseWriter, *http.Request, principal)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := authenticate(config, r)
+		if !ok {
+			// Browsers opening the dashboard go to the login provider
+			if config.OIDC.Issuer != "" && r.URL.Path == "/" {
+				http.Redirect(w, r, "/auth/login", http.StatusFound)
+				return
+			}
+			if credentialsGiven(r) {
+				name, _, _ := r.BasicAuth()
+				logAuthFailure(r, "unauthorized", name)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="netmonitor"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if role == roleAdmin && user.role != roleAdmin {
+			logAuthFailure(r, "forbidden", user.name)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r, user)
+	}
+}
+
+// GET /reports/<name>, a file kept by publishReport
+func handleReport(w http.ResponseWriter, r *http.Request, user principal) {
+	name := strings.TrimPrefix(r.URL.Path, "/reports/")
+	reportFiles.RLock()
+	defer reportFiles.RUnlock()
+	for _, file := range reportFiles.files {
+		if file.Name == name {
+			w.Header().Set("Content-Type", file.ContentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Name))
+			w.Write(file.Data)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
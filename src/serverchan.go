@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SendKeys of Server酱³ carry the user's number and are sent to their own host
+var serverChan3Key = regexp.MustCompile(`^sctp(\d+)t`)
+
+type ServerChanMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	SendKey         string `json:"send_key"` // Server酱的SendKey，SCT开头为Turbo版，sctp开头为Server酱³
+}
+
+// Push a message to WeChat through Server酱. The title is limited to 32 characters,
+// the whole message goes into the description.
+func sendServerChanMessage(sendKey, message, device string) error {
+	apiURL := fmt.Sprintf("https://sctapi.ftqq.com/%s.send", sendKey)
+	if match := serverChan3Key.FindStringSubmatch(sendKey); match != nil {
+		apiURL = fmt.Sprintf("https://%s.push.ft07.com/send/%s.send", match[1], sendKey)
+	}
+
+	title, _, _ := strings.Cut(fmt.Sprintf("[%s] %s", device, message), "\n")
+	if utf8.RuneCountInString(title) > 32 {
+		title = string([]rune(title)[:31]) + "…"
+	}
+	resp, err := notifyClient("serverchan").PostForm(apiURL, url.Values{"title": {title}, "desp": {message}})
+	if err != nil {
+		return fmt.Errorf("failed to send message to ServerChan: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The API answers code 0 on success, errors come with a message
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read ServerChan response: %s %v", resp.Status, err)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("got error from ServerChan: %d %s", result.Code, result.Message)
+	}
+	return nil
+}
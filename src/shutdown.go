@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+const actionCancelShutdown = "cancel-shutdown"
+
+// What scheduled a shutdown, the ratio needs to know its own countdown
+const (
+	shutdownRatio  = "ratio"
+	shutdownLadder = "ladder"
+	shutdownWan    = "wan"
+)
+
+// The countdown when shutdown_delay isn't set, the warning's time to arrive
+const defaultShutdownDelay = 30 * time.Second
+
+// Remaining times a countdown reminder is sent at, only those shorter than the delay
+var countdownMarks = []time.Duration{time.Hour, 30 * time.Minute, 10 * time.Minute, 5 * time.Minute, time.Minute}
+
+// A shutdown waiting for its time, kept in the statistics so a restart of the monitor
+// neither loses nor repeats it
+type ShutdownCountdown struct {
+	At        string `json:"at"`                  // 计划关机的时间，RFC3339格式
+	Source    string `json:"source"`              // 发起关机的规则：ratio、ladder或wan
+	Reason    string `json:"reason"`              // 关机原因，用于提醒和网页面板
+	Notified  int    `json:"notified,omitempty"`  // 最近一次倒计时提醒时的剩余秒数
+	Cancelled string `json:"cancelled,omitempty"` // 取消的时间，本周期不再因同一原因关机
+	By        string `json:"by,omitempty"`        // 取消关机的用户
+}
+
+func shutdownDelay(config *Config) time.Duration {
+	if config.ShutdownDelay > 0 {
+		return time.Duration(config.ShutdownDelay) * time.Second
+	}
+	return defaultShutdownDelay
+}
+
+// The shutdown time of a countdown started now, with how to stop it for the warning
+func shutdownNotice(config *Config) (time.Time, string) {
+	at := time.Now().Add(shutdownDelay(config))
+	return at, fmt.Sprintf(tr("（%s关机，执行netmonitor shutdown --cancel可以取消）"), at.Local().Format("15:04:05"))
+}
+
+// Start the countdown to a shutdown. A countdown already running keeps its earlier time.
+func scheduleShutdown(config *Config, source, reason string, at time.Time) {
+	if countdown := config.Statistics.Shutdown; countdown != nil && countdown.Cancelled == "" {
+		logf("Shutdown for %s joins the countdown already running\n", source)
+		return
+	}
+	config.Statistics.Shutdown = &ShutdownCountdown{
+		At:     at.Format(time.RFC3339),
+		Source: source,
+		Reason: reason,
+	}
+	logf("Shutdown scheduled at %s: %s\n", at.Format(time.RFC3339), reason)
+}
+
+// The running countdown's time, zero when there is none
+func pendingShutdown(config *Config) time.Time {
+	countdown := config.Statistics.Shutdown
+	if countdown == nil || countdown.Cancelled != "" {
+		return time.Time{}
+	}
+	at, err := time.Parse(time.RFC3339, countdown.At)
+	if err != nil {
+		return time.Time{}
+	}
+	return at
+}
+
+// The reminder mark the remaining time has reached, zero when none is due
+func dueCountdownMark(countdown *ShutdownCountdown, remaining time.Duration) time.Duration {
+	var due time.Duration
+	for _, mark := range countdownMarks {
+		if remaining <= mark {
+			due = mark
+		}
+	}
+	notified := time.Duration(countdown.Notified) * time.Second
+	if due == 0 || notified != 0 && due >= notified {
+		return 0
+	}
+	return due
+}
+
+// Whether the wait between samples should end for the countdown
+func countdownDue(config *Config, now time.Time) bool {
+	at := pendingShutdown(config)
+	if at.IsZero() {
+		return false
+	}
+	if !now.Before(at) {
+		return true
+	}
+	countdown := config.Statistics.Shutdown
+	return countdown.Notified != 0 && dueCountdownMark(countdown, at.Sub(now)) != 0
+}
+
+// Send the countdown reminders and power off once the time has come
+func runCountdown(config *Config, configFilePath string, now time.Time) {
+	at := pendingShutdown(config)
+	if at.IsZero() {
+		return
+	}
+	countdown := config.Statistics.Shutdown
+
+	// Booted after the deadline: the shutdown went through, only its state wasn't saved
+	if uptime, err := readUptime(); err == nil && now.Add(-uptime).After(at) {
+		config.Statistics.ShutdownAt = countdown.At
+		config.Statistics.Shutdown = nil
+		saveCountdown(config, configFilePath)
+		return
+	}
+
+	if now.Before(at) {
+		remaining := at.Sub(now)
+		// The first reminder is the warning itself, marks longer than the delay are skipped
+		if countdown.Notified == 0 {
+			countdown.Notified = int(remaining.Round(time.Second).Seconds())
+			saveCountdown(config, configFilePath)
+			return
+		}
+		if mark := dueCountdownMark(countdown, remaining); mark != 0 {
+			countdown.Notified = int(mark.Seconds())
+			message := fmt.Sprintf(tr("关机倒计时：%s，还剩%s，将于%s关机，执行netmonitor shutdown --cancel可以取消"),
+				countdown.Reason, remaining.Round(time.Second), at.Local().Format("15:04:05"))
+			_, err := sendUrgentMessage(config, config.Message.route(routeRatio), message)
+			reportHealth(config, healthSend, err)
+			if err != nil {
+				logf("Failed to send countdown message: %v\n", err)
+			}
+			saveCountdown(config, configFilePath)
+		}
+		return
+	}
+
+	// Saved before powering off, the next boot finds shutdown_at and not the countdown
+	logf("Shutting down: %s\n", countdown.Reason)
+	markShutdown(config)
+	config.Statistics.Shutdown = nil
+	saveCountdown(config, configFilePath)
+	powerOff()
+}
+
+func saveCountdown(config *Config, configFilePath string) {
+	err := saveConfig(configFilePath, *config)
+	reportHealth(config, healthSave, err)
+	if err != nil {
+		logf("Failed to save config for the shutdown countdown: %v\n", err)
+	}
+}
+
+// Stop the running countdown, queued by `netmonitor shutdown --cancel`. The rule that
+// started it doesn't fire again this period.
+func cancelShutdown(config *Config, command Command) {
+	if pendingShutdown(config).IsZero() {
+		logf("No shutdown to cancel\n")
+		return
+	}
+	countdown := config.Statistics.Shutdown
+	countdown.Cancelled = time.Now().Format(time.RFC3339)
+	countdown.By = command.By
+	detail := tr("取消了计划的关机：") + countdown.Reason
+	if command.Reason != "" {
+		detail += "，" + command.Reason
+	}
+	addEventBy(config, eventEnforcement, time.Now(), time.Time{}, detail, command.By)
+	logf("Shutdown cancelled by %s\n", command.By)
+}
+
+// The countdown for the dashboard and the status page, empty when none is running
+func describeShutdown(config *Config, now time.Time) string {
+	at := pendingShutdown(config)
+	if at.IsZero() {
+		return ""
+	}
+	remaining := max(at.Sub(now), 0)
+	return fmt.Sprintf(tr("%s，将于%s关机，还剩%s"), config.Statistics.Shutdown.Reason, at.Local().Format("01-02 15:04:05"), remaining.Round(time.Second))
+}
+
+// netmonitor shutdown --cancel [--reason text]
+func runShutdownCommand(args []string) int {
+	flags := flag.NewFlagSet("shutdown", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	cancel := flags.Bool("cancel", false, "Cancel the running shutdown countdown")
+	reason := flags.String("reason", "", "Why the shutdown is cancelled, recorded in the history")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !*cancel {
+		fmt.Fprintln(os.Stderr, "usage: netmonitor shutdown --cancel [--reason text]")
+		return exitUsage
+	}
+	if err := queueCommand(*configFilePath, Command{Action: actionCancelShutdown, Reason: *reason}); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue cancel: %v\n", err)
+		return exitFailure
+	}
+	fmt.Println("The shutdown countdown will be cancelled")
+	return exitOK
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Send a message to Slack, through the incoming webhook if there is one, otherwise
+// with the bot token to the channel
+func sendSlackMessage(slack SlackMessage, message, device string) error {
+	text := fmt.Sprintf("[%s] %s", device, message)
+	if slack.WebhookURL != "" {
+		jsonBody, _ := json.Marshal(map[string]string{"text": text})
+		resp, err := notifyClient("slack").Post(slack.WebhookURL, "application/json", bytes.NewBuffer(jsonBody))
+		if err != nil {
+			return fmt.Errorf("failed to send message to Slack: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("got error status from Slack: %s", resp.Status)
+		}
+		return nil
+	}
+
+	jsonBody, _ := json.Marshal(map[string]string{"channel": slack.Channel, "text": text})
+	req, err := http.NewRequest("POST", "https://slack.com/api/chat.postMessage", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request to Slack: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+slack.Token)
+
+	resp, err := notifyClient("slack").Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message to Slack: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The Web API answers 200 and reports failures in the body
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read Slack response: %v", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("got error from Slack: %s", result.Error)
+	}
+	return nil
+}
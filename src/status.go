@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const actionShare = "share"
+
+// The first reset after now, zero for a prepaid balance, which is never reset, and when
+// the billing calendar has no further period
+func nextResetDate(config *Config, now time.Time) time.Time {
+	if config.Prepaid {
+		return time.Time{}
+	}
+	if config.BillingCalendar != "" {
+		if resets := calendarResets(now, 1); len(resets) > 0 {
+			return resets[0]
+		}
+		return time.Time{}
+	}
+	startDay := config.StartDay
+	if startDay < 1 {
+		return time.Time{}
+	}
+	reset := resetDateOf(now, startDay)
+	if !reset.After(now) {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		reset = resetDateOf(month.AddDate(0, 1, 0), startDay)
+	}
+	return reset
+}
+
+// Set or revoke the share token queued by `netmonitor share`
+func setShareToken(config *Config, command Command) {
+	config.HTTP.ShareToken = command.Reason
+	if command.Reason == "" {
+		logf("Status page link revoked\n")
+	} else {
+		logf("Status page link created\n")
+	}
+}
+
+// netmonitor share [--url http://host:8080] [--revoke]
+func runShareCommand(args []string) int {
+	flags := flag.NewFlagSet("share", flag.ContinueOnError)
+	configFilePath := flags.String("c", defaultConfigPath, "Path to the config JSON file")
+	baseURL := flags.String("url", "", "Address the page is reached at, e.g. http://192.168.1.2:8080 (default: http.listen)")
+	revoke := flags.Bool("revoke", false, "Revoke the current link instead of creating a new one")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	config, err := loadConfig(*configFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return loadErrorCode(err)
+	}
+	if config.HTTP.Listen == "" && !*revoke {
+		fmt.Fprintln(os.Stderr, "the http server is not enabled, set http.listen first")
+		return exitConfig
+	}
+
+	// A new link replaces the previous one, so sharing again also revokes the old link
+	command := Command{Action: actionShare}
+	if !*revoke {
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to generate token: %v\n", err)
+			return exitFailure
+		}
+		command.Reason = hex.EncodeToString(secret)
+	}
+	if err := queueCommand(*configFilePath, command); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to queue share: %v\n", err)
+		return exitFailure
+	}
+
+	if *revoke {
+		fmt.Println("The status page link will be revoked")
+		return exitOK
+	}
+	if *baseURL == "" {
+		*baseURL = "http://" + config.HTTP.Listen
+	}
+	fmt.Printf("%s/status?token=%s\n", strings.TrimRight(*baseURL, "/"), command.Reason)
+	return exitOK
+}
@@ -0,0 +1,75 @@
+//go:build !noweb
+
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Write a progress bar of a quota
+func writeQuota(b *strings.Builder, name string, comparison Comparison, receive, transmit uint64) {
+	value := categoryUsageGB(comparison.Category, receive, transmit)
+	percent := value / comparison.Limit * 100
+	color := "#2ca02c"
+	switch {
+	case value >= comparison.Limit*comparison.Ratio:
+		color = "#d62728"
+	case value >= comparison.Limit*comparison.Threshold:
+		color = "#ff7f0e"
+	}
+	fmt.Fprintf(b, "<h2>%s</h2>\n", html.EscapeString(name))
+	fmt.Fprintf(b, "<div style=\"background: #eee; height: 24px\"><div style=\"background: %s; height: 24px; width: %.1f%%\"></div></div>\n", color, min(percent, 100))
+	fmt.Fprintf(b, tr("<p>已使用 %.2f GB / %.2f GB (%.1f%%)，剩余 %.2f GB</p>\n"), value, comparison.Limit, percent, max(comparison.Limit-value, 0))
+}
+
+// The shared status page: quota progress only, no events, no controls and nothing from the config
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	config, err := loadSnapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	token := config.HTTP.ShareToken
+	if token == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(token)) != 1 {
+		if r.URL.Query().Get("token") != "" {
+			logAuthFailure(r, "share-token", "")
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><meta name=\"viewport\" content=\"width=device-width\"><title>" + tr("流量使用情况") + "</title></head>\n")
+	b.WriteString("<body style=\"font-family: sans-serif; max-width: 600px; margin: auto; padding: 8px\">\n")
+	fmt.Fprintf(&b, tr("<h1>%s 流量使用情况</h1>\n"), html.EscapeString(config.Device))
+	if reset := nextResetDate(&config, time.Now()); !reset.IsZero() {
+		fmt.Fprintf(&b, tr("<p>统计周期：%s 至 %s，%s重置</p>\n"), html.EscapeString(lastResetDate(&config)),
+			reset.AddDate(0, 0, -1).Format("2006-01-02"), reset.Format("01-02"))
+	} else {
+		fmt.Fprintf(&b, tr("<p>统计周期：%s 至今</p>\n"), html.EscapeString(lastResetDate(&config)))
+	}
+	if countdown := describeShutdown(&config, time.Now()); countdown != "" {
+		fmt.Fprintf(&b, tr("<p style=\"color: #d62728\"><b>关机倒计时：%s</b></p>\n"), html.EscapeString(countdown))
+	}
+	if limit := effectiveLimit(&config); limit > 0 {
+		comparison := config.Comparison
+		comparison.Limit = limit
+		writeQuota(&b, tr("总流量"), comparison, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+	}
+	for _, wan := range config.Wans {
+		if wan.Comparison.Limit > 0 {
+			stats := config.Statistics.Wans[wan.Name]
+			writeQuota(&b, tr("线路")+wan.Name, wan.Comparison, stats.TotalReceive, stats.TotalTransmit)
+		}
+	}
+	b.WriteString("</body></html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	fmt.Fprint(w, b.String())
+}
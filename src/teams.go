@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Payload formats of Teams webhooks
+const (
+	teamsAdaptive    = "adaptive"    // Adaptive Card, for Workflows webhooks
+	teamsMessageCard = "messagecard" // MessageCard, for the older Office 365 connectors
+)
+
+type TeamsMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	WebhookURL      string `json:"webhook_url"`    // 工作流或传入Webhook连接器的地址
+	Card            string `json:"card,omitempty"` // 卡片格式：adaptive（默认）或messagecard
+}
+
+// The period's usage as facts, with how serious the message is: "attention" for the
+// shutdown warnings and over the ratio, "warning" over the threshold
+func teamsFacts(config *Config) ([][2]string, string) {
+	receiveGB := float64(config.Statistics.TotalReceive) / bytesToGB
+	transmitGB := float64(config.Statistics.TotalTransmit) / bytesToGB
+	facts := [][2]string{
+		{tr("下载"), fmt.Sprintf("%.2f GB", receiveGB)},
+		{tr("上传"), fmt.Sprintf("%.2f GB", transmitGB)},
+		{tr("合计"), fmt.Sprintf("%.2f GB", receiveGB+transmitGB)},
+	}
+	level := "good"
+	if limit := effectiveLimit(config); limit > 0 {
+		used := categoryUsageGB(config.Comparison.Category, config.Statistics.TotalReceive, config.Statistics.TotalTransmit)
+		facts = append(facts, [2]string{tr("已使用"), fmt.Sprintf("%.2f GB / %.2f GB (%.1f%%)", used, limit, used/limit*100)})
+		switch {
+		case used >= limit*config.Comparison.Ratio:
+			level = "attention"
+		case used >= limit*config.Comparison.Threshold:
+			level = "warning"
+		}
+	}
+	if config.urgent {
+		level = "attention"
+	}
+	return facts, level
+}
+
+// An Adaptive Card with a line per text block, Teams joins the lines of one block
+func teamsAdaptiveCard(title, message string, facts [][2]string, level string) map[string]any {
+	body := []any{map[string]any{"type": "TextBlock", "text": title, "weight": "bolder", "size": "medium", "color": level, "wrap": true}}
+	spacing := "default"
+	for _, line := range strings.Split(message, "\n") {
+		if line == "" {
+			spacing = "medium"
+			continue
+		}
+		body = append(body, map[string]any{"type": "TextBlock", "text": line, "wrap": true, "spacing": spacing})
+		spacing = "none"
+	}
+	var factSet []any
+	for _, fact := range facts {
+		factSet = append(factSet, map[string]string{"title": fact[0], "value": fact[1]})
+	}
+	body = append(body, map[string]any{"type": "FactSet", "facts": factSet, "separator": true})
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
+
+// A MessageCard of the Office 365 connectors, the level as the theme color
+func teamsMessageCardPayload(title, message string, facts [][2]string, level string) map[string]any {
+	colors := map[string]string{"good": "2CA02C", "warning": "FF7F0E", "attention": "D62728"}
+	var factList []any
+	for _, fact := range facts {
+		factList = append(factList, map[string]string{"name": fact[0], "value": fact[1]})
+	}
+	return map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    title,
+		"themeColor": colors[level],
+		"title":      title,
+		"text":       strings.ReplaceAll(message, "\n", "<br>"),
+		"sections":   []any{map[string]any{"facts": factList}},
+	}
+}
+
+// Post a message to a Teams channel as a card, with the period's usage below it
+func sendTeamsMessage(config *Config, message string) error {
+	teams := config.Message.Teams
+	title := fmt.Sprintf(tr("[%s] 流量监控"), config.Device)
+	facts, level := teamsFacts(config)
+	payload := teamsAdaptiveCard(title, message, facts, level)
+	if teams.Card == teamsMessageCard {
+		payload = teamsMessageCardPayload(title, message, facts, level)
+	}
+	jsonBody, _ := json.Marshal(payload)
+
+	resp, err := notifyClient("teams").Post(teams.WebhookURL, "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to send message to Teams: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("got error status from Teams: %s %s", resp.Status, bytes.TrimSpace(reply))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Parse modes of the Bot API that formatted messages are sent with
+const (
+	telegramHTML       = "HTML"
+	telegramMarkdownV2 = "MarkdownV2"
+)
+
+// Characters MarkdownV2 reserves, they're escaped with a backslash in plain text
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`,
+	"`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`,
+	"{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// Check the Telegram settings when it is one of the services
+func validateTelegram(telegram TelegramMessage) error {
+	switch telegram.ParseMode {
+	case "", telegramHTML, telegramMarkdownV2:
+	default:
+		return fmt.Errorf("invalid telegram parse_mode: %s, must be %s or %s", telegram.ParseMode, telegramHTML, telegramMarkdownV2)
+	}
+	if telegram.ThreadID < 0 {
+		return fmt.Errorf("invalid telegram message_thread_id: %d", telegram.ThreadID)
+	}
+	return nil
+}
+
+// The chats messages go to: chat_id first, then the ones in chat_ids
+func (t TelegramMessage) chats() []string {
+	var chats []string
+	if t.ChatID != "" {
+		chats = append(chats, t.ChatID)
+	}
+	for _, chat := range t.ChatIDs {
+		if chat != "" && chat != t.ChatID {
+			chats = append(chats, chat)
+		}
+	}
+	return chats
+}
+
+// The fields of a request to one chat: its topic and whether the phone makes a sound
+func (t TelegramMessage) fields(chatID string, routine bool) map[string]any {
+	fields := map[string]any{"chat_id": chatID}
+	if t.ThreadID > 0 {
+		fields["message_thread_id"] = t.ThreadID
+	}
+	if routine && t.Silent {
+		fields["disable_notification"] = true
+	}
+	return fields
+}
+
+// Format a message for the parse mode: the first line bold and the "- " lines of the
+// summary as bullets. Telegram has no paragraphs or lists, line breaks stay as they are.
+func formatTelegram(parseMode, text string) string {
+	escape, bold := html.EscapeString, func(s string) string { return "<b>" + s + "</b>" }
+	if parseMode == telegramMarkdownV2 {
+		escape, bold = markdownV2Escaper.Replace, func(s string) string { return "*" + s + "*" }
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if item, ok := strings.CutPrefix(line, "- "); ok {
+			lines[i] = "• " + escape(item)
+		} else if i == 0 {
+			lines[i] = bold(escape(line))
+		} else {
+			lines[i] = escape(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Send to every chat, like the services it counts as sent once one chat got it and the
+// failures next to a delivery are logged
+func sendTelegramChats(telegram TelegramMessage, send func(chatID string) error) error {
+	chats := telegram.chats()
+	if len(chats) == 0 {
+		return errors.New("telegram needs a chat_id")
+	}
+	var errs []error
+	for _, chat := range chats {
+		if err := send(chat); err != nil {
+			if len(chats) > 1 {
+				err = fmt.Errorf("chat %s: %v", chat, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(chats) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		logf("Telegram message not delivered to %v\n", err)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+//go:build !nocollector
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const upnpWanService = "WANCommonInterfaceConfig"
+
+type upnpService struct {
+	ServiceType string `xml:"serviceType"`
+	ControlURL  string `xml:"controlURL"`
+}
+
+type upnpDevice struct {
+	Services []upnpService `xml:"serviceList>service"`
+	Devices  []upnpDevice  `xml:"deviceList>device"`
+}
+
+type upnpRoot struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+// Polls the WAN byte counters of a home router via UPnP IGD
+type upnpCollector struct {
+	controlURL  string
+	serviceType string
+	client      *http.Client
+
+	started  bool
+	lastRaw  NetStats // last values read from the router
+	extended NetStats // 64-bit totals since start, IGD counters are only 32-bit
+}
+
+// Find the router's WAN service, from the configured description URL or via SSDP
+func startUpnpCollector(config *CollectorConfig) (*upnpCollector, error) {
+	location := config.URL
+	if location == "" {
+		var err error
+		location, err = discoverIGD()
+		if err != nil {
+			return nil, err
+		}
+		logf("Found UPnP gateway at %s\n", location)
+	}
+
+	c := &upnpCollector{client: &http.Client{Timeout: 10 * time.Second}}
+	if err := c.findWanService(location); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Search the local network for an Internet Gateway Device
+func discoverIGD() (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n\r\n"
+	target := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+	if _, err := conn.WriteTo([]byte(search), target); err != nil {
+		return "", err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", fmt.Errorf("no UPnP gateway found: %v", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
+
+// Read the device description and locate the WANCommonInterfaceConfig control URL
+func (c *upnpCollector) findWanService(location string) error {
+	resp, err := c.client.Get(location)
+	if err != nil {
+		return fmt.Errorf("failed to read UPnP description: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var root upnpRoot
+	if err := xml.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return fmt.Errorf("invalid UPnP description: %v", err)
+	}
+
+	service, ok := findUpnpService(root.Device)
+	if !ok {
+		return fmt.Errorf("router has no %s service", upnpWanService)
+	}
+
+	base := location
+	if root.URLBase != "" {
+		base = root.URLBase
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	controlURL, err := baseURL.Parse(service.ControlURL)
+	if err != nil {
+		return err
+	}
+
+	c.controlURL = controlURL.String()
+	c.serviceType = service.ServiceType
+	return nil
+}
+
+func findUpnpService(device upnpDevice) (upnpService, bool) {
+	for _, service := range device.Services {
+		if strings.Contains(service.ServiceType, upnpWanService) {
+			return service, true
+		}
+	}
+	for _, child := range device.Devices {
+		if service, ok := findUpnpService(child); ok {
+			return service, true
+		}
+	}
+	return upnpService{}, false
+}
+
+// Call a SOAP action without arguments and return the value of the named output argument
+func (c *upnpCollector) call(action, argument string) (uint64, error) {
+	body := fmt.Sprintf(`<?xml version="1.0"?>`+
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<s:Body><u:%s xmlns:u="%s"/></s:Body></s:Envelope>`, action, c.serviceType)
+
+	req, err := http.NewRequest("POST", c.controlURL, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, c.serviceType, action))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("UPnP %s failed: %v", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("UPnP %s failed: %s", action, resp.Status)
+	}
+
+	// Only the single output argument is needed, find it by element name
+	decoder := xml.NewDecoder(io.LimitReader(resp.Body, 64*1024))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, fmt.Errorf("UPnP %s response has no %s", action, argument)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == argument {
+			var value string
+			if err := decoder.DecodeElement(&value, &start); err != nil {
+				return 0, err
+			}
+			return strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		}
+	}
+}
+
+func (c *upnpCollector) counters() (map[string]NetStats, error) {
+	received, err := c.call("GetTotalBytesReceived", "NewTotalBytesReceived")
+	if err != nil {
+		return nil, err
+	}
+	sent, err := c.call("GetTotalBytesSent", "NewTotalBytesSent")
+	if err != nil {
+		return nil, err
+	}
+
+	raw := NetStats{ReceiveBytes: received, TransmitBytes: sent}
+	if c.started {
+		c.extended.ReceiveBytes += upnpCounterDelta(c.lastRaw.ReceiveBytes, raw.ReceiveBytes)
+		c.extended.TransmitBytes += upnpCounterDelta(c.lastRaw.TransmitBytes, raw.TransmitBytes)
+	}
+	c.started = true
+	c.lastRaw = raw
+
+	return map[string]NetStats{"upnp": c.extended}, nil
+}
+
+// Difference between two readings of a 32-bit IGD counter. A decrease from the upper
+// half of the range is a wrap, anything else means the router restarted.
+func upnpCounterDelta(last, current uint64) uint64 {
+	if current >= last {
+		return current - last
+	}
+	if last <= 1<<32 && last > 1<<31 {
+		return 1<<32 - last + current
+	}
+	return current
+}
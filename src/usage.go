@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type DayUsage struct {
+	Date     string `json:"date"` // 本地日期，2006-01-02
+	Receive  uint64 `json:"receive"`
+	Transmit uint64 `json:"transmit"`
+}
+
+// Daily buckets outlive the period reset, so rate estimates right after a reset still
+// have data; two months cover the previous period for comparisons
+const maxHistoryDays = 62
+
+// Days averaged for the time-to-limit estimate
+const estimateDays = 7
+
+// Biggest days listed in the period summary
+const topDays = 3
+
+// Add billable traffic to today's bucket
+func recordDailyUsage(config *Config, now time.Time, receive, transmit uint64) {
+	if receive == 0 && transmit == 0 {
+		return
+	}
+	date := now.Format("2006-01-02")
+	days := config.History.Days
+	if len(days) == 0 || days[len(days)-1].Date != date {
+		days = append(days, DayUsage{Date: date})
+		if len(days) > maxHistoryDays {
+			days = days[len(days)-maxHistoryDays:]
+		}
+	}
+	days[len(days)-1].Receive += receive
+	days[len(days)-1].Transmit += transmit
+	config.History.Days = days
+}
+
+// Estimate when the limit is reached at the average rate of the last days, e.g.
+// "按最近7天的平均速度（每天3.20 GB），约5.2天后达到限额". Empty without a day of data.
+func estimateTimeToLimit(config *Config, now time.Time, valueInGB float64) string {
+	since := now.AddDate(0, 0, -(estimateDays - 1)).Format("2006-01-02")
+	var first time.Time
+	var usedGB float64
+	for _, day := range config.History.Days {
+		if day.Date < since {
+			continue
+		}
+		if first.IsZero() {
+			first, _ = time.ParseInLocation("2006-01-02", day.Date, time.Local)
+		}
+		usedGB += categoryUsageGB(config.Comparison.Category, day.Receive, day.Transmit)
+	}
+
+	elapsed := now.Sub(first).Hours() / 24
+	if first.IsZero() || elapsed < 1 || usedGB <= 0 {
+		return ""
+	}
+	perDay := usedGB / elapsed
+	remaining := effectiveLimit(config) - valueInGB
+	if remaining <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(tr("按最近%.0f天的平均速度（每天%.2f GB），约%.1f天后达到限额"), min(elapsed, estimateDays), perDay, remaining/perDay)
+}
+
+// List the biggest days of the current period, so anomalous days stand out in the summary
+func describeTopDays(config *Config) string {
+	var days []DayUsage
+	for _, day := range config.History.Days {
+		if day.Date >= lastResetDate(config) {
+			days = append(days, day)
+		}
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		return days[i].Receive+days[i].Transmit > days[j].Receive+days[j].Transmit
+	})
+	if len(days) > topDays {
+		days = days[:topDays]
+	}
+
+	var lines []string
+	for _, day := range days {
+		date, err := time.ParseInLocation("2006-01-02", day.Date, time.Local)
+		if err != nil {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(tr("- %s 周%s：%.2f GB（下载%.2f GB，上传%.2f GB）"), day.Date,
+			weekdayName((int(date.Weekday())+6)%7), float64(day.Receive+day.Transmit)/bytesToGB,
+			float64(day.Receive)/bytesToGB, float64(day.Transmit)/bytesToGB))
+	}
+	return strings.Join(lines, "\n")
+}
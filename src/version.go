@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at release build time with -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// Describe the build, falling back to the VCS info Go records for local builds
+func versionString() string {
+	revision, built := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if revision == "" {
+					revision = setting.Value
+				}
+			case "vcs.time":
+				if built == "" {
+					built = setting.Value
+				}
+			}
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision == "" {
+		revision = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return fmt.Sprintf("netmonitor %s (commit %s, built %s, %s %s/%s)",
+		version, revision, built, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What to do when a WAN reaches its ratio limit
+const (
+	wanActionNotify   = ""         // 只发送提醒
+	wanActionShutdown = "shutdown" // 关机，与全局限额相同
+	wanActionIfdown   = "ifdown"   // 关闭该线路的网卡，其他线路不受影响
+)
+
+type Wan struct {
+	Name       string     `json:"name"`       // 线路名称，例如"fiber"、"lte"
+	Interfaces []string   `json:"interfaces"` // 属于该线路的网卡，支持通配符；使用采集器时为计数器名称
+	Comparison Comparison `json:"comparison"` // 该线路的限额，limit为0表示不限量
+	Action     string     `json:"action"`     // 超过ratio后的处理：shutdown、ifdown或为空只提醒
+	Failover   bool       `json:"failover"`   // 备用线路，只在承载默认路由时计入该线路的限额
+}
+
+type WanStats struct {
+	TotalReceive    uint64 `json:"total_receive"`
+	TotalTransmit   uint64 `json:"total_transmit"`
+	ThresholdStatus bool   `json:"threshold_status"` // 本周期是否已发送阈值提醒
+	RatioStatus     bool   `json:"ratio_status"`     // 本周期是否已执行超限处理
+
+	// 备用线路承载默认路由的开始时间，为空表示处于备用状态
+	ActiveSince string `json:"active_since,omitempty"`
+	// 备用状态下的流量（例如链路探测），不计入该线路的限额
+	StandbyReceive  uint64 `json:"standby_receive,omitempty"`
+	StandbyTransmit uint64 `json:"standby_transmit,omitempty"`
+}
+
+// Check the WAN list, every WAN needs a unique name and its own interfaces
+func validateWans(wans []Wan) error {
+	seen := make(map[string]bool)
+	for _, wan := range wans {
+		if wan.Name == "" {
+			return fmt.Errorf("wan name is required")
+		}
+		if seen[wan.Name] {
+			return fmt.Errorf("duplicate wan %q", wan.Name)
+		}
+		seen[wan.Name] = true
+		if len(wan.Interfaces) == 0 {
+			return fmt.Errorf("wan %q has no interfaces", wan.Name)
+		}
+		if wan.Comparison.Limit > 0 {
+			switch wan.Comparison.Category {
+			case "download", "upload", "upload+download", "anymax":
+			default:
+				return fmt.Errorf("invalid comparison category of wan %q: %s", wan.Name, wan.Comparison.Category)
+			}
+		}
+		switch wan.Action {
+		case wanActionNotify, wanActionShutdown, wanActionIfdown:
+		default:
+			return fmt.Errorf("invalid action of wan %q: %s", wan.Name, wan.Action)
+		}
+	}
+	return nil
+}
+
+// List the interfaces of all WANs, they are monitored even when not listed in interfaces
+func wanInterfaces(config *Config) []string {
+	var ifaces []string
+	for _, wan := range config.Wans {
+		ifaces = append(ifaces, wan.Interfaces...)
+	}
+	return ifaces
+}
+
+// Find the WAN a counter key belongs to, the first matching WAN wins
+func wanOf(config *Config, key string) *Wan {
+	for i := range config.Wans {
+		for _, spec := range config.Wans[i].Interfaces {
+			if spec == key {
+				return &config.Wans[i]
+			}
+			if matched, _ := filepath.Match(spec, key); matched {
+				return &config.Wans[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Add a counter's billable traffic to the totals of its WAN
+func addWanUsage(config *Config, key string, receive, transmit uint64) {
+	wan := wanOf(config, key)
+	if wan == nil {
+		return
+	}
+	if config.Statistics.Wans == nil {
+		config.Statistics.Wans = make(map[string]WanStats)
+	}
+	stats := config.Statistics.Wans[wan.Name]
+	if wan.Failover && stats.ActiveSince == "" {
+		stats.StandbyReceive += receive
+		stats.StandbyTransmit += transmit
+	} else {
+		stats.TotalReceive += receive
+		stats.TotalTransmit += transmit
+	}
+	config.Statistics.Wans[wan.Name] = stats
+}
+
+// Find the interface carrying the IPv4 default route, the lowest metric wins
+func defaultRouteInterface() (string, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	iface, best := "", uint64(0)
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		if flags&1 == 0 { // RTF_UP
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[6], 10, 32)
+		if iface == "" || metric < best {
+			iface, best = fields[0], metric
+		}
+	}
+	return iface, scanner.Err()
+}
+
+// Track which failover WANs carry the default route, the periods are recorded in the
+// history. The state is sampled once per interval, so a switch is seen at most one
+// interval late and that interval's traffic is attributed by the state at its end.
+func updateWanRoutes(config *Config, now time.Time) {
+	var failover []Wan
+	for _, wan := range config.Wans {
+		if wan.Failover {
+			failover = append(failover, wan)
+		}
+	}
+	if len(failover) == 0 {
+		return
+	}
+
+	route, err := defaultRouteInterface()
+	if err != nil {
+		logf("Failed to read the default route, failover state unchanged: %v\n", err)
+		return
+	}
+
+	if config.Statistics.Wans == nil {
+		config.Statistics.Wans = make(map[string]WanStats)
+	}
+	for _, wan := range failover {
+		active := false
+		for _, spec := range wan.Interfaces {
+			if matched, _ := filepath.Match(spec, route); matched {
+				active = true
+				break
+			}
+		}
+
+		stats := config.Statistics.Wans[wan.Name]
+		switch {
+		case active && stats.ActiveSince == "":
+			stats.ActiveSince = now.Format(time.RFC3339)
+			logf("Failover: wan %s now carries the default route\n", wan.Name)
+		case !active && stats.ActiveSince != "":
+			since, _ := time.Parse(time.RFC3339, stats.ActiveSince)
+			addEvent(config, eventFailover, since, now, fmt.Sprintf(tr("默认路由切换到线路%s"), wan.Name))
+			stats.ActiveSince = ""
+			logf("Failover: wan %s no longer carries the default route\n", wan.Name)
+		}
+		config.Statistics.Wans[wan.Name] = stats
+	}
+}
+
+// The usage counted against a quota, in GB
+func categoryUsageGB(category string, receive, transmit uint64) float64 {
+	receiveGB := float64(receive) / bytesToGB
+	transmitGB := float64(transmit) / bytesToGB
+	switch category {
+	case "download":
+		return receiveGB
+	case "upload":
+		return transmitGB
+	case "upload+download":
+		return receiveGB + transmitGB
+	case "anymax":
+		return max(receiveGB, transmitGB)
+	}
+	return 0
+}
+
+// Compare every WAN with its own quota, send the reminders and enforce the limit
+func checkWanQuotas(config *Config, configFilePath string) {
+	for _, wan := range config.Wans {
+		if wan.Comparison.Limit <= 0 {
+			continue
+		}
+		stats := config.Statistics.Wans[wan.Name]
+		valueInGB := categoryUsageGB(wan.Comparison.Category, stats.TotalReceive, stats.TotalTransmit)
+		changed, enforce := false, false
+		var shutdownAt time.Time
+
+		thresholdDue := valueInGB >= wan.Comparison.Limit*wan.Comparison.Threshold && !stats.ThresholdStatus
+		if thresholdDue && !heldByQuietHours(config, routeThreshold+":"+wan.Name, time.Now()) {
+			message := fmt.Sprintf(tr("流量提醒：线路%s当前使用量为 %.2f GB，超过了设置的%.0f%%阈值"), wan.Name, valueInGB, wan.Comparison.Threshold*100)
+			err := sendQueuedMessage(config, config.Message.route(routeThreshold), message+alertLink(config, time.Now()))
+			reportHealth(config, healthSend, err)
+			if err != nil {
+				logf("Failed to send threshold message of wan %s: %v\n", wan.Name, err)
+			}
+			// An undelivered alert waits in the outbox, sending it again would repeat it
+			stats.ThresholdStatus = true
+			changed = true
+			addEvent(config, eventAlert, time.Now(), time.Time{}, message)
+		}
+
+		overLimit := valueInGB >= wan.Comparison.Limit*wan.Comparison.Ratio && !stats.RatioStatus
+		if overLimit && (wan.Action == wanActionNotify || enforcementAllowed(config, wan.Name, tr("线路")+wan.Name)) {
+			message := fmt.Sprintf(tr("超限警告：线路%s当前使用量 %.2f GB，超过了限制的%.0f%%"), wan.Name, valueInGB, wan.Comparison.Ratio*100)
+			switch wan.Action {
+			case wanActionShutdown:
+				var notice string
+				shutdownAt, notice = shutdownNotice(config)
+				message += tr("，即将关机！") + notice
+			case wanActionIfdown:
+				message += fmt.Sprintf(tr("，即将关闭网卡%s！"), strings.Join(wan.Interfaces, ", "))
+			}
+			err := sendQueuedMessage(config, config.Message.route(routeRatio), message+alertLink(config, time.Now()))
+			reportHealth(config, healthSend, err)
+			if err != nil {
+				logf("Failed to send ratio warning of wan %s: %v\n", wan.Name, err)
+			}
+			// Unlike the global limit the action doesn't wait for the message, a
+			// metered line must not keep running up charges while the notifier is down
+			stats.RatioStatus = true
+			changed, enforce = true, true
+			kind := eventEnforcement
+			if wan.Action == wanActionNotify {
+				kind = eventAlert
+			}
+			addEvent(config, kind, time.Now(), time.Time{}, message)
+			if wan.Action == wanActionShutdown {
+				scheduleShutdown(config, shutdownWan, fmt.Sprintf(tr("线路%s超过了限制的%.0f%%"), wan.Name, wan.Comparison.Ratio*100), shutdownAt)
+			}
+		}
+
+		if !changed {
+			continue
+		}
+		if config.Statistics.Wans == nil {
+			config.Statistics.Wans = make(map[string]WanStats)
+		}
+		config.Statistics.Wans[wan.Name] = stats
+		err := saveConfig(configFilePath, *config)
+		reportHealth(config, healthSave, err)
+		if err != nil {
+			logf("Failed to save config after wan quota check: %v\n", err)
+		}
+
+		if enforce {
+			if wan.Action == wanActionIfdown {
+				disableWan(wan)
+			}
+		}
+	}
+}
+
+// Bring the WAN's host interfaces down, routing fails over to the remaining WANs
+func disableWan(wan Wan) {
+	for _, spec := range wan.Interfaces {
+		ifaces := []string{spec}
+		if isInterfacePattern(spec) {
+			ifaces = expandInterfacePattern(spec)
+		}
+		for _, iface := range ifaces {
+			name, netns := splitInterface(iface)
+			if netns != "" {
+				logf("Interface %s is in another namespace, not disabled\n", iface)
+				continue
+			}
+			if output, err := exec.Command("ip", "link", "set", "dev", name, "down").CombinedOutput(); err != nil {
+				logf("Failed to disable interface %s: %v: %s\n", name, err, strings.TrimSpace(string(output)))
+				continue
+			}
+			logf("Interface %s of wan %s disabled\n", name, wan.Name)
+		}
+	}
+}
+
+// Describe each WAN's usage for the period summary
+func describeWans(config *Config) string {
+	var lines []string
+	for _, wan := range config.Wans {
+		stats := config.Statistics.Wans[wan.Name]
+		line := fmt.Sprintf(tr("- %s：下载%.2f GB，上传%.2f GB"), wan.Name,
+			float64(stats.TotalReceive)/bytesToGB, float64(stats.TotalTransmit)/bytesToGB)
+		if wan.Comparison.Limit > 0 {
+			value := categoryUsageGB(wan.Comparison.Category, stats.TotalReceive, stats.TotalTransmit)
+			line += fmt.Sprintf("，%s %.2f / %.2f GB (%.1f%%)", wan.Comparison.Category, value, wan.Comparison.Limit, value/wan.Comparison.Limit*100)
+		} else {
+			line += tr("，不限量")
+		}
+		if stats.StandbyReceive+stats.StandbyTransmit > 0 {
+			line += fmt.Sprintf(tr("；备用期间%.2f GB未计入"), float64(stats.StandbyReceive+stats.StandbyTransmit)/bytesToGB)
+		}
+		if stats.ActiveSince != "" {
+			line += fmt.Sprintf(tr("；%s起承载默认路由"), formatEventTime(Event{Time: stats.ActiveSince}))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
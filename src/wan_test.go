@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Silence logf for the test, the -quiet flag is a package variable
+func silence(t *testing.T) {
+	previous := quiet
+	quiet = true
+	t.Cleanup(func() { quiet = previous })
+}
+
+func wanTestConfig(dir string) *Config {
+	config := &Config{Device: "router"}
+	config.Message.Service = "mock"
+	config.Message.Mock.File = filepath.Join(dir, "messages")
+	config.Wans = []Wan{{Name: "lte", Comparison: Comparison{Category: "upload+download", Limit: 10, Threshold: 0.5, Ratio: 0.8}}}
+	config.Statistics.Wans = map[string]WanStats{"lte": {TotalReceive: 6 << 30}}
+	return config
+}
+
+// A line's threshold alert follows the threshold route, an empty route sends nothing
+func TestWanThresholdFollowsRoute(t *testing.T) {
+	silence(t)
+	dir := t.TempDir()
+	config := wanTestConfig(dir)
+	config.Message.Routes = map[string][]string{routeThreshold: {}}
+
+	checkWanQuotas(config, filepath.Join(dir, "config.json"))
+	if !config.Statistics.Wans["lte"].ThresholdStatus {
+		t.Fatal("threshold not reached")
+	}
+	if data, _ := os.ReadFile(config.Message.Mock.File); len(data) != 0 {
+		t.Errorf("threshold alert sent past its route: %s", data)
+	}
+}
+
+// An alert the notifier didn't take waits in the outbox, the flag set for the period
+// must not lose it
+func TestWanAlertsQueuedWhenUndelivered(t *testing.T) {
+	silence(t)
+	replayHTTP(t, "ntfy")
+	dir := t.TempDir()
+	config := wanTestConfig(dir)
+	config.Message.Ntfy = NtfyMessage{URL: "https://ntfy.example.com", Topic: "router-alerts"}
+	config.Message.Routes = map[string][]string{routeThreshold: {"ntfy"}, routeRatio: {"ntfy"}}
+	config.Statistics.Wans["lte"] = WanStats{TotalReceive: 9 << 30}
+
+	checkWanQuotas(config, filepath.Join(dir, "config.json"))
+	if stats := config.Statistics.Wans["lte"]; !stats.ThresholdStatus || !stats.RatioStatus {
+		t.Fatalf("alerts not marked for the period: %+v", stats)
+	}
+	if len(config.Message.Outbox) != 2 {
+		t.Fatalf("%d messages in the outbox, want the threshold alert and the ratio warning", len(config.Message.Outbox))
+	}
+	for _, entry := range config.Message.Outbox {
+		if entry.Service != "ntfy" {
+			t.Errorf("queued for %s, want ntfy", entry.Service)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build noweb
+
+package main
+
+import "fmt"
+
+// Built with -tags noweb for a smaller binary without the dashboard, the API, the
+// webhooks and the OIDC login; the monitor and its notifications work as usual
+
+func validateHTTP(config *HTTPConfig) error {
+	return nil
+}
+
+func publishSnapshot(data []byte) {}
+
+func startHTTPServer(config HTTPConfig, initial Config, configFilePath string) error {
+	return fmt.Errorf("http listen %s is not available, this build excludes the web dashboard (noweb)", config.Listen)
+}
@@ -0,0 +1,91 @@
+//go:build !noweb
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Actions external systems may trigger, a reset needs an admin
+var webhookActions = map[string]bool{actionPause: true, actionResume: true, actionAnnotate: true, actionEvaluate: true}
+
+// The parameters of a webhook call, also accepted as form or query values
+type webhookRequest struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	For    string `json:"for"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// POST /api/webhook, for cron jobs and other systems that can only send a simple
+// request: the token comes as a bearer token or in the query, the parameters as JSON,
+// form or query values
+func handleWebhook(config HTTPConfig, configFilePath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		given := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			given = bearer
+		}
+		var hook *Webhook
+		for i := range config.Webhooks {
+			if subtle.ConstantTimeCompare([]byte(given), []byte(config.Webhooks[i].Token)) == 1 {
+				hook = &config.Webhooks[i]
+			}
+		}
+		if hook == nil {
+			if given != "" {
+				logAuthFailure(r, "unauthorized", "")
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var params webhookRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				http.Error(w, fmt.Sprintf("invalid JSON: %v", err), http.StatusBadRequest)
+				return
+			}
+		} else {
+			params = webhookRequest{Action: r.FormValue("action"), Reason: r.FormValue("reason"),
+				For: r.FormValue("for"), From: r.FormValue("from"), To: r.FormValue("to")}
+		}
+
+		if !webhookActions[params.Action] {
+			http.Error(w, fmt.Sprintf("unknown action %q", params.Action), http.StatusBadRequest)
+			return
+		}
+		if len(hook.Actions) > 0 && !slices.Contains(hook.Actions, params.Action) {
+			logAuthFailure(r, "forbidden", "webhook:"+hook.Name)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		command, err := controlCommand(params.Action, func(key string) string {
+			return map[string]string{"reason": params.Reason, "for": params.For, "from": params.From, "to": params.To}[key]
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		command.By = "webhook:" + hook.Name
+		if err := queueCommand(configFilePath, command); err != nil {
+			logf("Failed to queue %s from webhook %s: %v\n", params.Action, hook.Name, err)
+			http.Error(w, "failed to queue command", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"queued": params.Action})
+	}
+}
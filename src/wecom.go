@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const weComAPI = "https://qyapi.weixin.qq.com/cgi-bin"
+
+// Error codes of an invalid or expired access token, the token is fetched again
+var weComTokenErrors = map[int]bool{40001: true, 40014: true, 42001: true}
+
+type WeComMessage struct {
+	ThresholdStatus bool   `json:"threshold_status"`
+	RatioStatus     bool   `json:"ratio_status"`
+	CorpID          string `json:"corp_id"`           // 企业ID
+	CorpSecret      string `json:"corp_secret"`       // 应用的Secret
+	AgentID         int    `json:"agent_id"`          // 应用的AgentId
+	ToUser          string `json:"to_user,omitempty"` // 接收消息的成员，多个用|分隔，为空时发给应用可见范围内的所有人
+}
+
+// The access token of the app, kept in memory until shortly before it expires. Messages
+// are only sent from the monitor loop, so it needs no lock.
+var weComToken struct {
+	corpID, secret string
+	token          string
+	expires        time.Time
+}
+
+// Return the cached access token or fetch a new one
+func weComAccessToken(wecom WeComMessage, refresh bool) (string, error) {
+	cached := weComToken.corpID == wecom.CorpID && weComToken.secret == wecom.CorpSecret
+	if !refresh && cached && time.Now().Before(weComToken.expires) {
+		return weComToken.token, nil
+	}
+
+	query := url.Values{"corpid": {wecom.CorpID}, "corpsecret": {wecom.CorpSecret}}
+	resp, err := notifyClient("wecom").Get(weComAPI + "/gettoken?" + query.Encode())
+	if err != nil {
+		return "", fmt.Errorf("failed to get WeCom access token: %v", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to read WeCom token response: %s %v", resp.Status, err)
+	}
+	if result.ErrCode != 0 || result.AccessToken == "" {
+		return "", fmt.Errorf("got error from WeCom getting the token: %d %s", result.ErrCode, result.ErrMsg)
+	}
+
+	// Renewed five minutes early, the token may be refreshed elsewhere meanwhile
+	weComToken.corpID, weComToken.secret = wecom.CorpID, wecom.CorpSecret
+	weComToken.token = result.AccessToken
+	weComToken.expires = time.Now().Add(time.Duration(result.ExpiresIn)*time.Second - 5*time.Minute)
+	return result.AccessToken, nil
+}
+
+// Send a text message through a WeCom app, fetching a new token once when the cached
+// one is rejected
+func sendWeComMessage(wecom WeComMessage, message, device string) error {
+	toUser := wecom.ToUser
+	if toUser == "" {
+		toUser = "@all"
+	}
+	jsonBody, _ := json.Marshal(map[string]any{
+		"touser":  toUser,
+		"msgtype": "text",
+		"agentid": wecom.AgentID,
+		"text":    map[string]string{"content": fmt.Sprintf("[%s] %s", device, message)},
+	})
+
+	for attempt := 0; ; attempt++ {
+		token, err := weComAccessToken(wecom, attempt > 0)
+		if err != nil {
+			return err
+		}
+		resp, err := notifyClient("wecom").Post(weComAPI+"/message/send?access_token="+url.QueryEscape(token), "application/json", bytes.NewBuffer(jsonBody))
+		if err != nil {
+			return fmt.Errorf("failed to send message to WeCom: %v", err)
+		}
+		var result struct {
+			ErrCode int    `json:"errcode"`
+			ErrMsg  string `json:"errmsg"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read WeCom response: %s %v", resp.Status, err)
+		}
+		if weComTokenErrors[result.ErrCode] && attempt == 0 {
+			continue
+		}
+		if result.ErrCode != 0 {
+			return fmt.Errorf("got error from WeCom: %d %s", result.ErrCode, result.ErrMsg)
+		}
+		return nil
+	}
+}